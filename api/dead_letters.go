@@ -0,0 +1,60 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/leveldorado/screenshot/capture"
+	"github.com/leveldorado/screenshot/queue"
+)
+
+type deadLetterRecorder interface {
+	RecordDeadLetter(ctx context.Context, dl capture.DeadLetter) error
+}
+
+// DeadLetterHandler persists shot requests which capture workers gave up on
+type DeadLetterHandler struct {
+	s              deadLetterRecorder
+	q              groupSubscriber
+	requestTimeout time.Duration
+}
+
+func NewDeadLetterHandler(s deadLetterRecorder, q groupSubscriber, requestTimeout time.Duration) *DeadLetterHandler {
+	return &DeadLetterHandler{s: s, q: q, requestTimeout: requestTimeout}
+}
+
+func (h *DeadLetterHandler) Run(ctx context.Context) error {
+	sub, err := h.q.GroupSubscribe(ctx, capture.DeadLetterTopic, subscriptionGroupAPI)
+	if err != nil {
+		return fmt.Errorf(`failed to subscribe dead letter topic: [error: %w]`, err)
+	}
+	go func() {
+		for msg := range sub {
+			h.handleMessage(msg)
+		}
+	}()
+	return nil
+}
+
+func (h *DeadLetterHandler) Stop(ctx context.Context) error {
+	return nil
+}
+
+func (h *DeadLetterHandler) handleMessage(msg queue.Message) {
+	var dl capture.DeadLetter
+	if err := json.Unmarshal(msg.Data, &dl); err != nil {
+		log.Println(fmt.Sprintf(`failed to unmarshal dead letter: [msg: %s, error: %s]`, msg.Data, err))
+		ackMessage(capture.DeadLetterTopic, msg)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), h.requestTimeout)
+	defer cancel()
+	if err := h.s.RecordDeadLetter(ctx, dl); err != nil {
+		log.Println(fmt.Sprintf(`failed to record dead letter: [failed_request_id: %s, error: %s]`, dl.FailedRequestID, err))
+		return
+	}
+	ackMessage(capture.DeadLetterTopic, msg)
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/leveldorado/screenshot/capture"
+	"github.com/leveldorado/screenshot/queue"
+	"github.com/leveldorado/screenshot/store"
+)
+
+type mockDeadLetterRecorder struct {
+	mock.Mock
+}
+
+func (m *mockDeadLetterRecorder) RecordDeadLetter(ctx context.Context, dl capture.DeadLetter) error {
+	return m.Called(ctx, dl).Error(0)
+}
+
+func TestDeadLetterHandler_Run(t *testing.T) {
+	dl := capture.DeadLetter{
+		FailedRequestID: uuid.New().String(),
+		Request:         capture.ShotRequest{URL: uuid.New().String()},
+		Errors:          []store.FailedAttempt{{Attempt: 1, ErrorClass: string(capture.ErrorClassDNS), Error: "net::ERR_NAME_NOT_RESOLVED"}},
+	}
+	s := &mockDeadLetterRecorder{}
+	s.On("RecordDeadLetter", mock.Anything, dl).Return(nil)
+	msgChan := make(chan queue.Message)
+	q := &mockGroupSubscriber{}
+	q.On("GroupSubscribe", mock.Anything, capture.DeadLetterTopic, subscriptionGroupAPI).Return(msgChan, nil)
+	h := NewDeadLetterHandler(s, q, time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, h.Run(ctx))
+	data, err := json.Marshal(dl)
+	require.NoError(t, err)
+	msgChan <- queue.Message{Data: data}
+	<-time.After(10 * time.Millisecond)
+	s.AssertExpectations(t)
+	q.AssertExpectations(t)
+}
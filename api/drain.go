@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/labstack/echo"
+)
+
+// drainState tracks in-flight mutating requests so shutdown can wait for them while new ones are rejected
+type drainState struct {
+	mu       sync.Mutex
+	draining bool
+	inFlight sync.WaitGroup
+}
+
+func (d *drainState) enter() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.draining {
+		return false
+	}
+	d.inFlight.Add(1)
+	return true
+}
+
+func (d *drainState) leave() {
+	d.inFlight.Done()
+}
+
+func (d *drainState) isDraining() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.draining
+}
+
+// drain rejects new requests and waits for in-flight ones
+func (d *drainState) drain(ctx context.Context) error {
+	d.mu.Lock()
+	d.draining = true
+	d.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		d.inFlight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf(`timeout waiting for in-flight requests: [error: %w]`, ctx.Err())
+	}
+}
+
+const retryAfterSeconds = "5"
+
+// safe methods do not change state, so they are served while draining
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
+
+func (h *HTTPHandler) rejectWhileDraining(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		if isSafeMethod(ctx.Request().Method) {
+			return next(ctx)
+		}
+		if !h.drain.enter() {
+			ctx.Response().Header().Set("Retry-After", retryAfterSeconds)
+			return ctx.JSON(http.StatusServiceUnavailable, ErrorResponse{Message: "server is shutting down"})
+		}
+		defer h.drain.leave()
+		return next(ctx)
+	}
+}
+
+type HealthResponse struct {
+	Status string `json:"status"`
+}
+
+const (
+	healthStatusOK       = "ok"
+	healthStatusDraining = "draining"
+)
+
+// getHealth lets load balancer take instance out of rotation while it drains
+func (h *HTTPHandler) getHealth(ctx echo.Context) error {
+	if h.drain.isDraining() {
+		return ctx.JSON(http.StatusServiceUnavailable, HealthResponse{Status: healthStatusDraining})
+	}
+	return ctx.JSON(http.StatusOK, HealthResponse{Status: healthStatusOK})
+}
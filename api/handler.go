@@ -1,25 +1,48 @@
 package api
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"image/png"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/labstack/echo/middleware"
 
 	"github.com/labstack/echo"
 
+	"github.com/leveldorado/screenshot/capture"
+	"github.com/leveldorado/screenshot/diff"
 	"github.com/leveldorado/screenshot/store"
 )
 
 type service interface {
-	MakeShots(ctx context.Context, urls []string) []ResponseItem
-	GetScreenshot(ctx context.Context, url string, version int) (file io.ReadCloser, contentType string, err error)
-	GetScreenshotVersions(ctx context.Context, url string) ([]store.Metadata, error)
+	MakeShots(ctx context.Context, reqs []capture.ShotRequest) []ResponseItem
+	GetScreenshot(ctx context.Context, url, selector string, version int) (file io.ReadCloser, contentType string, err error)
+	GetScreenshotRedirect(ctx context.Context, url, selector string, version int) (string, error)
+	GetScreenshotVersions(ctx context.Context, url, selector string) ([]store.Metadata, error)
+	DiffScreenshots(ctx context.Context, url, selector string, from, to int, opt diff.Options) (diff.Result, error)
+	GetChromeStats(ctx context.Context) ([]capture.WorkerStats, error)
+	CreateJob(ctx context.Context, reqs []capture.ShotRequest) (store.Job, error)
+	GetJob(ctx context.Context, id string) (store.Job, error)
+	ListWebhookDeliveries(ctx context.Context, onlyFailed bool, limit int) ([]store.WebhookDelivery, error)
+	GetWebhookDelivery(ctx context.Context, id string) (store.WebhookDelivery, error)
+	ReplayWebhookDelivery(ctx context.Context, id string) (store.WebhookDelivery, error)
+	ListFailedRequests(ctx context.Context, state store.FailedRequestState, limit int) ([]store.FailedRequest, error)
+	GetFailedRequest(ctx context.Context, id string) (store.FailedRequest, error)
+	RequeueFailedRequests(ctx context.Context, ids []string) ([]store.FailedRequest, error)
+	CreateSchedule(ctx context.Context, sch store.Schedule) (store.Schedule, error)
+	GetSchedule(ctx context.Context, id string) (store.Schedule, error)
+	ListSchedules(ctx context.Context, limit int) ([]store.Schedule, error)
+	UpdateSchedule(ctx context.Context, sch store.Schedule) (store.Schedule, error)
+	DeleteSchedule(ctx context.Context, id string) error
 }
 
 type httpServer interface {
@@ -31,12 +54,14 @@ type HTTPHandler struct {
 	server  *echo.Echo
 	s       service
 	address string
+	drain   *drainState
 }
 
 func NewHTTPHandler(s service, addr string) *HTTPHandler {
 	e := echo.New()
 	e.Use(middleware.Recover())
-	h := &HTTPHandler{s: s, address: addr, server: e}
+	h := &HTTPHandler{s: s, address: addr, server: e, drain: &drainState{}}
+	e.Use(h.rejectWhileDraining)
 	h.registerEndpoints()
 	return h
 }
@@ -51,36 +76,128 @@ func (h *HTTPHandler) Run(ctx context.Context) error {
 	return nil
 }
 
+// Stop answers 503 to new mutating requests until in-flight ones are finished and then shuts server down
 func (h *HTTPHandler) Stop(ctx context.Context) error {
+	if err := h.drain.drain(ctx); err != nil {
+		log.Println(fmt.Sprintf(`failed to drain http server: [error: %s]`, err))
+	}
 	return h.server.Shutdown(ctx)
 }
 
 const (
 	ScreenshotPath         = "/api/v1/screenshot"
 	ScreenshotVersionsPath = "/api/v1/screenshot/versions"
+	ScreenshotDiffPath     = "/api/v1/screenshot/diff"
+	DevicesPath            = "/api/v1/devices"
+	ChromeStatsPath        = "/api/v1/chrome/stats"
+	JobsPath               = "/api/v1/jobs"
+	WebhookDeliveriesPath  = "/api/v1/webhooks/deliveries"
+	HealthPath             = "/api/v1/health"
+	FailedRequestsPath     = "/api/v1/failed_requests"
+	SchedulesPath          = "/api/v1/schedules"
 )
 
 func (h *HTTPHandler) registerEndpoints() {
 	h.server.POST(ScreenshotPath, h.makeShots)
 	h.server.GET(ScreenshotPath, h.getScreenshot)
 	h.server.GET(ScreenshotVersionsPath, h.getScreenshotVersions)
+	h.server.GET(ScreenshotDiffPath, h.diffScreenshots)
+	h.server.GET(DevicesPath, h.getDevices)
+	h.server.GET(ChromeStatsPath, h.getChromeStats)
+	h.server.POST(JobsPath, h.createJob)
+	h.server.GET(JobsPath+"/:id", h.getJob)
+	h.server.GET(WebhookDeliveriesPath, h.listWebhookDeliveries)
+	h.server.GET(WebhookDeliveriesPath+"/:id", h.getWebhookDelivery)
+	h.server.POST(WebhookDeliveriesPath+"/:id/replay", h.replayWebhookDelivery)
+	h.server.GET(HealthPath, h.getHealth)
+	h.server.GET(FailedRequestsPath, h.listFailedRequests)
+	h.server.GET(FailedRequestsPath+"/:id", h.getFailedRequest)
+	h.server.POST(FailedRequestsPath+"/requeue", h.requeueFailedRequests)
+	h.server.POST(SchedulesPath, h.createSchedule)
+	h.server.GET(SchedulesPath, h.listSchedules)
+	h.server.GET(SchedulesPath+"/:id", h.getSchedule)
+	h.server.PUT(SchedulesPath+"/:id", h.updateSchedule)
+	h.server.DELETE(SchedulesPath+"/:id", h.deleteSchedule)
+}
+
+// ShotItem accepts either plain url string or object with url and capture options
+type ShotItem struct {
+	URL         string `json:"url"`
+	CallbackURL string `json:"callback_url,omitempty"`
+	capture.ShotOptions
+}
+
+func (i *ShotItem) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(`"`)) {
+		return json.Unmarshal(data, &i.URL)
+	}
+	type plain ShotItem
+	return json.Unmarshal(data, (*plain)(i))
 }
 
 type MakeShotsRequest struct {
-	URLs []string `json:"urls"`
+	URLs []ShotItem `json:"urls"`
+	// callback url and options applied to every item which does not specify own value
+	CallbackURL string `json:"callback_url,omitempty"`
+	// queue lane of every url (high, normal or bulk). normal when empty
+	Priority capture.Priority `json:"priority,omitempty"`
+	capture.ShotOptions
 }
 
-func (req MakeShotsRequest) getUniqueUrls() []string {
+func NewMakeShotsRequest(urls []string, opt capture.ShotOptions) MakeShotsRequest {
+	req := MakeShotsRequest{ShotOptions: opt}
+	for _, u := range urls {
+		req.URLs = append(req.URLs, ShotItem{URL: u})
+	}
+	return req
+}
+
+func (req MakeShotsRequest) getUniqueShotRequests() ([]capture.ShotRequest, error) {
+	if err := req.Priority.Validate(); err != nil {
+		return nil, err
+	}
 	m := map[string]struct{}{}
-	var unique []string
-	for _, url := range req.URLs {
-		if _, ok := m[url]; ok {
+	var unique []capture.ShotRequest
+	for _, item := range req.URLs {
+		if item.URL == "" {
+			return nil, errors.New("url can not be empty")
+		}
+		shotReq := capture.ShotRequest{URL: item.URL, CallbackURL: item.CallbackURL, Priority: req.Priority, ShotOptions: item.ShotOptions.WithDefaults(req.ShotOptions)}
+		if shotReq.CallbackURL == "" {
+			shotReq.CallbackURL = req.CallbackURL
+		}
+		if err := shotReq.Validate(); err != nil {
+			return nil, fmt.Errorf(`invalid options: [url: %s, error: %w]`, item.URL, err)
+		}
+		if err := validateCallbackURL(shotReq.CallbackURL); err != nil {
+			return nil, err
+		}
+		// requests are compared by json representation because options contain slices
+		key, err := json.Marshal(shotReq)
+		if err != nil {
+			return nil, fmt.Errorf(`failed to marshal shot request: [url: %s, error: %w]`, item.URL, err)
+		}
+		if _, ok := m[string(key)]; ok {
 			continue
 		}
-		m[url] = struct{}{}
-		unique = append(unique, url)
+		m[string(key)] = struct{}{}
+		unique = append(unique, shotReq)
+	}
+	return unique, nil
+}
+
+func validateCallbackURL(callbackURL string) error {
+	if callbackURL == "" {
+		return nil
 	}
-	return unique
+	u, err := url.Parse(callbackURL)
+	if err != nil {
+		return fmt.Errorf(`invalid callback url: [callback_url: %s, error: %w]`, callbackURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf(`invalid callback url: [callback_url: %s, error: scheme must be http or https]`, callbackURL)
+	}
+	return nil
 }
 
 type ErrorResponse struct {
@@ -92,10 +209,44 @@ func (h HTTPHandler) makeShots(ctx echo.Context) error {
 	if err := ctx.Bind(&req); err != nil {
 		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: err.Error()})
 	}
-	response := h.s.MakeShots(ctx.Request().Context(), req.getUniqueUrls())
+	reqs, err := req.getUniqueShotRequests()
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: err.Error()})
+	}
+	response := h.s.MakeShots(ctx.Request().Context(), reqs)
 	return ctx.JSON(http.StatusOK, response)
 }
 
+func (h HTTPHandler) createJob(ctx echo.Context) error {
+	req := MakeShotsRequest{}
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: err.Error()})
+	}
+	reqs, err := req.getUniqueShotRequests()
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: err.Error()})
+	}
+	if len(reqs) == 0 {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "no urls specified"})
+	}
+	job, err := h.s.CreateJob(ctx.Request().Context(), reqs)
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: err.Error()})
+	}
+	return ctx.JSON(http.StatusAccepted, job)
+}
+
+func (h HTTPHandler) getJob(ctx echo.Context) error {
+	job, err := h.s.GetJob(ctx.Request().Context(), ctx.Param("id"))
+	if errors.As(err, &store.ErrNotFound{}) {
+		return ctx.JSON(http.StatusNotFound, ErrorResponse{Message: "job not found"})
+	}
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: err.Error()})
+	}
+	return ctx.JSON(http.StatusOK, job)
+}
+
 func (h HTTPHandler) getScreenshot(ctx echo.Context) error {
 	url := ctx.QueryParam("url")
 	if url == "" {
@@ -110,7 +261,17 @@ func (h HTTPHandler) getScreenshot(ctx echo.Context) error {
 		}
 		version = int(v)
 	}
-	file, contentType, err := h.s.GetScreenshot(ctx.Request().Context(), url, version)
+	location, err := h.s.GetScreenshotRedirect(ctx.Request().Context(), url, ctx.QueryParam("selector"), version)
+	if errors.As(err, &store.ErrNotFound{}) {
+		return ctx.JSON(http.StatusNotFound, ErrorResponse{Message: "screenshot not found"})
+	}
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: err.Error()})
+	}
+	if location != "" {
+		return ctx.Redirect(http.StatusTemporaryRedirect, location)
+	}
+	file, contentType, err := h.s.GetScreenshot(ctx.Request().Context(), url, ctx.QueryParam("selector"), version)
 	if errors.As(err, &store.ErrNotFound{}) {
 		return ctx.JSON(http.StatusNotFound, ErrorResponse{Message: "screenshot not found"})
 	}
@@ -126,9 +287,260 @@ func (h HTTPHandler) getScreenshotVersions(ctx echo.Context) error {
 	if url == "" {
 		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "missing required query parameter url"})
 	}
-	resp, err := h.s.GetScreenshotVersions(ctx.Request().Context(), url)
+	resp, err := h.s.GetScreenshotVersions(ctx.Request().Context(), url, ctx.QueryParam("selector"))
 	if err != nil {
 		return ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: err.Error()})
 	}
 	return ctx.JSONPretty(http.StatusOK, resp, "\t")
 }
+
+func parseVersion(ctx echo.Context, name string) (int, error) {
+	param := ctx.QueryParam(name)
+	if param == "" {
+		return 0, fmt.Errorf(`missing required query parameter %s`, name)
+	}
+	v, err := strconv.Atoi(param)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf(`invalid parameter %s: [%s: %s, error: must be positive integer]`, name, name, param)
+	}
+	return v, nil
+}
+
+const (
+	diffFormatImage = "png"
+	diffFormatJSON  = "json"
+)
+
+func (h HTTPHandler) diffScreenshots(ctx echo.Context) error {
+	url := ctx.QueryParam("url")
+	if url == "" {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "missing required query parameter url"})
+	}
+	from, err := parseVersion(ctx, "from")
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: err.Error()})
+	}
+	to, err := parseVersion(ctx, "to")
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: err.Error()})
+	}
+	var opt diff.Options
+	if toleranceParam := ctx.QueryParam("tolerance"); toleranceParam != "" {
+		tolerance, err := strconv.ParseUint(toleranceParam, 10, 8)
+		if err != nil {
+			return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: fmt.Sprintf(`invalid parameter tolerance: [tolerance: %s, min: 0, max: 255]`, toleranceParam)})
+		}
+		opt.Tolerance = uint8(tolerance)
+	}
+	format := ctx.QueryParam("format")
+	if format != "" && format != diffFormatImage && format != diffFormatJSON {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: fmt.Sprintf(`invalid parameter format %s. please use one of (png, json)`, format)})
+	}
+	res, err := h.s.DiffScreenshots(ctx.Request().Context(), url, ctx.QueryParam("selector"), from, to, opt)
+	if errors.As(err, &store.ErrNotFound{}) {
+		return ctx.JSON(http.StatusNotFound, ErrorResponse{Message: "screenshot not found"})
+	}
+	if errors.Is(err, ErrNotImage) {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: err.Error()})
+	}
+	if errors.Is(err, diff.ErrImageTooLarge) {
+		return ctx.JSON(http.StatusUnprocessableEntity, ErrorResponse{Message: err.Error()})
+	}
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: err.Error()})
+	}
+	if format == diffFormatJSON {
+		return ctx.JSON(http.StatusOK, res)
+	}
+	buff := &bytes.Buffer{}
+	if err = png.Encode(buff, res.Image); err != nil {
+		return ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: err.Error()})
+	}
+	return ctx.Blob(http.StatusOK, "image/png", buff.Bytes())
+}
+
+func (h HTTPHandler) getDevices(ctx echo.Context) error {
+	return ctx.JSONPretty(http.StatusOK, capture.ListDevices(), "\t")
+}
+
+func (h HTTPHandler) getChromeStats(ctx echo.Context) error {
+	stats, err := h.s.GetChromeStats(ctx.Request().Context())
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: err.Error()})
+	}
+	return ctx.JSONPretty(http.StatusOK, stats, "\t")
+}
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+)
+
+func parseLimit(ctx echo.Context) (int, error) {
+	limitParam := ctx.QueryParam("limit")
+	if limitParam == "" {
+		return defaultListLimit, nil
+	}
+	limit, err := strconv.Atoi(limitParam)
+	if err != nil || limit <= 0 || limit > maxListLimit {
+		return 0, fmt.Errorf(`invalid parameter limit: [limit: %s, min: 1, max: %d]`, limitParam, maxListLimit)
+	}
+	return limit, nil
+}
+
+func (h HTTPHandler) listWebhookDeliveries(ctx echo.Context) error {
+	limit, err := parseLimit(ctx)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: err.Error()})
+	}
+	onlyFailed := ctx.QueryParam("failed") == "true"
+	list, err := h.s.ListWebhookDeliveries(ctx.Request().Context(), onlyFailed, limit)
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: err.Error()})
+	}
+	return ctx.JSONPretty(http.StatusOK, list, "\t")
+}
+
+func (h HTTPHandler) getWebhookDelivery(ctx echo.Context) error {
+	d, err := h.s.GetWebhookDelivery(ctx.Request().Context(), ctx.Param("id"))
+	if errors.As(err, &store.ErrNotFound{}) {
+		return ctx.JSON(http.StatusNotFound, ErrorResponse{Message: "webhook delivery not found"})
+	}
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: err.Error()})
+	}
+	return ctx.JSON(http.StatusOK, d)
+}
+
+func (h HTTPHandler) replayWebhookDelivery(ctx echo.Context) error {
+	d, err := h.s.ReplayWebhookDelivery(ctx.Request().Context(), ctx.Param("id"))
+	if errors.As(err, &store.ErrNotFound{}) {
+		return ctx.JSON(http.StatusNotFound, ErrorResponse{Message: "webhook delivery not found"})
+	}
+	// failed replay is still recorded as attempt so delivery is returned to show it
+	if err != nil && d.ID == "" {
+		return ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: err.Error()})
+	}
+	return ctx.JSON(http.StatusOK, d)
+}
+
+func (h HTTPHandler) listFailedRequests(ctx echo.Context) error {
+	limit, err := parseLimit(ctx)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: err.Error()})
+	}
+	state := store.FailedRequestState(ctx.QueryParam("state"))
+	switch state {
+	case "", store.FailedRequestStateFailed, store.FailedRequestStateRequeued:
+	default:
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: fmt.Sprintf(`unsupported state %s. please use one of (failed, requeued)`, state)})
+	}
+	list, err := h.s.ListFailedRequests(ctx.Request().Context(), state, limit)
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: err.Error()})
+	}
+	return ctx.JSONPretty(http.StatusOK, list, "\t")
+}
+
+func (h HTTPHandler) getFailedRequest(ctx echo.Context) error {
+	r, err := h.s.GetFailedRequest(ctx.Request().Context(), ctx.Param("id"))
+	if errors.As(err, &store.ErrNotFound{}) {
+		return ctx.JSON(http.StatusNotFound, ErrorResponse{Message: "failed request not found"})
+	}
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: err.Error()})
+	}
+	return ctx.JSON(http.StatusOK, r)
+}
+
+type RequeueRequest struct {
+	IDs []string `json:"ids"`
+}
+
+func (h HTTPHandler) requeueFailedRequests(ctx echo.Context) error {
+	req := RequeueRequest{}
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: err.Error()})
+	}
+	if len(req.IDs) == 0 {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "no ids specified"})
+	}
+	list, err := h.s.RequeueFailedRequests(ctx.Request().Context(), req.IDs)
+	if errors.As(err, &store.ErrNotFound{}) {
+		return ctx.JSON(http.StatusNotFound, ErrorResponse{Message: err.Error()})
+	}
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: err.Error()})
+	}
+	return ctx.JSON(http.StatusOK, list)
+}
+
+func (h HTTPHandler) createSchedule(ctx echo.Context) error {
+	req := ScheduleRequest{}
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: err.Error()})
+	}
+	sch, err := req.schedule(time.Now())
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: err.Error()})
+	}
+	sch, err = h.s.CreateSchedule(ctx.Request().Context(), sch)
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: err.Error()})
+	}
+	return ctx.JSON(http.StatusCreated, sch)
+}
+
+func (h HTTPHandler) listSchedules(ctx echo.Context) error {
+	limit, err := parseLimit(ctx)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: err.Error()})
+	}
+	list, err := h.s.ListSchedules(ctx.Request().Context(), limit)
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: err.Error()})
+	}
+	return ctx.JSONPretty(http.StatusOK, list, "\t")
+}
+
+func (h HTTPHandler) getSchedule(ctx echo.Context) error {
+	sch, err := h.s.GetSchedule(ctx.Request().Context(), ctx.Param("id"))
+	if errors.As(err, &store.ErrNotFound{}) {
+		return ctx.JSON(http.StatusNotFound, ErrorResponse{Message: "schedule not found"})
+	}
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: err.Error()})
+	}
+	return ctx.JSON(http.StatusOK, sch)
+}
+
+func (h HTTPHandler) updateSchedule(ctx echo.Context) error {
+	req := ScheduleRequest{}
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: err.Error()})
+	}
+	sch, err := req.schedule(time.Now())
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: err.Error()})
+	}
+	sch.ID = ctx.Param("id")
+	sch, err = h.s.UpdateSchedule(ctx.Request().Context(), sch)
+	if errors.As(err, &store.ErrNotFound{}) {
+		return ctx.JSON(http.StatusNotFound, ErrorResponse{Message: "schedule not found"})
+	}
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: err.Error()})
+	}
+	return ctx.JSON(http.StatusOK, sch)
+}
+
+func (h HTTPHandler) deleteSchedule(ctx echo.Context) error {
+	err := h.s.DeleteSchedule(ctx.Request().Context(), ctx.Param("id"))
+	if errors.As(err, &store.ErrNotFound{}) {
+		return ctx.JSON(http.StatusNotFound, ErrorResponse{Message: "schedule not found"})
+	}
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: err.Error()})
+	}
+	return ctx.NoContent(http.StatusNoContent)
+}
@@ -5,15 +5,20 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"image"
+	"image/png"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo"
+	"github.com/leveldorado/screenshot/capture"
+	"github.com/leveldorado/screenshot/diff"
 	"github.com/leveldorado/screenshot/store"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -23,23 +28,101 @@ type mockService struct {
 	mock.Mock
 }
 
-func (m *mockService) MakeShots(ctx context.Context, urls []string) []ResponseItem {
-	return m.Called(ctx, urls).Get(0).([]ResponseItem)
+func (m *mockService) MakeShots(ctx context.Context, reqs []capture.ShotRequest) []ResponseItem {
+	return m.Called(ctx, reqs).Get(0).([]ResponseItem)
 }
-func (m *mockService) GetScreenshot(ctx context.Context, url string, version int) (file io.ReadCloser, contentType string, err error) {
-	args := m.Called(ctx, url, version)
+func (m *mockService) GetScreenshot(ctx context.Context, url, selector string, version int) (file io.ReadCloser, contentType string, err error) {
+	args := m.Called(ctx, url, selector, version)
 	return args.Get(0).(io.ReadCloser), args.Get(1).(string), args.Error(2)
 }
-func (m *mockService) GetScreenshotVersions(ctx context.Context, url string) ([]store.Metadata, error) {
-	args := m.Called(ctx, url)
+func (m *mockService) GetScreenshotRedirect(ctx context.Context, url, selector string, version int) (string, error) {
+	args := m.Called(ctx, url, selector, version)
+	return args.String(0), args.Error(1)
+}
+func (m *mockService) GetScreenshotVersions(ctx context.Context, url, selector string) ([]store.Metadata, error) {
+	args := m.Called(ctx, url, selector)
 	return args.Get(0).([]store.Metadata), args.Error(1)
 }
 
+func (m *mockService) DiffScreenshots(ctx context.Context, url, selector string, from, to int, opt diff.Options) (diff.Result, error) {
+	args := m.Called(ctx, url, selector, from, to, opt)
+	return args.Get(0).(diff.Result), args.Error(1)
+}
+
+func (m *mockService) GetChromeStats(ctx context.Context) ([]capture.WorkerStats, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]capture.WorkerStats), args.Error(1)
+}
+
+func (m *mockService) CreateJob(ctx context.Context, reqs []capture.ShotRequest) (store.Job, error) {
+	args := m.Called(ctx, reqs)
+	return args.Get(0).(store.Job), args.Error(1)
+}
+
+func (m *mockService) GetJob(ctx context.Context, id string) (store.Job, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(store.Job), args.Error(1)
+}
+
+func (m *mockService) ListWebhookDeliveries(ctx context.Context, onlyFailed bool, limit int) ([]store.WebhookDelivery, error) {
+	args := m.Called(ctx, onlyFailed, limit)
+	return args.Get(0).([]store.WebhookDelivery), args.Error(1)
+}
+
+func (m *mockService) GetWebhookDelivery(ctx context.Context, id string) (store.WebhookDelivery, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(store.WebhookDelivery), args.Error(1)
+}
+
+func (m *mockService) ReplayWebhookDelivery(ctx context.Context, id string) (store.WebhookDelivery, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(store.WebhookDelivery), args.Error(1)
+}
+
+func (m *mockService) ListFailedRequests(ctx context.Context, state store.FailedRequestState, limit int) ([]store.FailedRequest, error) {
+	args := m.Called(ctx, state, limit)
+	return args.Get(0).([]store.FailedRequest), args.Error(1)
+}
+
+func (m *mockService) GetFailedRequest(ctx context.Context, id string) (store.FailedRequest, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(store.FailedRequest), args.Error(1)
+}
+
+func (m *mockService) RequeueFailedRequests(ctx context.Context, ids []string) ([]store.FailedRequest, error) {
+	args := m.Called(ctx, ids)
+	return args.Get(0).([]store.FailedRequest), args.Error(1)
+}
+
+func (m *mockService) CreateSchedule(ctx context.Context, sch store.Schedule) (store.Schedule, error) {
+	args := m.Called(ctx, sch)
+	return args.Get(0).(store.Schedule), args.Error(1)
+}
+
+func (m *mockService) GetSchedule(ctx context.Context, id string) (store.Schedule, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(store.Schedule), args.Error(1)
+}
+
+func (m *mockService) ListSchedules(ctx context.Context, limit int) ([]store.Schedule, error) {
+	args := m.Called(ctx, limit)
+	return args.Get(0).([]store.Schedule), args.Error(1)
+}
+
+func (m *mockService) UpdateSchedule(ctx context.Context, sch store.Schedule) (store.Schedule, error) {
+	args := m.Called(ctx, sch)
+	return args.Get(0).(store.Schedule), args.Error(1)
+}
+
+func (m *mockService) DeleteSchedule(ctx context.Context, id string) error {
+	return m.Called(ctx, id).Error(0)
+}
+
 func TestHTTPHandlerGetScreenshotVersions(t *testing.T) {
 	s := &mockService{}
 	url := uuid.New().String()
 	response := []store.Metadata{{ID: uuid.New().String(), Url: url, Format: "jpeg", Version: 13}}
-	s.On("GetScreenshotVersions", mock.Anything, url).Return(response, nil)
+	s.On("GetScreenshotVersions", mock.Anything, url, "").Return(response, nil)
 	h := NewHTTPHandler(s, "address")
 	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf(`%s?url=%s`, ScreenshotVersionsPath, url), nil)
 	resp := httptest.NewRecorder()
@@ -59,7 +142,8 @@ func TestHTTPHandlerGetScreenshot(t *testing.T) {
 	data := uuid.New().String()
 	file := ioutil.NopCloser(strings.NewReader(data))
 	contentType := "image/jpeg"
-	s.On("GetScreenshot", mock.Anything, url, version).Return(file, contentType, nil)
+	s.On("GetScreenshotRedirect", mock.Anything, url, "", version).Return("", nil)
+	s.On("GetScreenshot", mock.Anything, url, "", version).Return(file, contentType, nil)
 	h := NewHTTPHandler(s, "address")
 	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf(`%s?url=%s&version=%d`, ScreenshotPath, url, version), nil)
 	resp := httptest.NewRecorder()
@@ -71,14 +155,64 @@ func TestHTTPHandlerGetScreenshot(t *testing.T) {
 	s.AssertExpectations(t)
 }
 
+func TestHTTPHandlerGetScreenshotRedirect(t *testing.T) {
+	s := &mockService{}
+	url := uuid.New().String()
+	location := "http://s3/" + uuid.New().String()
+	s.On("GetScreenshotRedirect", mock.Anything, url, "", 0).Return(location, nil)
+	h := NewHTTPHandler(s, "address")
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf(`%s?url=%s`, ScreenshotPath, url), nil)
+	resp := httptest.NewRecorder()
+	ctx := h.server.NewContext(req, resp)
+	require.NoError(t, h.getScreenshot(ctx))
+	require.Equal(t, http.StatusTemporaryRedirect, resp.Code)
+	require.Equal(t, location, resp.Header().Get(echo.HeaderLocation))
+	s.AssertExpectations(t)
+}
+
+func TestHTTPHandlerDiffScreenshots(t *testing.T) {
+	s := &mockService{}
+	url := uuid.New().String()
+	res := diff.Result{Width: 2, Height: 1, ChangedPixels: 1, TotalPixels: 2, ChangedRatio: 0.5,
+		Regions: []diff.Region{{X: 1, Y: 0, Width: 1, Height: 1}}, Image: image.NewRGBA(image.Rect(0, 0, 2, 1))}
+	s.On("DiffScreenshots", mock.Anything, url, "", 1, 3, diff.Options{Tolerance: 10}).Return(res, nil)
+	h := NewHTTPHandler(s, "address")
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf(`%s?url=%s&from=1&to=3&tolerance=10&format=json`, ScreenshotDiffPath, url), nil)
+	resp := httptest.NewRecorder()
+	require.NoError(t, h.diffScreenshots(h.server.NewContext(req, resp)))
+	require.Equal(t, http.StatusOK, resp.Code)
+	var actual diff.Result
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &actual))
+	res.Image = nil
+	require.Equal(t, res, actual)
+
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf(`%s?url=%s&from=1&to=3&tolerance=10`, ScreenshotDiffPath, url), nil)
+	resp = httptest.NewRecorder()
+	require.NoError(t, h.diffScreenshots(h.server.NewContext(req, resp)))
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, "image/png", resp.Header().Get(echo.HeaderContentType))
+	img, err := png.Decode(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, image.Rect(0, 0, 2, 1), img.Bounds())
+	s.AssertExpectations(t)
+
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf(`%s?url=%s&from=1`, ScreenshotDiffPath, url), nil)
+	resp = httptest.NewRecorder()
+	require.NoError(t, h.diffScreenshots(h.server.NewContext(req, resp)))
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
 func TestHTTPHandlerMakeShots(t *testing.T) {
 	s := &mockService{}
 	urls := []string{uuid.New().String(), uuid.New().String()}
+	opt := capture.ShotOptions{Format: capture.FormatPNG, FullPage: capture.Bool(true)}
+	reqs := []capture.ShotRequest{{URL: urls[0], ShotOptions: opt}, {URL: urls[1], ShotOptions: opt}}
 	response := []ResponseItem{{URL: urls[0], Success: true}, {URL: urls[1], Error: "some error"}}
-	s.On("MakeShots", mock.Anything, urls).Return(response)
+	s.On("MakeShots", mock.Anything, reqs).Return(response)
 
 	h := NewHTTPHandler(s, "address")
-	data, err := json.Marshal(MakeShotsRequest{URLs: urls})
+	data, err := json.Marshal(NewMakeShotsRequest(urls, opt))
 	require.NoError(t, err)
 	req := httptest.NewRequest(http.MethodPost, ScreenshotPath, bytes.NewReader(data))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
@@ -91,3 +225,276 @@ func TestHTTPHandlerMakeShots(t *testing.T) {
 	require.Equal(t, response, actualResponse)
 	s.AssertExpectations(t)
 }
+
+func TestMakeShotsRequestMixedItems(t *testing.T) {
+	body := `{"urls": ["http://a.com", {"url": "http://b.com", "format": "png", "viewport_width": 375, "viewport_height": 812}, "http://a.com"], "quality": 60}`
+	var req MakeShotsRequest
+	require.NoError(t, json.Unmarshal([]byte(body), &req))
+	reqs, err := req.getUniqueShotRequests()
+	require.NoError(t, err)
+	require.Equal(t, []capture.ShotRequest{
+		{URL: "http://a.com", ShotOptions: capture.ShotOptions{Quality: 60}},
+		{URL: "http://b.com", ShotOptions: capture.ShotOptions{Format: capture.FormatPNG, Quality: 60, ViewportWidth: 375, ViewportHeight: 812}},
+	}, reqs)
+}
+
+func TestMakeShotsRequestPriority(t *testing.T) {
+	req := MakeShotsRequest{URLs: []ShotItem{{URL: "http://a.com"}}, Priority: capture.PriorityBulk}
+	reqs, err := req.getUniqueShotRequests()
+	require.NoError(t, err)
+	require.Equal(t, []capture.ShotRequest{{URL: "http://a.com", Priority: capture.PriorityBulk}}, reqs)
+	req.Priority = "urgent"
+	_, err = req.getUniqueShotRequests()
+	require.Error(t, err)
+}
+
+func TestHTTPHandlerMakeShotsInvalidOptions(t *testing.T) {
+	h := NewHTTPHandler(&mockService{}, "address")
+	req := httptest.NewRequest(http.MethodPost, ScreenshotPath, strings.NewReader(`{"urls": [{"url": "http://a.com", "format": "gif"}]}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	resp := httptest.NewRecorder()
+	ctx := h.server.NewContext(req, resp)
+	require.NoError(t, h.makeShots(ctx))
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func TestHTTPHandlerGetDevices(t *testing.T) {
+	h := NewHTTPHandler(&mockService{}, "address")
+	req := httptest.NewRequest(http.MethodGet, DevicesPath, nil)
+	resp := httptest.NewRecorder()
+	ctx := h.server.NewContext(req, resp)
+	require.NoError(t, h.getDevices(ctx))
+	require.Equal(t, http.StatusOK, resp.Code)
+	var devices []capture.Device
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &devices))
+	require.Equal(t, capture.ListDevices(), devices)
+}
+
+func TestHTTPHandlerGetChromeStats(t *testing.T) {
+	s := &mockService{}
+	stats := []capture.WorkerStats{{Worker: "worker-1", Endpoints: []capture.EndpointStats{{Address: "localhost:9222", Healthy: true, InFlight: 2}}}}
+	s.On("GetChromeStats", mock.Anything).Return(stats, nil)
+	h := NewHTTPHandler(s, "address")
+	req := httptest.NewRequest(http.MethodGet, ChromeStatsPath, nil)
+	resp := httptest.NewRecorder()
+	require.NoError(t, h.getChromeStats(h.server.NewContext(req, resp)))
+	require.Equal(t, http.StatusOK, resp.Code)
+	var actual []capture.WorkerStats
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &actual))
+	require.Equal(t, stats, actual)
+	s.AssertExpectations(t)
+}
+
+func TestHTTPHandlerCreateJob(t *testing.T) {
+	s := &mockService{}
+	urls := []string{uuid.New().String(), uuid.New().String()}
+	reqs := []capture.ShotRequest{{URL: urls[0]}, {URL: urls[1]}}
+	job := store.Job{ID: uuid.New().String(), State: store.JobStateQueued, Items: []store.JobItem{
+		{ID: uuid.New().String(), URL: urls[0], State: store.JobStateQueued},
+		{ID: uuid.New().String(), URL: urls[1], State: store.JobStateQueued},
+	}}
+	s.On("CreateJob", mock.Anything, reqs).Return(job, nil)
+
+	h := NewHTTPHandler(s, "address")
+	data, err := json.Marshal(NewMakeShotsRequest(urls, capture.ShotOptions{}))
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, JobsPath, bytes.NewReader(data))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	resp := httptest.NewRecorder()
+	ctx := h.server.NewContext(req, resp)
+	require.NoError(t, h.createJob(ctx))
+	require.Equal(t, http.StatusAccepted, resp.Code)
+	var actualResponse store.Job
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &actualResponse))
+	require.Equal(t, job, actualResponse)
+	s.AssertExpectations(t)
+}
+
+func TestHTTPHandlerGetJob(t *testing.T) {
+	s := &mockService{}
+	job := store.Job{ID: uuid.New().String(), State: store.JobStateSucceeded, Items: []store.JobItem{
+		{ID: uuid.New().String(), URL: uuid.New().String(), State: store.JobStateSucceeded, Version: 3},
+	}}
+	s.On("GetJob", mock.Anything, job.ID).Return(job, nil)
+	missingID := uuid.New().String()
+	s.On("GetJob", mock.Anything, missingID).Return(store.Job{}, fmt.Errorf(`failed to get job: [error: %w]`, store.ErrNotFound{}))
+
+	h := NewHTTPHandler(s, "address")
+	req := httptest.NewRequest(http.MethodGet, JobsPath+"/"+job.ID, nil)
+	resp := httptest.NewRecorder()
+	ctx := h.server.NewContext(req, resp)
+	ctx.SetParamNames("id")
+	ctx.SetParamValues(job.ID)
+	require.NoError(t, h.getJob(ctx))
+	require.Equal(t, http.StatusOK, resp.Code)
+	var actualResponse store.Job
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &actualResponse))
+	require.Equal(t, job, actualResponse)
+
+	req = httptest.NewRequest(http.MethodGet, JobsPath+"/"+missingID, nil)
+	resp = httptest.NewRecorder()
+	ctx = h.server.NewContext(req, resp)
+	ctx.SetParamNames("id")
+	ctx.SetParamValues(missingID)
+	require.NoError(t, h.getJob(ctx))
+	require.Equal(t, http.StatusNotFound, resp.Code)
+	s.AssertExpectations(t)
+}
+
+func TestHTTPHandlerListWebhookDeliveries(t *testing.T) {
+	s := &mockService{}
+	list := []store.WebhookDelivery{{ID: uuid.New().String(), CallbackURL: "http://" + uuid.New().String(), Payload: "{}", Attempts: []store.WebhookAttempt{{StatusCode: 500}}}}
+	s.On("ListWebhookDeliveries", mock.Anything, true, 10).Return(list, nil)
+	h := NewHTTPHandler(s, "address")
+	req := httptest.NewRequest(http.MethodGet, WebhookDeliveriesPath+"?failed=true&limit=10", nil)
+	resp := httptest.NewRecorder()
+	ctx := h.server.NewContext(req, resp)
+	require.NoError(t, h.listWebhookDeliveries(ctx))
+	require.Equal(t, http.StatusOK, resp.Code)
+	var actualResponse []store.WebhookDelivery
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &actualResponse))
+	require.Equal(t, list, actualResponse)
+
+	req = httptest.NewRequest(http.MethodGet, WebhookDeliveriesPath+"?limit=-1", nil)
+	resp = httptest.NewRecorder()
+	ctx = h.server.NewContext(req, resp)
+	require.NoError(t, h.listWebhookDeliveries(ctx))
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+	s.AssertExpectations(t)
+}
+
+func TestHTTPHandlerReplayWebhookDelivery(t *testing.T) {
+	s := &mockService{}
+	d := store.WebhookDelivery{ID: uuid.New().String(), Delivered: true}
+	s.On("ReplayWebhookDelivery", mock.Anything, d.ID).Return(d, nil)
+	h := NewHTTPHandler(s, "address")
+	req := httptest.NewRequest(http.MethodPost, WebhookDeliveriesPath+"/"+d.ID+"/replay", nil)
+	resp := httptest.NewRecorder()
+	ctx := h.server.NewContext(req, resp)
+	ctx.SetParamNames("id")
+	ctx.SetParamValues(d.ID)
+	require.NoError(t, h.replayWebhookDelivery(ctx))
+	require.Equal(t, http.StatusOK, resp.Code)
+	var actualResponse store.WebhookDelivery
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &actualResponse))
+	require.Equal(t, d, actualResponse)
+	s.AssertExpectations(t)
+}
+
+func TestHTTPHandlerStopDrainsInFlightRequests(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	s := &mockService{}
+	s.On("MakeShots", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		close(started)
+		<-release
+	}).Return([]ResponseItem{})
+	h := NewHTTPHandler(s, "address")
+	post := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, ScreenshotPath, strings.NewReader(`{"urls": ["http://a.com"]}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		resp := httptest.NewRecorder()
+		h.server.ServeHTTP(resp, req)
+		return resp
+	}
+	health := func() int {
+		resp := httptest.NewRecorder()
+		h.server.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, HealthPath, nil))
+		return resp.Code
+	}
+	require.Equal(t, http.StatusOK, health())
+
+	inFlight := make(chan *httptest.ResponseRecorder)
+	go func() {
+		inFlight <- post()
+	}()
+	<-started
+	stopped := make(chan error)
+	go func() {
+		stopped <- h.drain.drain(context.Background())
+	}()
+	for !h.drain.isDraining() {
+		<-time.After(time.Millisecond)
+	}
+	require.Equal(t, http.StatusServiceUnavailable, post().Code)
+	require.Equal(t, http.StatusServiceUnavailable, health())
+	for _, method := range []string{http.MethodPut, http.MethodDelete, http.MethodPatch} {
+		resp := httptest.NewRecorder()
+		h.server.ServeHTTP(resp, httptest.NewRequest(method, SchedulesPath+"/"+uuid.New().String(), nil))
+		require.Equal(t, http.StatusServiceUnavailable, resp.Code, method)
+	}
+
+	close(release)
+	require.Equal(t, http.StatusOK, (<-inFlight).Code)
+	require.NoError(t, <-stopped)
+}
+
+func TestHTTPHandlerListFailedRequests(t *testing.T) {
+	s := &mockService{}
+	list := []store.FailedRequest{{ID: uuid.New().String(), URL: "http://a.com", State: store.FailedRequestStateFailed}}
+	s.On("ListFailedRequests", mock.Anything, store.FailedRequestStateFailed, 5).Return(list, nil)
+	h := NewHTTPHandler(s, "address")
+	req := httptest.NewRequest(http.MethodGet, FailedRequestsPath+"?state=failed&limit=5", nil)
+	resp := httptest.NewRecorder()
+	require.NoError(t, h.listFailedRequests(h.server.NewContext(req, resp)))
+	require.Equal(t, http.StatusOK, resp.Code)
+	var actual []store.FailedRequest
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &actual))
+	require.Equal(t, list, actual)
+
+	req = httptest.NewRequest(http.MethodGet, FailedRequestsPath+"?state=unknown", nil)
+	resp = httptest.NewRecorder()
+	require.NoError(t, h.listFailedRequests(h.server.NewContext(req, resp)))
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+	s.AssertExpectations(t)
+}
+
+func TestHTTPHandlerRequeueFailedRequests(t *testing.T) {
+	s := &mockService{}
+	ids := []string{uuid.New().String(), uuid.New().String()}
+	list := []store.FailedRequest{{ID: ids[0], State: store.FailedRequestStateRequeued}, {ID: ids[1], State: store.FailedRequestStateRequeued}}
+	s.On("RequeueFailedRequests", mock.Anything, ids).Return(list, nil)
+	missing := []string{uuid.New().String()}
+	s.On("RequeueFailedRequests", mock.Anything, missing).Return([]store.FailedRequest(nil), fmt.Errorf(`failed to get failed request: [error: %w]`, store.ErrNotFound{}))
+	h := NewHTTPHandler(s, "address")
+	requeue := func(ids []string) *httptest.ResponseRecorder {
+		data, err := json.Marshal(RequeueRequest{IDs: ids})
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, FailedRequestsPath+"/requeue", bytes.NewReader(data))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		resp := httptest.NewRecorder()
+		require.NoError(t, h.requeueFailedRequests(h.server.NewContext(req, resp)))
+		return resp
+	}
+	resp := requeue(ids)
+	require.Equal(t, http.StatusOK, resp.Code)
+	var actual []store.FailedRequest
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &actual))
+	require.Equal(t, list, actual)
+	require.Equal(t, http.StatusNotFound, requeue(missing).Code)
+	require.Equal(t, http.StatusBadRequest, requeue(nil).Code)
+	s.AssertExpectations(t)
+}
+
+func TestHTTPHandlerCreateSchedule(t *testing.T) {
+	s := &mockService{}
+	url := "http://" + uuid.New().String()
+	s.On("CreateSchedule", mock.Anything, mock.MatchedBy(func(sch store.Schedule) bool {
+		return sch.URL == url && sch.Cron == "0 6 * * *" && sch.Timezone == "Europe/Kiev" && sch.Enabled && sch.NextRunAt.After(time.Now())
+	})).Return(store.Schedule{ID: uuid.New().String(), URL: url}, nil)
+	h := NewHTTPHandler(s, "address")
+	create := func(req ScheduleRequest) *httptest.ResponseRecorder {
+		data, err := json.Marshal(req)
+		require.NoError(t, err)
+		httpReq := httptest.NewRequest(http.MethodPost, SchedulesPath, bytes.NewReader(data))
+		httpReq.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		resp := httptest.NewRecorder()
+		require.NoError(t, h.createSchedule(h.server.NewContext(httpReq, resp)))
+		return resp
+	}
+	require.Equal(t, http.StatusCreated, create(ScheduleRequest{URL: url, Cron: "0 6 * * *", Timezone: "Europe/Kiev"}).Code)
+	require.Equal(t, http.StatusBadRequest, create(ScheduleRequest{URL: url, Cron: "every day"}).Code)
+	require.Equal(t, http.StatusBadRequest, create(ScheduleRequest{URL: url, Cron: "@daily", Timezone: "Mars/Olympus"}).Code)
+	require.Equal(t, http.StatusBadRequest, create(ScheduleRequest{Cron: "@daily"}).Code)
+	s.AssertExpectations(t)
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/leveldorado/screenshot/capture"
+	"github.com/leveldorado/screenshot/queue"
+)
+
+type jobEventApplier interface {
+	ApplyJobEvent(ctx context.Context, e capture.JobEvent) error
+}
+
+type groupSubscriber interface {
+	GroupSubscribe(ctx context.Context, topic, group string) (<-chan queue.Message, error)
+}
+
+const subscriptionGroupAPI = "api"
+
+type JobEventsHandler struct {
+	s              jobEventApplier
+	q              groupSubscriber
+	requestTimeout time.Duration
+}
+
+func NewJobEventsHandler(s jobEventApplier, q groupSubscriber, requestTimeout time.Duration) *JobEventsHandler {
+	return &JobEventsHandler{s: s, q: q, requestTimeout: requestTimeout}
+}
+
+func (h *JobEventsHandler) Run(ctx context.Context) error {
+	sub, err := h.q.GroupSubscribe(ctx, capture.JobEventTopic, subscriptionGroupAPI)
+	if err != nil {
+		return fmt.Errorf(`failed to subscribe job event topic: [error: %w]`, err)
+	}
+	// events are applied one by one to keep state transitions in order
+	go func() {
+		for msg := range sub {
+			h.handleMessage(msg)
+		}
+	}()
+	return nil
+}
+
+func (h *JobEventsHandler) Stop(ctx context.Context) error {
+	return nil
+}
+
+func (h *JobEventsHandler) handleMessage(msg queue.Message) {
+	var e capture.JobEvent
+	if err := json.Unmarshal(msg.Data, &e); err != nil {
+		log.Println(fmt.Sprintf(`failed to unmarshal job event: [msg: %s, error: %s]`, msg.Data, err))
+		// malformed event fails the same way on every delivery
+		ackMessage(capture.JobEventTopic, msg)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), h.requestTimeout)
+	defer cancel()
+	if err := h.s.ApplyJobEvent(ctx, e); err != nil {
+		// event is left unacknowledged, so queue with redelivery delivers it again
+		log.Println(fmt.Sprintf(`failed to apply job event: [error: %s]`, err))
+		return
+	}
+	ackMessage(capture.JobEventTopic, msg)
+}
+
+func ackMessage(topic string, msg queue.Message) {
+	if err := msg.Ack(); err != nil {
+		log.Println(fmt.Sprintf(`failed to ack message: [topic: %s, error: %s]`, topic, err))
+	}
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/leveldorado/screenshot/capture"
+	"github.com/leveldorado/screenshot/queue"
+	"github.com/leveldorado/screenshot/store"
+)
+
+type mockJobEventApplier struct {
+	mock.Mock
+}
+
+func (m *mockJobEventApplier) ApplyJobEvent(ctx context.Context, e capture.JobEvent) error {
+	return m.Called(ctx, e).Error(0)
+}
+
+type mockGroupSubscriber struct {
+	mock.Mock
+}
+
+func (m *mockGroupSubscriber) GroupSubscribe(ctx context.Context, topic, group string) (<-chan queue.Message, error) {
+	args := m.Called(ctx, topic, group)
+	return args.Get(0).(chan queue.Message), args.Error(1)
+}
+
+func TestJobEventsHandler_Run(t *testing.T) {
+	e := capture.JobEvent{JobID: uuid.New().String(), JobItemID: uuid.New().String(), State: store.JobStateRunning}
+	s := &mockJobEventApplier{}
+	s.On("ApplyJobEvent", mock.Anything, e).Return(nil)
+	msgChan := make(chan queue.Message)
+	q := &mockGroupSubscriber{}
+	q.On("GroupSubscribe", mock.Anything, capture.JobEventTopic, subscriptionGroupAPI).Return(msgChan, nil)
+	h := NewJobEventsHandler(s, q, time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, h.Run(ctx))
+	data, err := json.Marshal(e)
+	require.NoError(t, err)
+	msgChan <- queue.Message{Data: data}
+	<-time.After(10 * time.Millisecond)
+	s.AssertExpectations(t)
+	q.AssertExpectations(t)
+}
+
+const testRedisAddressEnvVariable = "SCREENSHOT_TEST_REDIS"
+
+func TestJobEventsHandler_RunRedis(t *testing.T) {
+	address := os.Getenv(testRedisAddressEnvVariable)
+	q, err := queue.NewRedis(address, 10, time.Second, queue.RedisConfig{KeyPrefix: uuid.New().String() + ":", ClaimIdle: 200 * time.Millisecond})
+	require.NoError(t, err)
+	e := capture.JobEvent{JobID: uuid.New().String(), JobItemID: uuid.New().String(), State: store.JobStateRunning}
+	var mu sync.Mutex
+	applied := 0
+	s := &mockJobEventApplier{}
+	// failed event is claimed again after claim idle, applied one is acknowledged and never redelivered
+	s.On("ApplyJobEvent", mock.Anything, e).Return(errors.New("store is unavailable")).Once().Run(func(mock.Arguments) {
+		mu.Lock()
+		applied++
+		mu.Unlock()
+	})
+	s.On("ApplyJobEvent", mock.Anything, e).Return(nil).Run(func(mock.Arguments) {
+		mu.Lock()
+		applied++
+		mu.Unlock()
+	})
+	h := NewJobEventsHandler(s, q, time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, h.Run(ctx))
+	require.NoError(t, q.Publish(ctx, capture.JobEventTopic, "", e))
+	<-time.After(5 * time.Second)
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, 2, applied)
+}
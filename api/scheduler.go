@@ -0,0 +1,168 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/leveldorado/screenshot/capture"
+	"github.com/leveldorado/screenshot/store"
+)
+
+type SchedulerConfig struct {
+	// how often leader looks for due schedules
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// leader renews lease on every poll. when it is gone other api instance takes over after lease expires
+	Lease time.Duration `yaml:"lease"`
+	// schedules fired at most per poll
+	BatchSize int `yaml:"batch_size"`
+}
+
+const (
+	defaultSchedulerPollInterval = 10 * time.Second
+	defaultSchedulerLease        = 30 * time.Second
+	defaultSchedulerBatchSize    = 100
+	schedulerLeaseName           = "scheduler"
+)
+
+func (c SchedulerConfig) withDefaults() SchedulerConfig {
+	if c.PollInterval <= 0 {
+		c.PollInterval = defaultSchedulerPollInterval
+	}
+	if c.Lease <= 0 {
+		c.Lease = defaultSchedulerLease
+	}
+	// lease must survive until the next poll renews it
+	if c.Lease <= c.PollInterval {
+		c.Lease = 3 * c.PollInterval
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = defaultSchedulerBatchSize
+	}
+	return c
+}
+
+type dueSchedules interface {
+	Due(ctx context.Context, now time.Time, limit int) ([]store.Schedule, error)
+	MarkRun(ctx context.Context, id string, runAt, lastRunAt, nextRunAt time.Time) (bool, error)
+}
+
+type leaseHolder interface {
+	Acquire(ctx context.Context, name, holder string, ttl time.Duration) (bool, error)
+	Release(ctx context.Context, name, holder string) error
+}
+
+type publisher interface {
+	Publish(ctx context.Context, topic, reply string, data interface{}) error
+}
+
+// Scheduler publishes shot requests of due schedules. every api instance runs it, but only the one holding scheduler
+// lease fires schedules
+type Scheduler struct {
+	st     dueSchedules
+	ls     leaseHolder
+	q      publisher
+	cfg    SchedulerConfig
+	holder string
+	stop   context.CancelFunc
+	done   chan struct{}
+}
+
+func NewScheduler(st dueSchedules, ls leaseHolder, q publisher, cfg SchedulerConfig) *Scheduler {
+	return &Scheduler{st: st, ls: ls, q: q, cfg: cfg.withDefaults(), holder: uuid.New().String(), done: make(chan struct{})}
+}
+
+func (s *Scheduler) Run(ctx context.Context) error {
+	ctx, s.stop = context.WithCancel(ctx)
+	go s.loop(ctx)
+	return nil
+}
+
+// Stop waits for current poll and releases lease, so other instance takes over without waiting for expiration
+func (s *Scheduler) Stop(ctx context.Context) error {
+	if s.stop == nil {
+		return nil
+	}
+	s.stop()
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+		return fmt.Errorf(`timeout waiting for scheduler to stop: [error: %w]`, ctx.Err())
+	}
+	if err := s.ls.Release(ctx, schedulerLeaseName, s.holder); err != nil {
+		return fmt.Errorf(`failed to release scheduler lease: [error: %w]`, err)
+	}
+	return nil
+}
+
+func (s *Scheduler) loop(ctx context.Context) {
+	defer close(s.done)
+	ticker := time.NewTicker(s.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		s.poll(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *Scheduler) poll(ctx context.Context) {
+	leader, err := s.ls.Acquire(ctx, schedulerLeaseName, s.holder, s.cfg.Lease)
+	if err != nil {
+		log.Println(fmt.Sprintf(`failed to acquire scheduler lease: [holder: %s, error: %s]`, s.holder, err))
+		return
+	}
+	if !leader {
+		return
+	}
+	now := time.Now().UTC()
+	list, err := s.st.Due(ctx, now, s.cfg.BatchSize)
+	if err != nil {
+		log.Println(fmt.Sprintf(`failed to list due schedules: [error: %s]`, err))
+		return
+	}
+	for _, sch := range list {
+		if err = s.fire(ctx, sch, now); err != nil {
+			log.Println(fmt.Sprintf(`failed to fire schedule: [id: %s, url: %s, error: %s]`, sch.ID, sch.URL, err))
+		}
+	}
+}
+
+// fire moves schedule to its next run before request is published, so leaders overlapping during failover can not
+// publish the same run twice. run is moved back when request could not be published, so the next poll fires it again.
+// runs missed while no leader was alive are fired once. request is published without reply, with core nats driver it
+// is lost when no capture instance is subscribed at that moment, jetstream or redis driver keeps it until one is
+func (s *Scheduler) fire(ctx context.Context, sch store.Schedule, now time.Time) error {
+	var req capture.ShotRequest
+	if err := json.Unmarshal([]byte(sch.Request), &req); err != nil {
+		return fmt.Errorf(`failed to unmarshal shot request: [request: %s, error: %w]`, sch.Request, err)
+	}
+	next, err := nextScheduleRun(sch.Cron, sch.Timezone, now)
+	if err != nil {
+		return err
+	}
+	marked, err := s.st.MarkRun(ctx, sch.ID, sch.NextRunAt, now, next)
+	if err != nil {
+		return err
+	}
+	if !marked {
+		// schedule was updated, disabled or fired by other leader meanwhile
+		return nil
+	}
+	req.ScheduleID = sch.ID
+	if err = s.q.Publish(ctx, req.Priority.Topic(), "", req); err != nil {
+		// condition on the new next run leaves schedule alone when it was updated meanwhile
+		if _, revertErr := s.st.MarkRun(ctx, sch.ID, next, sch.LastRunAt, sch.NextRunAt); revertErr != nil {
+			log.Println(fmt.Sprintf(`failed to move schedule back to missed run: [id: %s, run_at: %s, error: %s]`, sch.ID, sch.NextRunAt, revertErr))
+		}
+		return fmt.Errorf(`failed to publish shot request: [topic: %s, error: %w]`, req.Priority.Topic(), err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/leveldorado/screenshot/capture"
+	"github.com/leveldorado/screenshot/store"
+)
+
+type mockDueSchedules struct {
+	mock.Mock
+}
+
+func (m *mockDueSchedules) Due(ctx context.Context, now time.Time, limit int) ([]store.Schedule, error) {
+	args := m.Called(ctx, now, limit)
+	return args.Get(0).([]store.Schedule), args.Error(1)
+}
+
+func (m *mockDueSchedules) MarkRun(ctx context.Context, id string, runAt, lastRunAt, nextRunAt time.Time) (bool, error) {
+	args := m.Called(ctx, id, runAt, lastRunAt, nextRunAt)
+	return args.Bool(0), args.Error(1)
+}
+
+type mockLeaseHolder struct {
+	mock.Mock
+}
+
+func (m *mockLeaseHolder) Acquire(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	args := m.Called(ctx, name, holder, ttl)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *mockLeaseHolder) Release(ctx context.Context, name, holder string) error {
+	return m.Called(ctx, name, holder).Error(0)
+}
+
+func TestNextScheduleRun(t *testing.T) {
+	after := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	next, err := nextScheduleRun("0 6 * * *", "Europe/Kiev", after)
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2020, 3, 2, 4, 0, 0, 0, time.UTC), next)
+	next, err = nextScheduleRun("@hourly", "", after)
+	require.NoError(t, err)
+	require.Equal(t, after.Add(time.Hour), next)
+	_, err = nextScheduleRun("0 6 30 2 *", "", after)
+	require.Error(t, err)
+}
+
+func TestScheduler_Poll(t *testing.T) {
+	st := &mockDueSchedules{}
+	ls := &mockLeaseHolder{}
+	q := &mockSubscriberPublisher{}
+	runAt := time.Now().UTC().Truncate(time.Minute)
+	sch := store.Schedule{ID: uuid.New().String(), URL: "http://a.com", Request: `{"url":"http://a.com","priority":"bulk","format":"png"}`, Cron: "@hourly", Enabled: true, NextRunAt: runAt}
+	s := NewScheduler(st, ls, q, SchedulerConfig{})
+	ls.On("Acquire", mock.Anything, schedulerLeaseName, s.holder, defaultSchedulerLease).Return(true, nil)
+	st.On("Due", mock.Anything, mock.Anything, defaultSchedulerBatchSize).Return([]store.Schedule{sch}, nil)
+	st.On("MarkRun", mock.Anything, sch.ID, runAt, mock.Anything, mock.MatchedBy(func(next time.Time) bool {
+		return next.After(runAt) && next.Minute() == 0
+	})).Return(true, nil)
+	expected := capture.ShotRequest{URL: "http://a.com", Priority: capture.PriorityBulk, ScheduleID: sch.ID, ShotOptions: capture.ShotOptions{Format: capture.FormatPNG}}
+	q.On("Publish", mock.Anything, capture.PriorityBulk.Topic(), "", expected).Return(nil)
+	s.poll(context.Background())
+	st.AssertExpectations(t)
+	q.AssertExpectations(t)
+
+	// instance which does not hold lease fires nothing
+	follower := NewScheduler(st, ls, q, SchedulerConfig{})
+	ls.On("Acquire", mock.Anything, schedulerLeaseName, follower.holder, defaultSchedulerLease).Return(false, nil)
+	follower.poll(context.Background())
+	st.AssertNumberOfCalls(t, "Due", 1)
+}
+
+func TestScheduler_FireRevertsRunWhenPublishFails(t *testing.T) {
+	st := &mockDueSchedules{}
+	q := &mockSubscriberPublisher{}
+	now := time.Now().UTC()
+	runAt := now.Truncate(time.Minute)
+	lastRunAt := runAt.Add(-time.Hour)
+	sch := store.Schedule{ID: uuid.New().String(), URL: "http://a.com", Request: `{"url":"http://a.com"}`, Cron: "@hourly", Enabled: true, LastRunAt: lastRunAt, NextRunAt: runAt}
+	next, err := nextScheduleRun(sch.Cron, sch.Timezone, now)
+	require.NoError(t, err)
+	st.On("MarkRun", mock.Anything, sch.ID, runAt, now, next).Return(true, nil).Once()
+	st.On("MarkRun", mock.Anything, sch.ID, next, lastRunAt, runAt).Return(true, nil).Once()
+	q.On("Publish", mock.Anything, capture.ShotRequestTopic, "", mock.Anything).Return(errors.New("no responders"))
+	s := NewScheduler(st, &mockLeaseHolder{}, q, SchedulerConfig{})
+	require.Error(t, s.fire(context.Background(), sch, now))
+	st.AssertExpectations(t)
+}
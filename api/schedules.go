@@ -0,0 +1,118 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/leveldorado/screenshot/capture"
+	"github.com/leveldorado/screenshot/store"
+)
+
+type scheduleRepo interface {
+	Create(ctx context.Context, s *store.Schedule) error
+	Get(ctx context.Context, id string) (store.Schedule, error)
+	List(ctx context.Context, limit int) ([]store.Schedule, error)
+	Update(ctx context.Context, s *store.Schedule) error
+	Delete(ctx context.Context, id string) error
+}
+
+// ScheduleRequest creates or replaces schedule which captures url every time cron expression fires
+type ScheduleRequest struct {
+	URL         string `json:"url"`
+	CallbackURL string `json:"callback_url,omitempty"`
+	// standard five field expression, e.g. "0 6 * * *", or descriptor, e.g. "@daily"
+	Cron string `json:"cron"`
+	// IANA time zone cron expression is evaluated in, e.g. "Europe/Kiev". UTC when empty
+	Timezone string `json:"timezone,omitempty"`
+	// schedule is enabled when omitted
+	Enabled  *bool            `json:"enabled,omitempty"`
+	Priority capture.Priority `json:"priority,omitempty"`
+	capture.ShotOptions
+}
+
+// schedule validates request and returns schedule due at the first time cron expression fires after now
+func (req ScheduleRequest) schedule(now time.Time) (store.Schedule, error) {
+	if req.URL == "" {
+		return store.Schedule{}, errors.New("url can not be empty")
+	}
+	if err := req.Priority.Validate(); err != nil {
+		return store.Schedule{}, err
+	}
+	shotReq := capture.ShotRequest{URL: req.URL, CallbackURL: req.CallbackURL, Priority: req.Priority, ShotOptions: req.ShotOptions}
+	if err := shotReq.Validate(); err != nil {
+		return store.Schedule{}, fmt.Errorf(`invalid options: [url: %s, error: %w]`, req.URL, err)
+	}
+	if err := validateCallbackURL(req.CallbackURL); err != nil {
+		return store.Schedule{}, err
+	}
+	next, err := nextScheduleRun(req.Cron, req.Timezone, now)
+	if err != nil {
+		return store.Schedule{}, err
+	}
+	data, err := json.Marshal(shotReq)
+	if err != nil {
+		return store.Schedule{}, fmt.Errorf(`failed to marshal shot request: [url: %s, error: %w]`, req.URL, err)
+	}
+	enabled := req.Enabled == nil || *req.Enabled
+	return store.Schedule{URL: req.URL, Request: string(data), Cron: req.Cron, Timezone: req.Timezone, Enabled: enabled, NextRunAt: next}, nil
+}
+
+// nextScheduleRun returns the first time after given one when cron expression fires in timezone
+func nextScheduleRun(expr, timezone string, after time.Time) (time.Time, error) {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf(`invalid timezone: [timezone: %s, error: %w]`, timezone, err)
+	}
+	sched, err := cron.ParseStandard(expr)
+	if err != nil {
+		return time.Time{}, fmt.Errorf(`invalid cron expression: [cron: %s, error: %w]`, expr, err)
+	}
+	next := sched.Next(after.In(loc))
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf(`invalid cron expression: [cron: %s, error: it never fires]`, expr)
+	}
+	return next.UTC(), nil
+}
+
+func (s *DefaultService) CreateSchedule(ctx context.Context, sch store.Schedule) (store.Schedule, error) {
+	if err := s.sr.Create(ctx, &sch); err != nil {
+		return store.Schedule{}, fmt.Errorf(`failed to create schedule: [url: %s, error: %w]`, sch.URL, err)
+	}
+	return sch, nil
+}
+
+func (s *DefaultService) GetSchedule(ctx context.Context, id string) (store.Schedule, error) {
+	sch, err := s.sr.Get(ctx, id)
+	if err != nil {
+		return store.Schedule{}, fmt.Errorf(`failed to get schedule: [id: %s, error: %w]`, id, err)
+	}
+	return sch, nil
+}
+
+func (s *DefaultService) ListSchedules(ctx context.Context, limit int) ([]store.Schedule, error) {
+	list, err := s.sr.List(ctx, limit)
+	if err != nil {
+		return nil, fmt.Errorf(`failed to list schedules: [limit: %d, error: %w]`, limit, err)
+	}
+	return list, nil
+}
+
+// UpdateSchedule replaces schedule. its next run is computed from new cron expression, so pending run is skipped
+func (s *DefaultService) UpdateSchedule(ctx context.Context, sch store.Schedule) (store.Schedule, error) {
+	if err := s.sr.Update(ctx, &sch); err != nil {
+		return store.Schedule{}, fmt.Errorf(`failed to update schedule: [id: %s, error: %w]`, sch.ID, err)
+	}
+	return s.GetSchedule(ctx, sch.ID)
+}
+
+func (s *DefaultService) DeleteSchedule(ctx context.Context, id string) error {
+	if err := s.sr.Delete(ctx, id); err != nil {
+		return fmt.Errorf(`failed to delete schedule: [id: %s, error: %w]`, id, err)
+	}
+	return nil
+}
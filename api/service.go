@@ -3,14 +3,19 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"image"
 	"io"
+	"log"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 
 	"github.com/leveldorado/screenshot/capture"
+	"github.com/leveldorado/screenshot/diff"
 
 	"github.com/leveldorado/screenshot/queue"
 	"github.com/leveldorado/screenshot/store"
@@ -20,9 +25,32 @@ type fileGetter interface {
 	Get(ctx context.Context, fileID string) (io.ReadCloser, error)
 }
 
+type urlPresigner interface {
+	PresignGet(ctx context.Context, fileID, contentType string) (string, error)
+}
+
 type metadataGetter interface {
-	Get(ctx context.Context, url string, version int) (store.Metadata, error)
-	GetAllVersions(ctx context.Context, url string) ([]store.Metadata, error)
+	Get(ctx context.Context, url, selector string, version int) (store.Metadata, error)
+	GetAllVersions(ctx context.Context, url, selector string) ([]store.Metadata, error)
+}
+
+type jobRepo interface {
+	Create(ctx context.Context, job *store.Job) error
+	Get(ctx context.Context, id string) (store.Job, error)
+	UpdateItem(ctx context.Context, jobID, itemID string, u store.JobItemUpdate) error
+}
+
+type webhookDeliveries interface {
+	Get(ctx context.Context, id string) (store.WebhookDelivery, error)
+	List(ctx context.Context, onlyFailed bool, limit int) ([]store.WebhookDelivery, error)
+	Replay(ctx context.Context, id string) (store.WebhookDelivery, error)
+}
+
+type failedRequestRepo interface {
+	Record(ctx context.Context, r store.FailedRequest) error
+	MarkRequeued(ctx context.Context, id string) error
+	Get(ctx context.Context, id string) (store.FailedRequest, error)
+	List(ctx context.Context, state store.FailedRequestState, limit int) ([]store.FailedRequest, error)
 }
 
 type subscriberPublisher interface {
@@ -33,14 +61,23 @@ type subscriberPublisher interface {
 type DefaultService struct {
 	fg               fileGetter
 	mg               metadataGetter
+	jr               jobRepo
+	wd               webhookDeliveries
+	fr               failedRequestRepo
+	sr               scheduleRepo
 	q                subscriberPublisher
 	waitReplyTimeout time.Duration
+	presigner        urlPresigner
 }
 
-func NewDefaultService(fg fileGetter, mg metadataGetter, q subscriberPublisher, waitReplyTimeout time.Duration) *DefaultService {
+func NewDefaultService(fg fileGetter, mg metadataGetter, jr jobRepo, wd webhookDeliveries, fr failedRequestRepo, sr scheduleRepo, q subscriberPublisher, waitReplyTimeout time.Duration) *DefaultService {
 	return &DefaultService{
 		fg:               fg,
 		mg:               mg,
+		jr:               jr,
+		wd:               wd,
+		fr:               fr,
+		sr:               sr,
 		q:                q,
 		waitReplyTimeout: waitReplyTimeout,
 	}
@@ -50,65 +87,162 @@ type ResponseItem struct {
 	URL     string `json:"url"`
 	Success bool   `json:"success"`
 	Error   string `json:"error,omitempty"`
+	// class of failure, e.g. robots_disallowed when url is disallowed by robots.txt of its host
+	ErrorCode capture.ErrorClass `json:"error_code,omitempty"`
+	Attempts  int                `json:"attempts,omitempty"`
 }
 
-func (s *DefaultService) MakeShots(ctx context.Context, urls []string) []ResponseItem {
-	responsesChan := make(chan ResponseItem, len(urls))
-	for _, u := range urls {
-		go s.makeShot(ctx, u, responsesChan)
+func (s *DefaultService) MakeShots(ctx context.Context, reqs []capture.ShotRequest) []ResponseItem {
+	responsesChan := make(chan ResponseItem, len(reqs))
+	for _, req := range reqs {
+		go s.makeShot(ctx, req, responsesChan)
 	}
 	var responses []ResponseItem
-	for i := 0; i < len(urls); i++ {
+	for i := 0; i < len(reqs); i++ {
 		responses = append(responses, <-responsesChan)
 	}
 	return responses
 }
 
-func (s *DefaultService) makeShot(ctx context.Context, url string, respChan chan<- ResponseItem) {
-	req := capture.ShotRequest{URL: url}
+func (s *DefaultService) makeShot(ctx context.Context, req capture.ShotRequest, respChan chan<- ResponseItem) {
+	url := req.URL
 	reply := uuid.New().String()
-	if err := s.q.Publish(ctx, capture.ShotRequestTopic, reply, req); err != nil {
-		respChan <- ResponseItem{URL: url, Error: fmt.Sprintf(`failed to publish shot request: [req: %+v, error: %s]`, req, err)}
-		return
-	}
 	ctx, cancel := context.WithTimeout(ctx, s.waitReplyTimeout)
+	defer cancel()
+	// subscribe before publish so reply can not arrive before subscription exists
 	sub, err := s.q.Subscribe(ctx, reply)
 	if err != nil {
 		respChan <- ResponseItem{URL: url, Error: fmt.Sprintf(`failed to subscribe shot response: [reply: %s, error: %s]`, reply, err)}
 		return
 	}
+	if err := s.q.Publish(ctx, req.Priority.Topic(), reply, req); err != nil {
+		respChan <- ResponseItem{URL: url, Error: fmt.Sprintf(`failed to publish shot request: [req: %+v, error: %s]`, req, err)}
+		return
+	}
 	msg := <-sub
 	//empty message means channel has been closed
 	if len(msg.Data) == 0 {
 		respChan <- ResponseItem{URL: url, Error: `failed to receive shot response`}
 		return
 	}
-	cancel()
 	var resp capture.ShotResponse
 	if err := json.Unmarshal(msg.Data, &resp); err != nil {
 		respChan <- ResponseItem{URL: url, Error: fmt.Sprintf(`failed to unmarshal shot response: [data: %s, error: %s]`, msg.Data, err)}
 		return
 	}
-	respChan <- ResponseItem{URL: url, Success: resp.Success, Error: resp.Error}
+	respChan <- ResponseItem{URL: url, Success: resp.Success, Error: resp.Error, ErrorCode: resp.ErrorCode, Attempts: resp.Attempts}
 }
 
-func (s *DefaultService) GetScreenshot(ctx context.Context, url string, version int) (file io.ReadCloser, contentType string, err error) {
-	var m store.Metadata
-	if version == 0 {
-		versions, err := s.mg.GetAllVersions(ctx, url)
-		if err != nil {
-			return nil, "", fmt.Errorf(`failed to get screen shot versions: [url: %s, error: %w]`, url, err)
+// chrome stats are broadcast to all capture workers and replies are collected during this period
+const chromeStatsCollectPeriod = time.Second
+
+func (s *DefaultService) GetChromeStats(ctx context.Context) ([]capture.WorkerStats, error) {
+	reply := uuid.New().String()
+	ctx, cancel := context.WithTimeout(ctx, chromeStatsCollectPeriod)
+	defer cancel()
+	sub, err := s.q.Subscribe(ctx, reply)
+	if err != nil {
+		return nil, fmt.Errorf(`failed to subscribe chrome stats response: [reply: %s, error: %w]`, reply, err)
+	}
+	if err = s.q.Publish(ctx, capture.ChromeStatsTopic, reply, struct{}{}); err != nil {
+		return nil, fmt.Errorf(`failed to publish chrome stats request: [error: %w]`, err)
+	}
+	list := []capture.WorkerStats{}
+	for {
+		select {
+		case msg, ok := <-sub:
+			if !ok {
+				return list, nil
+			}
+			var stats capture.WorkerStats
+			if err := json.Unmarshal(msg.Data, &stats); err != nil {
+				log.Println(fmt.Sprintf(`failed to unmarshal chrome stats: [data: %s, error: %s]`, msg.Data, err))
+				continue
+			}
+			list = append(list, stats)
+		case <-ctx.Done():
+			return list, nil
+		}
+	}
+}
+
+// CreateJob publishes job items without reply. with core nats driver item published while no capture instance is
+// subscribed is lost and stays queued, jetstream or redis driver keeps it until capture instance takes it
+func (s *DefaultService) CreateJob(ctx context.Context, reqs []capture.ShotRequest) (store.Job, error) {
+	job := store.Job{}
+	for _, req := range reqs {
+		job.Items = append(job.Items, store.JobItem{ID: uuid.New().String(), URL: req.URL})
+	}
+	if err := s.jr.Create(ctx, &job); err != nil {
+		return store.Job{}, fmt.Errorf(`failed to create job: [error: %w]`, err)
+	}
+	for i, req := range reqs {
+		req.JobID = job.ID
+		req.JobItemID = job.Items[i].ID
+		err := s.q.Publish(ctx, req.Priority.Topic(), "", req)
+		if err == nil {
+			continue
 		}
-		if len(versions) == 0 {
-			return nil, "", store.ErrNotFound{}
+		u := store.JobItemUpdate{State: store.JobStateFailed, Error: fmt.Sprintf(`failed to publish shot request: [req: %+v, error: %s]`, req, err)}
+		if err = s.jr.UpdateItem(ctx, job.ID, req.JobItemID, u); err != nil {
+			log.Println(fmt.Sprintf(`failed to mark job item as failed: [job_id: %s, item_id: %s, error: %s]`, job.ID, req.JobItemID, err))
 		}
-		sort.Sort(store.MetadataByVersionDesc(versions))
-		m = versions[0]
-	} else {
-		m, err = s.mg.Get(ctx, url, version)
+		job.Items[i].State = u.State
+		job.Items[i].Error = u.Error
+	}
+	job.State = job.ComputeState()
+	return job, nil
+}
+
+func (s *DefaultService) GetJob(ctx context.Context, id string) (store.Job, error) {
+	job, err := s.jr.Get(ctx, id)
+	if err != nil {
+		return store.Job{}, fmt.Errorf(`failed to get job: [id: %s, error: %w]`, id, err)
+	}
+	return job, nil
+}
+
+func (s *DefaultService) ApplyJobEvent(ctx context.Context, e capture.JobEvent) error {
+	u := store.JobItemUpdate{State: e.State, Error: e.Response.Error, ErrorCode: string(e.Response.ErrorCode)}
+	if e.Response.Success {
+		u.MetadataID = e.Response.Metadata.ID
+		u.Version = e.Response.Metadata.Version
+	}
+	if err := s.jr.UpdateItem(ctx, e.JobID, e.JobItemID, u); err != nil {
+		return fmt.Errorf(`failed to update job item: [event: %+v, error: %w]`, e, err)
+	}
+	return nil
+}
+
+// EnableRedirect makes GetScreenshotRedirect return presigned file url so clients download file directly from storage
+func (s *DefaultService) EnableRedirect(p urlPresigner) {
+	s.presigner = p
+}
+
+// getMetadata returns version of page shot or of element shot when selector is not empty. latest one when version is 0
+func (s *DefaultService) getMetadata(ctx context.Context, url, selector string, version int) (store.Metadata, error) {
+	if version != 0 {
+		m, err := s.mg.Get(ctx, url, selector, version)
 		if err != nil {
-			return nil, "", fmt.Errorf(`failed to get screenshot metadata: [url: %s, version: %d, error: %w]`, url, version, err)
+			return store.Metadata{}, fmt.Errorf(`failed to get screenshot metadata: [url: %s, selector: %s, version: %d, error: %w]`, url, selector, version, err)
 		}
+		return m, nil
+	}
+	versions, err := s.mg.GetAllVersions(ctx, url, selector)
+	if err != nil {
+		return store.Metadata{}, fmt.Errorf(`failed to get screen shot versions: [url: %s, selector: %s, error: %w]`, url, selector, err)
+	}
+	if len(versions) == 0 {
+		return store.Metadata{}, store.ErrNotFound{}
+	}
+	sort.Sort(store.MetadataByVersionDesc(versions))
+	return versions[0], nil
+}
+
+func (s *DefaultService) GetScreenshot(ctx context.Context, url, selector string, version int) (file io.ReadCloser, contentType string, err error) {
+	m, err := s.getMetadata(ctx, url, selector, version)
+	if err != nil {
+		return nil, "", err
 	}
 	file, err = s.fg.Get(ctx, m.FileID)
 	if err != nil {
@@ -117,11 +251,149 @@ func (s *DefaultService) GetScreenshot(ctx context.Context, url string, version
 	return file, m.GetContentType(), nil
 }
 
-func (s *DefaultService) GetScreenshotVersions(ctx context.Context, url string) ([]store.Metadata, error) {
-	versions, err := s.mg.GetAllVersions(ctx, url)
+// GetScreenshotRedirect returns empty location if redirect is not enabled
+func (s *DefaultService) GetScreenshotRedirect(ctx context.Context, url, selector string, version int) (string, error) {
+	if s.presigner == nil {
+		return "", nil
+	}
+	m, err := s.getMetadata(ctx, url, selector, version)
+	if err != nil {
+		return "", err
+	}
+	location, err := s.presigner.PresignGet(ctx, m.FileID, m.GetContentType())
 	if err != nil {
-		return nil, fmt.Errorf(`failed to get screen shot versions: [url: %s, error: %w]`, url, err)
+		return "", fmt.Errorf(`failed to presign file url: [file_id: %s, error: %w]`, m.FileID, err)
+	}
+	return location, nil
+}
+
+var ErrNotImage = errors.New("screenshot is not an image")
+
+func (s *DefaultService) getImage(ctx context.Context, url, selector string, version int) (image.Image, error) {
+	file, contentType, err := s.GetScreenshot(ctx, url, selector, version)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if !strings.HasPrefix(contentType, "image/") {
+		return nil, fmt.Errorf(`failed to diff screenshot: [url: %s, version: %d, content_type: %s, error: %w]`, url, version, contentType, ErrNotImage)
+	}
+	img, err := diff.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf(`failed to decode screenshot: [url: %s, version: %d, error: %w]`, url, version, err)
+	}
+	return img, nil
+}
+
+func (s *DefaultService) DiffScreenshots(ctx context.Context, url, selector string, from, to int, opt diff.Options) (diff.Result, error) {
+	fromImg, err := s.getImage(ctx, url, selector, from)
+	if err != nil {
+		return diff.Result{}, err
+	}
+	toImg, err := s.getImage(ctx, url, selector, to)
+	if err != nil {
+		return diff.Result{}, err
+	}
+	res, err := diff.Compare(fromImg, toImg, opt)
+	if err != nil {
+		return diff.Result{}, fmt.Errorf(`failed to compare screenshots: [url: %s, from: %d, to: %d, error: %w]`, url, from, to, err)
+	}
+	return res, nil
+}
+
+func (s *DefaultService) GetScreenshotVersions(ctx context.Context, url, selector string) ([]store.Metadata, error) {
+	versions, err := s.mg.GetAllVersions(ctx, url, selector)
+	if err != nil {
+		return nil, fmt.Errorf(`failed to get screen shot versions: [url: %s, selector: %s, error: %w]`, url, selector, err)
 	}
 	sort.Sort(store.MetadataByVersionDesc(versions))
 	return versions, nil
 }
+
+func (s *DefaultService) ListWebhookDeliveries(ctx context.Context, onlyFailed bool, limit int) ([]store.WebhookDelivery, error) {
+	list, err := s.wd.List(ctx, onlyFailed, limit)
+	if err != nil {
+		return nil, fmt.Errorf(`failed to list webhook deliveries: [only_failed: %t, limit: %d, error: %w]`, onlyFailed, limit, err)
+	}
+	return list, nil
+}
+
+func (s *DefaultService) GetWebhookDelivery(ctx context.Context, id string) (store.WebhookDelivery, error) {
+	d, err := s.wd.Get(ctx, id)
+	if err != nil {
+		return store.WebhookDelivery{}, fmt.Errorf(`failed to get webhook delivery: [id: %s, error: %w]`, id, err)
+	}
+	return d, nil
+}
+
+func (s *DefaultService) ReplayWebhookDelivery(ctx context.Context, id string) (store.WebhookDelivery, error) {
+	d, err := s.wd.Replay(ctx, id)
+	if err != nil {
+		return d, fmt.Errorf(`failed to replay webhook delivery: [id: %s, error: %w]`, id, err)
+	}
+	return d, nil
+}
+
+func (s *DefaultService) RecordDeadLetter(ctx context.Context, dl capture.DeadLetter) error {
+	// failed request id is not part of stored request so requeue sets it explicitly
+	req := dl.Request
+	req.FailedRequestID = ""
+	data, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf(`failed to marshal shot request: [req: %+v, error: %w]`, req, err)
+	}
+	r := store.FailedRequest{ID: dl.FailedRequestID, URL: req.URL, Request: string(data), Errors: dl.Errors}
+	if err = s.fr.Record(ctx, r); err != nil {
+		return fmt.Errorf(`failed to record failed request: [id: %s, error: %w]`, dl.FailedRequestID, err)
+	}
+	return nil
+}
+
+func (s *DefaultService) ListFailedRequests(ctx context.Context, state store.FailedRequestState, limit int) ([]store.FailedRequest, error) {
+	list, err := s.fr.List(ctx, state, limit)
+	if err != nil {
+		return nil, fmt.Errorf(`failed to list failed requests: [state: %s, limit: %d, error: %w]`, state, limit, err)
+	}
+	return list, nil
+}
+
+func (s *DefaultService) GetFailedRequest(ctx context.Context, id string) (store.FailedRequest, error) {
+	r, err := s.fr.Get(ctx, id)
+	if err != nil {
+		return store.FailedRequest{}, fmt.Errorf(`failed to get failed request: [id: %s, error: %w]`, id, err)
+	}
+	return r, nil
+}
+
+// RequeueFailedRequests publishes stored shot requests again. all ids are checked before anything is published. as
+// with jobs, core nats driver loses request published while no capture instance is subscribed
+func (s *DefaultService) RequeueFailedRequests(ctx context.Context, ids []string) ([]store.FailedRequest, error) {
+	var reqs []capture.ShotRequest
+	for _, id := range ids {
+		r, err := s.GetFailedRequest(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		var req capture.ShotRequest
+		if err = json.Unmarshal([]byte(r.Request), &req); err != nil {
+			return nil, fmt.Errorf(`failed to unmarshal failed shot request: [id: %s, error: %w]`, id, err)
+		}
+		req.FailedRequestID = r.ID
+		reqs = append(reqs, req)
+	}
+	list := []store.FailedRequest{}
+	for _, req := range reqs {
+		if err := s.q.Publish(ctx, req.Priority.Topic(), "", req); err != nil {
+			return list, fmt.Errorf(`failed to publish shot request: [id: %s, error: %w]`, req.FailedRequestID, err)
+		}
+		if err := s.fr.MarkRequeued(ctx, req.FailedRequestID); err != nil {
+			return list, fmt.Errorf(`failed to mark request as requeued: [id: %s, error: %w]`, req.FailedRequestID, err)
+		}
+		r, err := s.GetFailedRequest(ctx, req.FailedRequestID)
+		if err != nil {
+			return list, err
+		}
+		list = append(list, r)
+	}
+	return list, nil
+}
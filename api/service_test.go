@@ -1,8 +1,13 @@
 package api
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
 	"io"
 	"io/ioutil"
 	"strings"
@@ -15,6 +20,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/leveldorado/screenshot/capture"
+	"github.com/leveldorado/screenshot/diff"
 
 	"github.com/leveldorado/screenshot/queue"
 	"github.com/stretchr/testify/mock"
@@ -37,15 +43,32 @@ type mockMetadataGetter struct {
 	mock.Mock
 }
 
-func (m *mockMetadataGetter) Get(ctx context.Context, url string, version int) (store.Metadata, error) {
-	args := m.Called(ctx, url, version)
+func (m *mockMetadataGetter) Get(ctx context.Context, url, selector string, version int) (store.Metadata, error) {
+	args := m.Called(ctx, url, selector, version)
 	return args.Get(0).(store.Metadata), args.Error(1)
 }
-func (m *mockMetadataGetter) GetAllVersions(ctx context.Context, url string) ([]store.Metadata, error) {
-	args := m.Called(ctx, url)
+func (m *mockMetadataGetter) GetAllVersions(ctx context.Context, url, selector string) ([]store.Metadata, error) {
+	args := m.Called(ctx, url, selector)
 	return args.Get(0).([]store.Metadata), args.Error(1)
 }
 
+type mockJobRepo struct {
+	mock.Mock
+}
+
+func (m *mockJobRepo) Create(ctx context.Context, job *store.Job) error {
+	return m.Called(ctx, job).Error(0)
+}
+
+func (m *mockJobRepo) Get(ctx context.Context, id string) (store.Job, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(store.Job), args.Error(1)
+}
+
+func (m *mockJobRepo) UpdateItem(ctx context.Context, jobID, itemID string, u store.JobItemUpdate) error {
+	return m.Called(ctx, jobID, itemID, u).Error(0)
+}
+
 type mockFileGetter struct {
 	mock.Mock
 }
@@ -60,12 +83,12 @@ func TestDefaultService_GetScreenshot(t *testing.T) {
 	latest := store.Metadata{FileID: uuid.New().String(), Format: "jpeg", Version: 2}
 	list := []store.Metadata{{FileID: uuid.New().String(), Format: "png", Version: 1}, latest}
 	url := uuid.New().String()
-	mg.On("GetAllVersions", mock.Anything, url).Return(list, nil)
+	mg.On("GetAllVersions", mock.Anything, url, "").Return(list, nil)
 	fg := &mockFileGetter{}
 	file := ioutil.NopCloser(strings.NewReader(uuid.New().String()))
 	fg.On("Get", mock.Anything, latest.FileID).Return(file, nil)
-	s := NewDefaultService(fg, mg, nil, 0)
-	respFile, contentType, err := s.GetScreenshot(context.Background(), url, 0)
+	s := NewDefaultService(fg, mg, nil, nil, nil, nil, nil, 0)
+	respFile, contentType, err := s.GetScreenshot(context.Background(), url, "", 0)
 	require.NoError(t, err)
 	require.Equal(t, file, respFile)
 	require.Equal(t, "image/jpeg", contentType)
@@ -73,13 +96,82 @@ func TestDefaultService_GetScreenshot(t *testing.T) {
 	fg.AssertExpectations(t)
 }
 
+func encodePNG(t *testing.T, img image.Image) io.ReadCloser {
+	buff := &bytes.Buffer{}
+	require.NoError(t, png.Encode(buff, img))
+	return ioutil.NopCloser(buff)
+}
+
+func TestDefaultService_DiffScreenshots(t *testing.T) {
+	url := uuid.New().String()
+	from := store.Metadata{FileID: uuid.New().String(), Format: "png", Version: 1}
+	to := store.Metadata{FileID: uuid.New().String(), Format: "png", Version: 2}
+	mg := &mockMetadataGetter{}
+	mg.On("Get", mock.Anything, url, "", from.Version).Return(from, nil)
+	mg.On("Get", mock.Anything, url, "", to.Version).Return(to, nil)
+	fromImg := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	toImg := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	toImg.Set(1, 2, color.White)
+	fg := &mockFileGetter{}
+	fg.On("Get", mock.Anything, from.FileID).Return(encodePNG(t, fromImg), nil)
+	fg.On("Get", mock.Anything, to.FileID).Return(encodePNG(t, toImg), nil)
+	s := NewDefaultService(fg, mg, nil, nil, nil, nil, nil, 0)
+	res, err := s.DiffScreenshots(context.Background(), url, "", from.Version, to.Version, diff.Options{})
+	require.NoError(t, err)
+	require.Equal(t, 1, res.ChangedPixels)
+	require.Equal(t, []diff.Region{{X: 1, Y: 2, Width: 1, Height: 1}}, res.Regions)
+	mg.AssertExpectations(t)
+	fg.AssertExpectations(t)
+
+	mg.On("Get", mock.Anything, url, "", 5).Return(store.Metadata{}, store.ErrNotFound{})
+	_, err = s.DiffScreenshots(context.Background(), url, "", 5, to.Version, diff.Options{})
+	require.True(t, errors.As(err, &store.ErrNotFound{}))
+
+	pdf := store.Metadata{FileID: uuid.New().String(), Format: "pdf", Version: 6}
+	mg.On("Get", mock.Anything, url, "", pdf.Version).Return(pdf, nil)
+	fg.On("Get", mock.Anything, pdf.FileID).Return(ioutil.NopCloser(strings.NewReader("%PDF-1.4")), nil)
+	_, err = s.DiffScreenshots(context.Background(), url, "", pdf.Version, to.Version, diff.Options{})
+	require.True(t, errors.Is(err, ErrNotImage))
+}
+
+type mockURLPresigner struct {
+	mock.Mock
+}
+
+func (m *mockURLPresigner) PresignGet(ctx context.Context, fileID, contentType string) (string, error) {
+	args := m.Called(ctx, fileID, contentType)
+	return args.String(0), args.Error(1)
+}
+
+func TestDefaultService_GetScreenshotRedirect(t *testing.T) {
+	s := NewDefaultService(nil, nil, nil, nil, nil, nil, nil, 0)
+	location, err := s.GetScreenshotRedirect(context.Background(), uuid.New().String(), "", 0)
+	require.NoError(t, err)
+	require.Empty(t, location)
+
+	mg := &mockMetadataGetter{}
+	m := store.Metadata{FileID: uuid.New().String(), Format: "png", Version: 3}
+	url := uuid.New().String()
+	mg.On("Get", mock.Anything, url, "", m.Version).Return(m, nil)
+	p := &mockURLPresigner{}
+	expected := "http://s3/" + m.FileID
+	p.On("PresignGet", mock.Anything, m.FileID, "image/png").Return(expected, nil)
+	s = NewDefaultService(nil, mg, nil, nil, nil, nil, nil, 0)
+	s.EnableRedirect(p)
+	location, err = s.GetScreenshotRedirect(context.Background(), url, "", m.Version)
+	require.NoError(t, err)
+	require.Equal(t, expected, location)
+	mg.AssertExpectations(t)
+	p.AssertExpectations(t)
+}
+
 func TestDefaultService_GetScreenshotVersions(t *testing.T) {
 	mg := &mockMetadataGetter{}
 	list := []store.Metadata{{FileID: uuid.New().String(), Format: "jpeg", Version: 2}, {FileID: uuid.New().String(), Format: "jpeg", Version: 1}}
 	url := uuid.New().String()
-	mg.On("GetAllVersions", mock.Anything, url).Return(list, nil)
-	s := NewDefaultService(nil, mg, nil, 0)
-	resp, err := s.GetScreenshotVersions(context.Background(), url)
+	mg.On("GetAllVersions", mock.Anything, url, "").Return(list, nil)
+	s := NewDefaultService(nil, mg, nil, nil, nil, nil, nil, 0)
+	resp, err := s.GetScreenshotVersions(context.Background(), url, "")
 	require.NoError(t, err)
 	require.Equal(t, list, resp)
 	mg.AssertExpectations(t)
@@ -87,7 +179,7 @@ func TestDefaultService_GetScreenshotVersions(t *testing.T) {
 
 func TestDefaultService_MakeShots(t *testing.T) {
 	q := &mockSubscriberPublisher{}
-	req := capture.ShotRequest{URL: uuid.New().String()}
+	req := capture.ShotRequest{URL: uuid.New().String(), ShotOptions: capture.ShotOptions{Format: capture.FormatPNG, FullPage: capture.Bool(true)}}
 	q.On("Publish", mock.Anything, capture.ShotRequestTopic, mock.Anything, req).Return(nil)
 	msgChan := make(chan queue.Message, 1)
 	captureResp := capture.ShotResponse{Success: true}
@@ -95,8 +187,128 @@ func TestDefaultService_MakeShots(t *testing.T) {
 	require.NoError(t, err)
 	msgChan <- queue.Message{Data: data}
 	q.On("Subscribe", mock.Anything, mock.Anything).Return(msgChan, nil)
-	s := NewDefaultService(nil, nil, q, time.Second)
-	resp := s.MakeShots(context.Background(), []string{req.URL})
+	s := NewDefaultService(nil, nil, nil, nil, nil, nil, q, time.Second)
+	resp := s.MakeShots(context.Background(), []capture.ShotRequest{req})
 	require.Equal(t, []ResponseItem{{URL: req.URL, Success: true}}, resp)
 	q.AssertExpectations(t)
 }
+
+func TestDefaultService_GetChromeStats(t *testing.T) {
+	q := queue.NewMemory(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sub, err := q.Subscribe(ctx, capture.ChromeStatsTopic)
+	require.NoError(t, err)
+	stats := capture.WorkerStats{Worker: uuid.New().String(), Endpoints: []capture.EndpointStats{{Address: "localhost:9222", Healthy: true}}}
+	go func() {
+		msg := <-sub
+		require.NoError(t, q.Reply(ctx, msg.Reply, stats))
+	}()
+	s := NewDefaultService(nil, nil, nil, nil, nil, nil, q, 0)
+	list, err := s.GetChromeStats(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []capture.WorkerStats{stats}, list)
+}
+
+func TestDefaultService_CreateJob(t *testing.T) {
+	reqs := []capture.ShotRequest{{URL: uuid.New().String()}, {URL: uuid.New().String()}}
+	jobID := uuid.New().String()
+	jr := &mockJobRepo{}
+	jr.On("Create", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		job := args.Get(1).(*store.Job)
+		job.ID = jobID
+		for i := range job.Items {
+			job.Items[i].State = store.JobStateQueued
+		}
+	}).Return(nil)
+	q := &mockSubscriberPublisher{}
+	q.On("Publish", mock.Anything, capture.ShotRequestTopic, "", mock.MatchedBy(func(req capture.ShotRequest) bool {
+		return req.URL == reqs[0].URL && req.JobID == jobID && req.JobItemID != ""
+	})).Return(nil)
+	q.On("Publish", mock.Anything, capture.ShotRequestTopic, "", mock.MatchedBy(func(req capture.ShotRequest) bool {
+		return req.URL == reqs[1].URL
+	})).Return(errors.New("some error"))
+	jr.On("UpdateItem", mock.Anything, jobID, mock.Anything, mock.MatchedBy(func(u store.JobItemUpdate) bool {
+		return u.State == store.JobStateFailed && u.Error != ""
+	})).Return(nil)
+	s := NewDefaultService(nil, nil, jr, nil, nil, nil, q, 0)
+	job, err := s.CreateJob(context.Background(), reqs)
+	require.NoError(t, err)
+	require.Equal(t, jobID, job.ID)
+	require.Equal(t, store.JobStateRunning, job.State)
+	require.Equal(t, store.JobStateQueued, job.Items[0].State)
+	require.Equal(t, store.JobStateFailed, job.Items[1].State)
+	jr.AssertExpectations(t)
+	q.AssertExpectations(t)
+}
+
+func TestDefaultService_ApplyJobEvent(t *testing.T) {
+	e := capture.JobEvent{JobID: uuid.New().String(), JobItemID: uuid.New().String(), State: store.JobStateSucceeded,
+		Response: capture.ShotResponse{Success: true, Metadata: store.Metadata{ID: uuid.New().String(), Version: 4}}}
+	jr := &mockJobRepo{}
+	jr.On("UpdateItem", mock.Anything, e.JobID, e.JobItemID, store.JobItemUpdate{State: store.JobStateSucceeded, MetadataID: e.Response.Metadata.ID, Version: 4}).Return(nil)
+	s := NewDefaultService(nil, nil, jr, nil, nil, nil, nil, 0)
+	require.NoError(t, s.ApplyJobEvent(context.Background(), e))
+	jr.AssertExpectations(t)
+}
+
+type mockFailedRequestRepo struct {
+	mock.Mock
+}
+
+func (m *mockFailedRequestRepo) Record(ctx context.Context, r store.FailedRequest) error {
+	return m.Called(ctx, r).Error(0)
+}
+
+func (m *mockFailedRequestRepo) MarkRequeued(ctx context.Context, id string) error {
+	return m.Called(ctx, id).Error(0)
+}
+
+func (m *mockFailedRequestRepo) Get(ctx context.Context, id string) (store.FailedRequest, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(store.FailedRequest), args.Error(1)
+}
+
+func (m *mockFailedRequestRepo) List(ctx context.Context, state store.FailedRequestState, limit int) ([]store.FailedRequest, error) {
+	args := m.Called(ctx, state, limit)
+	return args.Get(0).([]store.FailedRequest), args.Error(1)
+}
+
+func TestDefaultService_RecordDeadLetter(t *testing.T) {
+	dl := capture.DeadLetter{
+		FailedRequestID: uuid.New().String(),
+		Request:         capture.ShotRequest{URL: "http://a.com", FailedRequestID: uuid.New().String()},
+		Errors:          []store.FailedAttempt{{Attempt: 1, ErrorClass: "timeout", Error: "timeout"}},
+	}
+	fr := &mockFailedRequestRepo{}
+	fr.On("Record", mock.Anything, store.FailedRequest{ID: dl.FailedRequestID, URL: dl.Request.URL, Request: `{"url":"http://a.com"}`, Errors: dl.Errors}).Return(nil)
+	s := NewDefaultService(nil, nil, nil, nil, fr, nil, nil, 0)
+	require.NoError(t, s.RecordDeadLetter(context.Background(), dl))
+	fr.AssertExpectations(t)
+}
+
+func TestDefaultService_RequeueFailedRequests(t *testing.T) {
+	r := store.FailedRequest{ID: uuid.New().String(), URL: "http://a.com", Request: `{"url":"http://a.com","job_id":"job"}`, State: store.FailedRequestStateFailed}
+	requeued := r
+	requeued.State = store.FailedRequestStateRequeued
+	requeued.Requeues = 1
+	missingID := uuid.New().String()
+	fr := &mockFailedRequestRepo{}
+	fr.On("Get", mock.Anything, r.ID).Return(r, nil).Once()
+	fr.On("Get", mock.Anything, missingID).Return(store.FailedRequest{}, store.ErrNotFound{})
+	fr.On("MarkRequeued", mock.Anything, r.ID).Return(nil)
+	fr.On("Get", mock.Anything, r.ID).Return(requeued, nil).Once()
+	q := &mockSubscriberPublisher{}
+	q.On("Publish", mock.Anything, capture.ShotRequestTopic, "", capture.ShotRequest{URL: r.URL, JobID: "job", FailedRequestID: r.ID}).Return(nil).Once()
+	s := NewDefaultService(nil, nil, nil, nil, fr, nil, q, 0)
+
+	// nothing is published when one of ids is unknown
+	_, err := s.RequeueFailedRequests(context.Background(), []string{missingID})
+	require.True(t, errors.As(err, &store.ErrNotFound{}))
+
+	list, err := s.RequeueFailedRequests(context.Background(), []string{r.ID})
+	require.NoError(t, err)
+	require.Equal(t, []store.FailedRequest{requeued}, list)
+	fr.AssertExpectations(t)
+	q.AssertExpectations(t)
+}
@@ -2,6 +2,7 @@ package bootstrap
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/jessevdk/go-flags"
 )
@@ -14,13 +15,23 @@ const (
 
 type flagOptions struct {
 	ConfigPath string `short:"c" long:"config" description:"Path to config file" default:"config.yml"`
-	Queue      string `short:"q" long:"queue" description:"queue connect url" default:"nats://localhost:4222"`
-	Database   string `short:"d" long:"database" description:"database connect url" default:"mongodb://localhost:27017"`
-	Chrome     string `long:"chrome" description:"headless chrome url" default:"localhost:9222"`
+	Queue      string `short:"q" long:"queue" description:"queue connect url. if omitted in standalone mode in-process queue is used, otherwise nats://localhost:4222. redis:// or rediss:// url selects redis streams queue"`
+	Database   string `short:"d" long:"database" description:"database connect url (mongodb driver only)" default:"mongodb://localhost:27017"`
+	Chrome     string `long:"chrome" description:"headless chrome url. several instances can be passed separated by comma" default:"localhost:9222"`
 	Mode       string `short:"m" long:"mode" description:"Supported modes: capture (run only application part which capture screenshots), api (run only application part which receive http requests), standalone: (run both services)" default:"standalone"`
 	Address    string `long:"address" description:"address (host and port) on which api listen http request" default:":9000"`
 }
 
+func (opt flagOptions) chromeAddresses() []string {
+	var list []string
+	for _, addr := range strings.Split(opt.Chrome, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			list = append(list, addr)
+		}
+	}
+	return list
+}
+
 func parseFlags(args []string) (flagOptions, error) {
 	opt := flagOptions{}
 	if _, err := flags.ParseArgs(&opt, args); err != nil {
@@ -3,12 +3,14 @@ package bootstrap
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/leveldorado/screenshot/store"
 
 	"github.com/leveldorado/screenshot/api"
 	"github.com/leveldorado/screenshot/capture"
 	"github.com/leveldorado/screenshot/queue"
+	"github.com/leveldorado/screenshot/webhook"
 )
 
 type runner interface {
@@ -25,40 +27,85 @@ func Build(ctx context.Context, args []string) (runner, error) {
 	if err != nil {
 		return nil, fmt.Errorf(`failed to read config: [path: %s, error: %w]`, opt.ConfigPath, err)
 	}
-	nats, err := queue.NewNATS(opt.Queue, c.Queue.BufferSize, c.Queue.ConnectTimeout)
+	q, err := buildQueue(opt, c)
 	if err != nil {
-		return nil, fmt.Errorf(`failed to create nats: [addr: %s, error: %w]`, opt.Queue, err)
+		return nil, err
 	}
-	fs, ms, err := getFileAndMetadataStore(ctx, opt.Database, c)
+	st, err := buildStores(ctx, opt.Database, c)
 	if err != nil {
 		return nil, err
 	}
+	ws, err := webhook.NewSender(st.webhooks, c.Webhook.Secret, c.Webhook.RequestTimeout, c.Webhook.Retry, c.Webhook.AllowedNetworks)
+	if err != nil {
+		return nil, fmt.Errorf(`failed to create webhook sender: [error: %w]`, err)
+	}
 	switch opt.Mode {
 	case modeAPI:
-		return buildAPI(c, opt, nats, fs, ms), nil
+		return buildAPI(c, opt, q, st, ws), nil
 	case modeCapture:
-		return buildCapture(ctx, c, opt, nats, fs, ms), nil
+		return buildCapture(ctx, c, opt, q, st, ws), nil
 	case modeStandalone:
-		return combinedRunner{parts: []runner{buildAPI(c, opt, nats, fs, ms), buildCapture(ctx, c, opt, nats, fs, ms)}}, err
+		return combinedRunner{parts: []runner{buildAPI(c, opt, q, st, ws), buildCapture(ctx, c, opt, q, st, ws)}}, err
 	default:
 		return nil, fmt.Errorf(`unsupported mode %s. please use one of (standalone, api, capture)`, opt.Mode)
 	}
 }
 
-func getFileAndMetadataStore(ctx context.Context, url string, c config) (*store.MongodbGridFSFileRepo, *store.MongodbMetadataRepo, error) {
-	cl, err := store.BuildMongoClient(ctx, url)
-	if err != nil {
-		return nil, nil, fmt.Errorf(`failed to build mongo client: [url: %s, error: %w]`, url, err)
+type messageQueue interface {
+	Publish(ctx context.Context, topic, reply string, data interface{}) error
+	Reply(ctx context.Context, reply string, data interface{}) error
+	Subscribe(ctx context.Context, topic string) (<-chan queue.Message, error)
+	GroupSubscribe(ctx context.Context, topic, group string) (<-chan queue.Message, error)
+	GroupPull(ctx context.Context, topic, group string, demand <-chan struct{}) (<-chan queue.Message, error)
+}
+
+const (
+	defaultQueueAddress  = "nats://localhost:4222"
+	queueDriverNATS      = "nats"
+	queueDriverJetStream = "jetstream"
+)
+
+func buildQueue(opt flagOptions, c config) (messageQueue, error) {
+	if opt.Queue == "" && opt.Mode == modeStandalone {
+		return queue.NewMemory(c.Queue.BufferSize), nil
 	}
-	fs, err := store.NewMongodbGridFSFileRepo(ctx, cl, c.Database.Name)
-	if err != nil {
-		return nil, nil, fmt.Errorf(`failed create mongodb gridfs repo: [database: %s, error: %w]`, c.Database.Name, err)
+	addr := opt.Queue
+	if addr == "" {
+		addr = defaultQueueAddress
 	}
-	ms := store.NewMongodbMetadataRepo(cl, c.Database.Name, c.Database.Collections.Metadata, c.Database.Collections.VersionCounter)
-	if err = ms.EnsureIndexes(ctx); err != nil {
-		return nil, nil, fmt.Errorf(`failed to ensure metadata indexes: [error: %w]`, err)
+	if strings.HasPrefix(addr, "redis://") || strings.HasPrefix(addr, "rediss://") {
+		cfg := c.Queue.Redis
+		if len(cfg.DeadLetterTopics) == 0 {
+			cfg.DeadLetterTopics = capture.ShotRequestTopics()
+		}
+		cfg.DeadLetter = capture.UndeliveredDeadLetter
+		redis, err := queue.NewRedis(addr, c.Queue.BufferSize, c.Queue.ConnectTimeout, cfg)
+		if err != nil {
+			return nil, fmt.Errorf(`failed to create redis queue: [error: %w]`, err)
+		}
+		return redis, nil
+	}
+	switch c.Queue.Driver {
+	case queueDriverNATS, "":
+		nats, err := queue.NewNATS(addr, c.Queue.BufferSize, c.Queue.ConnectTimeout)
+		if err != nil {
+			return nil, fmt.Errorf(`failed to create nats: [addr: %s, error: %w]`, addr, err)
+		}
+		return nats, nil
+	case queueDriverJetStream:
+		cfg := c.Queue.JetStream
+		if len(cfg.Subjects) == 0 {
+			cfg.Subjects = capture.ShotRequestTopics()
+		}
+		cfg.DeadLetter = capture.UndeliveredDeadLetter
+		js, err := queue.NewJetStream(addr, c.Queue.BufferSize, c.Queue.ConnectTimeout, cfg)
+		if err != nil {
+			return nil, fmt.Errorf(`failed to create jetstream: [addr: %s, error: %w]`, addr, err)
+		}
+		return js, nil
+	default:
+		return nil, fmt.Errorf(`unsupported queue driver %s. please use one of (nats, jetstream)`, c.Queue.Driver)
 	}
-	return fs, ms, nil
 }
 
 type combinedRunner struct {
@@ -74,21 +121,38 @@ func (cr combinedRunner) Run(ctx context.Context) error {
 	return nil
 }
 
+// Stop stops every part even if previous one failed, so resources are released after drain timeout
 func (cr combinedRunner) Stop(ctx context.Context) error {
+	var firstErr error
 	for _, p := range cr.parts {
-		if err := p.Stop(ctx); err != nil {
-			return err
+		if err := p.Stop(ctx); err != nil && firstErr == nil {
+			firstErr = err
 		}
 	}
-	return nil
+	return firstErr
 }
 
-func buildCapture(ctx context.Context, c config, opt flagOptions, nats *queue.NATS, fs *store.MongodbGridFSFileRepo, ms *store.MongodbMetadataRepo) *capture.QueueSubscriptionHandler {
-	sh := capture.NewChromeShotMaker(opt.Chrome)
-	s := capture.NewDefaultService(sh, fs, ms, c.Screenshot.Format, c.Screenshot.Quality)
-	return capture.NewQueueSubscriptionHandler(s, nats, c.Queue.HandleMessageTimeout)
+func buildCapture(ctx context.Context, c config, opt flagOptions, q messageQueue, st stores, ws *webhook.Sender) runner {
+	sh := capture.NewChromeShotMaker(opt.chromeAddresses(), c.Chrome)
+	s := capture.NewDefaultService(sh, st.files, st.metadata, c.Screenshot, c.Capture.Retry)
+	hl := capture.NewHostLimiter(st.hostLimits, c.Capture.HostLimits)
+	// shot maker is stopped after handler so pool is closed when no capture uses it
+	return combinedRunner{parts: []runner{
+		capture.NewQueueSubscriptionHandler(s, q, ws, hl, capture.NewRobotsChecker(c.Capture.Robots), c.Queue.HandleMessageTimeout, c.Queue.CaptureWorkers, c.Queue.PriorityWeights),
+		capture.NewStatsHandler(sh, q),
+		sh,
+	}}
 }
 
-func buildAPI(c config, opt flagOptions, nats *queue.NATS, fs *store.MongodbGridFSFileRepo, ms *store.MongodbMetadataRepo) *api.HTTPHandler {
-	return api.NewHTTPHandler(api.NewDefaultService(fs, ms, nats, c.Queue.WaitReplyTimeout), opt.Address)
+func buildAPI(c config, opt flagOptions, q messageQueue, st stores, ws *webhook.Sender) runner {
+	s := api.NewDefaultService(st.files, st.metadata, st.jobs, ws, st.failedRequests, st.schedules, q, c.Queue.WaitReplyTimeout)
+	if p, ok := st.files.(*store.S3FileRepo); ok && c.Storage.PresignRedirect {
+		s.EnableRedirect(p)
+	}
+	return combinedRunner{parts: []runner{
+		api.NewHTTPHandler(s, opt.Address),
+		api.NewJobEventsHandler(s, q, c.Queue.HandleMessageTimeout),
+		api.NewDeadLetterHandler(s, q, c.Queue.HandleMessageTimeout),
+		api.NewScheduler(st.schedules, st.leases, q, c.Scheduler),
+	}}
 }
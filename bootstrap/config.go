@@ -6,26 +6,75 @@ import (
 	"time"
 
 	"gopkg.in/yaml.v2"
+
+	"github.com/leveldorado/screenshot/api"
+	"github.com/leveldorado/screenshot/capture"
+	"github.com/leveldorado/screenshot/queue"
+	"github.com/leveldorado/screenshot/store"
+	"github.com/leveldorado/screenshot/webhook"
 )
 
 type config struct {
 	Queue struct {
-		BufferSize           int           `yaml:"buffer_size"`
-		ConnectTimeout       time.Duration `yaml:"connect_timeout"`
-		HandleMessageTimeout time.Duration `yaml:"handle_message_timeout"`
-		WaitReplyTimeout     time.Duration `yaml:"wait_reply_timeout"`
+		// nats or jetstream (shot requests are kept in persistent stream until capture acknowledges them)
+		Driver    string                `yaml:"driver"`
+		JetStream queue.JetStreamConfig `yaml:"jetstream"`
+		// used when --queue is redis:// or rediss:// url
+		Redis                queue.RedisConfig `yaml:"redis"`
+		BufferSize           int               `yaml:"buffer_size"`
+		ConnectTimeout       time.Duration     `yaml:"connect_timeout"`
+		HandleMessageTimeout time.Duration     `yaml:"handle_message_timeout"`
+		WaitReplyTimeout     time.Duration     `yaml:"wait_reply_timeout"`
+		// maximum number of shot requests handled concurrently by one capture instance
+		CaptureWorkers int `yaml:"capture_workers"`
+		// share of free capture workers given to priority lane while other lanes have requests too
+		PriorityWeights capture.PriorityWeights `yaml:"priority_weights"`
 	} `yaml:"queue"`
 	Database struct {
+		// mongodb or bolt (embedded database file, no external server required)
+		Driver string `yaml:"driver"`
+		Bolt   struct {
+			Path        string        `yaml:"path"`
+			OpenTimeout time.Duration `yaml:"open_timeout"`
+		} `yaml:"bolt"`
 		Name        string `yaml:"name"`
 		Collections struct {
-			Metadata       string `yaml:"metadata"`
-			VersionCounter string `yaml:"version_counter"`
+			Metadata          string `yaml:"metadata"`
+			VersionCounter    string `yaml:"version_counter"`
+			Jobs              string `yaml:"jobs"`
+			WebhookDeliveries string `yaml:"webhook_deliveries"`
+			FailedRequests    string `yaml:"failed_requests"`
+			HostLimits        string `yaml:"host_limits"`
+			Schedules         string `yaml:"schedules"`
+			Leases            string `yaml:"leases"`
 		} `yaml:"collections"`
 	} `yaml:"database"`
-	Screenshot struct {
-		Format  string `yaml:"format"`
-		Quality int    `yaml:"quality"`
-	} `yaml:"screenshot"`
+	Storage struct {
+		Driver string `yaml:"driver"`
+		Local  struct {
+			Dir string `yaml:"dir"`
+		} `yaml:"local"`
+		S3 store.S3Config `yaml:"s3"`
+		// redirect screenshot downloads to presigned storage url instead of streaming through api (s3 only)
+		PresignRedirect bool `yaml:"presign_redirect"`
+	} `yaml:"storage"`
+	Screenshot capture.ShotOptions  `yaml:"screenshot"`
+	Chrome     capture.ChromeConfig `yaml:"chrome"`
+	Capture    struct {
+		Retry capture.RetryPolicy `yaml:"retry"`
+		// per host concurrency and request rate shared by all capture instances
+		HostLimits capture.HostLimitConfig `yaml:"host_limits"`
+		Robots     capture.RobotsConfig    `yaml:"robots"`
+	} `yaml:"capture"`
+	// scheduler runs in api and standalone modes. one api instance elected by lease fires due schedules
+	Scheduler api.SchedulerConfig `yaml:"scheduler"`
+	Webhook   struct {
+		Secret         string              `yaml:"secret"`
+		RequestTimeout time.Duration       `yaml:"request_timeout"`
+		Retry          webhook.RetryPolicy `yaml:"retry"`
+		// callbacks may reach loopback, link-local and private addresses only within these networks
+		AllowedNetworks []string `yaml:"allowed_networks"`
+	} `yaml:"webhook"`
 }
 
 func readConfig(path string) (config, error) {
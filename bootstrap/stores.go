@@ -0,0 +1,202 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/leveldorado/screenshot/store"
+)
+
+type fileStore interface {
+	Save(ctx context.Context, file io.Reader, fileID, filename string) error
+	Get(ctx context.Context, fileID string) (io.ReadCloser, error)
+}
+
+type metadataStore interface {
+	Save(ctx context.Context, doc *store.Metadata) error
+	Get(ctx context.Context, url, selector string, version int) (store.Metadata, error)
+	GetAllVersions(ctx context.Context, url, selector string) ([]store.Metadata, error)
+}
+
+type jobStore interface {
+	Create(ctx context.Context, job *store.Job) error
+	Get(ctx context.Context, id string) (store.Job, error)
+	UpdateItem(ctx context.Context, jobID, itemID string, u store.JobItemUpdate) error
+}
+
+type webhookDeliveryStore interface {
+	Create(ctx context.Context, d *store.WebhookDelivery) error
+	AddAttempt(ctx context.Context, id string, a store.WebhookAttempt, delivered bool) error
+	Get(ctx context.Context, id string) (store.WebhookDelivery, error)
+	List(ctx context.Context, onlyFailed bool, limit int) ([]store.WebhookDelivery, error)
+}
+
+type failedRequestStore interface {
+	Record(ctx context.Context, r store.FailedRequest) error
+	MarkRequeued(ctx context.Context, id string) error
+	Get(ctx context.Context, id string) (store.FailedRequest, error)
+	List(ctx context.Context, state store.FailedRequestState, limit int) ([]store.FailedRequest, error)
+}
+
+type hostLimitStore interface {
+	AcquireSlot(ctx context.Context, host, holder string, slots int, lease time.Duration) (bool, error)
+	ReleaseSlot(ctx context.Context, host, holder string) error
+	ReserveRate(ctx context.Context, host string, interval time.Duration, deadline time.Time) (time.Time, bool, error)
+}
+
+type scheduleStore interface {
+	Create(ctx context.Context, s *store.Schedule) error
+	Get(ctx context.Context, id string) (store.Schedule, error)
+	List(ctx context.Context, limit int) ([]store.Schedule, error)
+	Update(ctx context.Context, s *store.Schedule) error
+	Delete(ctx context.Context, id string) error
+	Due(ctx context.Context, now time.Time, limit int) ([]store.Schedule, error)
+	MarkRun(ctx context.Context, id string, runAt, lastRunAt, nextRunAt time.Time) (bool, error)
+}
+
+type leaseStore interface {
+	Acquire(ctx context.Context, name, holder string, ttl time.Duration) (bool, error)
+	Release(ctx context.Context, name, holder string) error
+}
+
+type stores struct {
+	files          fileStore
+	metadata       metadataStore
+	jobs           jobStore
+	webhooks       webhookDeliveryStore
+	failedRequests failedRequestStore
+	hostLimits     hostLimitStore
+	schedules      scheduleStore
+	leases         leaseStore
+}
+
+const (
+	databaseDriverMongodb = "mongodb"
+	databaseDriverBolt    = "bolt"
+)
+
+func buildStores(ctx context.Context, url string, c config) (stores, error) {
+	switch c.Database.Driver {
+	case databaseDriverMongodb, "":
+		return buildMongodbStores(ctx, url, c)
+	case databaseDriverBolt:
+		return buildBoltStores(ctx, c)
+	default:
+		return stores{}, fmt.Errorf(`unsupported database driver %s. please use one of (mongodb, bolt)`, c.Database.Driver)
+	}
+}
+
+func buildMongodbStores(ctx context.Context, url string, c config) (stores, error) {
+	cl, err := store.BuildMongoClient(ctx, url)
+	if err != nil {
+		return stores{}, fmt.Errorf(`failed to build mongo client: [url: %s, error: %w]`, url, err)
+	}
+	fs, err := buildFileStore(ctx, cl, c)
+	if err != nil {
+		return stores{}, err
+	}
+	ms := store.NewMongodbMetadataRepo(cl, c.Database.Name, c.Database.Collections.Metadata, c.Database.Collections.VersionCounter)
+	if err = ms.EnsureIndexes(ctx); err != nil {
+		return stores{}, fmt.Errorf(`failed to ensure metadata indexes: [error: %w]`, err)
+	}
+	js := store.NewMongodbJobRepo(cl, c.Database.Name, c.Database.Collections.Jobs)
+	if err = js.EnsureIndexes(ctx); err != nil {
+		return stores{}, fmt.Errorf(`failed to ensure job indexes: [error: %w]`, err)
+	}
+	ws := store.NewMongodbWebhookDeliveryRepo(cl, c.Database.Name, c.Database.Collections.WebhookDeliveries)
+	if err = ws.EnsureIndexes(ctx); err != nil {
+		return stores{}, fmt.Errorf(`failed to ensure webhook delivery indexes: [error: %w]`, err)
+	}
+	fr := store.NewMongodbFailedRequestRepo(cl, c.Database.Name, c.Database.Collections.FailedRequests)
+	if err = fr.EnsureIndexes(ctx); err != nil {
+		return stores{}, fmt.Errorf(`failed to ensure failed request indexes: [error: %w]`, err)
+	}
+	hl := store.NewMongodbHostLimitRepo(cl, c.Database.Name, c.Database.Collections.HostLimits)
+	if err = hl.EnsureIndexes(ctx); err != nil {
+		return stores{}, fmt.Errorf(`failed to ensure host limit indexes: [error: %w]`, err)
+	}
+	ss := store.NewMongodbScheduleRepo(cl, c.Database.Name, c.Database.Collections.Schedules)
+	if err = ss.EnsureIndexes(ctx); err != nil {
+		return stores{}, fmt.Errorf(`failed to ensure schedule indexes: [error: %w]`, err)
+	}
+	ls := store.NewMongodbLeaseRepo(cl, c.Database.Name, c.Database.Collections.Leases)
+	return stores{files: fs, metadata: ms, jobs: js, webhooks: ws, failedRequests: fr, hostLimits: hl, schedules: ss, leases: ls}, nil
+}
+
+func buildBoltStores(ctx context.Context, c config) (stores, error) {
+	fs, err := buildFileStore(ctx, nil, c)
+	if err != nil {
+		return stores{}, err
+	}
+	db, err := store.OpenBoltDB(c.Database.Bolt.Path, c.Database.Bolt.OpenTimeout)
+	if err != nil {
+		return stores{}, err
+	}
+	ms, err := store.NewBoltMetadataRepo(db, c.Database.Collections.Metadata, c.Database.Collections.VersionCounter)
+	if err != nil {
+		return stores{}, fmt.Errorf(`failed to create bolt metadata repo: [error: %w]`, err)
+	}
+	js, err := store.NewBoltJobRepo(db, c.Database.Collections.Jobs)
+	if err != nil {
+		return stores{}, fmt.Errorf(`failed to create bolt job repo: [error: %w]`, err)
+	}
+	ws, err := store.NewBoltWebhookDeliveryRepo(db, c.Database.Collections.WebhookDeliveries)
+	if err != nil {
+		return stores{}, fmt.Errorf(`failed to create bolt webhook delivery repo: [error: %w]`, err)
+	}
+	fr, err := store.NewBoltFailedRequestRepo(db, c.Database.Collections.FailedRequests)
+	if err != nil {
+		return stores{}, fmt.Errorf(`failed to create bolt failed request repo: [error: %w]`, err)
+	}
+	hl, err := store.NewBoltHostLimitRepo(db, c.Database.Collections.HostLimits)
+	if err != nil {
+		return stores{}, fmt.Errorf(`failed to create bolt host limit repo: [error: %w]`, err)
+	}
+	ss, err := store.NewBoltScheduleRepo(db, c.Database.Collections.Schedules)
+	if err != nil {
+		return stores{}, fmt.Errorf(`failed to create bolt schedule repo: [error: %w]`, err)
+	}
+	ls, err := store.NewBoltLeaseRepo(db, c.Database.Collections.Leases)
+	if err != nil {
+		return stores{}, fmt.Errorf(`failed to create bolt lease repo: [error: %w]`, err)
+	}
+	return stores{files: fs, metadata: ms, jobs: js, webhooks: ws, failedRequests: fr, hostLimits: hl, schedules: ss, leases: ls}, nil
+}
+
+const (
+	storageDriverGridFS = "gridfs"
+	storageDriverLocal  = "local"
+	storageDriverS3     = "s3"
+)
+
+func buildFileStore(ctx context.Context, cl *mongo.Client, c config) (fileStore, error) {
+	switch c.Storage.Driver {
+	case storageDriverGridFS, "":
+		if cl == nil {
+			return nil, fmt.Errorf(`gridfs storage requires mongodb database driver. please use local or s3 storage driver`)
+		}
+		fs, err := store.NewMongodbGridFSFileRepo(ctx, cl, c.Database.Name)
+		if err != nil {
+			return nil, fmt.Errorf(`failed create mongodb gridfs repo: [database: %s, error: %w]`, c.Database.Name, err)
+		}
+		return fs, nil
+	case storageDriverLocal:
+		fs, err := store.NewLocalFileRepo(c.Storage.Local.Dir)
+		if err != nil {
+			return nil, fmt.Errorf(`failed to create local file repo: [dir: %s, error: %w]`, c.Storage.Local.Dir, err)
+		}
+		return fs, nil
+	case storageDriverS3:
+		fs, err := store.NewS3FileRepo(ctx, c.Storage.S3)
+		if err != nil {
+			return nil, fmt.Errorf(`failed to create s3 file repo: [endpoint: %s, bucket: %s, error: %w]`, c.Storage.S3.Endpoint, c.Storage.S3.Bucket, err)
+		}
+		return fs, nil
+	default:
+		return nil, fmt.Errorf(`unsupported storage driver %s. please use one of (gridfs, local, s3)`, c.Storage.Driver)
+	}
+}
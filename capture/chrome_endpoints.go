@@ -0,0 +1,172 @@
+package capture
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mafredri/cdp/devtool"
+)
+
+type ChromeConfig struct {
+	Pool PoolConfig `yaml:"pool"`
+	// endpoint is taken out of rotation after this number of consecutive connection errors
+	FailureThreshold int `yaml:"failure_threshold"`
+	// how often unhealthy endpoints are probed to bring them back
+	ProbeInterval time.Duration `yaml:"probe_interval"`
+}
+
+const (
+	defaultFailureThreshold = 3
+	defaultProbeInterval    = 10 * time.Second
+)
+
+func (c ChromeConfig) withDefaults() ChromeConfig {
+	if c.FailureThreshold <= 0 {
+		c.FailureThreshold = defaultFailureThreshold
+	}
+	if c.ProbeInterval <= 0 {
+		c.ProbeInterval = defaultProbeInterval
+	}
+	return c
+}
+
+type EndpointStats struct {
+	Address             string `json:"address"`
+	Healthy             bool   `json:"healthy"`
+	InFlight            int    `json:"in_flight"`
+	Captures            int64  `json:"captures"`
+	ConnectionErrors    int64  `json:"connection_errors"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	LastError           string `json:"last_error,omitempty"`
+}
+
+type endpoint struct {
+	pool  *targetPool
+	stats EndpointStats
+}
+
+// endpointBalancer distributes captures between chrome instances by least in-flight captures
+type endpointBalancer struct {
+	cfg       ChromeConfig
+	mu        sync.Mutex
+	endpoints []*endpoint
+}
+
+func newEndpointBalancer(addrs []string, cfg ChromeConfig) *endpointBalancer {
+	cfg = cfg.withDefaults()
+	b := &endpointBalancer{cfg: cfg}
+	for _, addr := range addrs {
+		b.endpoints = append(b.endpoints, &endpoint{pool: newTargetPool(addr, cfg.Pool), stats: EndpointStats{Address: addr, Healthy: true}})
+	}
+	return b
+}
+
+// pick returns least loaded healthy endpoint which was not tried yet. when all endpoints are unhealthy
+// untried ones are still returned so captures fail fast instead of waiting for probe
+func (b *endpointBalancer) pick(tried map[*endpoint]bool) *endpoint {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var best, fallback *endpoint
+	for _, e := range b.endpoints {
+		if tried[e] {
+			continue
+		}
+		if fallback == nil || e.stats.InFlight < fallback.stats.InFlight {
+			fallback = e
+		}
+		if e.stats.Healthy && (best == nil || e.stats.InFlight < best.stats.InFlight) {
+			best = e
+		}
+	}
+	if best == nil {
+		best = fallback
+	}
+	if best != nil {
+		best.stats.InFlight++
+	}
+	return best
+}
+
+func (b *endpointBalancer) done(e *endpoint) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e.stats.InFlight--
+}
+
+func (b *endpointBalancer) recordSuccess(e *endpoint) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e.stats.Captures++
+	e.stats.ConsecutiveFailures = 0
+	e.stats.Healthy = true
+}
+
+func (b *endpointBalancer) markHealthy(e *endpoint) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e.stats.ConsecutiveFailures = 0
+	e.stats.Healthy = true
+}
+
+func (b *endpointBalancer) recordFailure(e *endpoint, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e.stats.ConnectionErrors++
+	e.stats.ConsecutiveFailures++
+	e.stats.LastError = err.Error()
+	if e.stats.Healthy && e.stats.ConsecutiveFailures >= b.cfg.FailureThreshold {
+		e.stats.Healthy = false
+		log.Println(fmt.Sprintf(`chrome endpoint marked unhealthy: [address: %s, consecutive_failures: %d, error: %s]`, e.stats.Address, e.stats.ConsecutiveFailures, err))
+	}
+}
+
+func (b *endpointBalancer) unhealthy() []*endpoint {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var list []*endpoint
+	for _, e := range b.endpoints {
+		if !e.stats.Healthy {
+			list = append(list, e)
+		}
+	}
+	return list
+}
+
+func (b *endpointBalancer) probe(ctx context.Context) {
+	for _, e := range b.unhealthy() {
+		probeCtx, cancel := context.WithTimeout(ctx, b.cfg.Pool.withDefaults().HealthCheckTimeout)
+		_, err := devtool.New(e.pool.addr).Version(probeCtx)
+		cancel()
+		if err != nil {
+			continue
+		}
+		b.markHealthy(e)
+		log.Println(fmt.Sprintf(`chrome endpoint is healthy again: [address: %s]`, e.pool.addr))
+	}
+}
+
+func (b *endpointBalancer) runProbes(ctx context.Context) {
+	ticker := time.NewTicker(b.cfg.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.probe(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (b *endpointBalancer) Stats() []EndpointStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	list := make([]EndpointStats, 0, len(b.endpoints))
+	for _, e := range b.endpoints {
+		list = append(list, e.stats)
+	}
+	return list
+}
@@ -0,0 +1,51 @@
+package capture
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEndpointBalancer_PickLeastInFlight(t *testing.T) {
+	b := newEndpointBalancer([]string{"a", "b", "c"}, ChromeConfig{})
+	first := b.pick(map[*endpoint]bool{})
+	second := b.pick(map[*endpoint]bool{})
+	third := b.pick(map[*endpoint]bool{})
+	require.ElementsMatch(t, []string{"a", "b", "c"}, []string{first.pool.addr, second.pool.addr, third.pool.addr})
+	b.done(second)
+	require.Equal(t, second, b.pick(map[*endpoint]bool{}))
+	require.Nil(t, b.pick(map[*endpoint]bool{first: true, second: true, third: true}))
+}
+
+func TestEndpointBalancer_Failures(t *testing.T) {
+	b := newEndpointBalancer([]string{"a", "b"}, ChromeConfig{FailureThreshold: 2})
+	a, bb := b.endpoints[0], b.endpoints[1]
+	b.recordFailure(a, errors.New("connection refused"))
+	require.True(t, a.stats.Healthy)
+	b.recordFailure(a, errors.New("connection refused"))
+	require.False(t, a.stats.Healthy)
+	require.Equal(t, []*endpoint{a}, b.unhealthy())
+
+	// unhealthy endpoint is skipped even if it is less loaded
+	bb.stats.InFlight = 5
+	require.Equal(t, bb, b.pick(map[*endpoint]bool{}))
+	// but used when there is no healthy one left
+	require.Equal(t, a, b.pick(map[*endpoint]bool{bb: true}))
+
+	b.recordSuccess(a)
+	stats := b.Stats()
+	require.Equal(t, EndpointStats{Address: "a", Healthy: true, InFlight: 1, Captures: 1, ConnectionErrors: 2, LastError: "connection refused"}, stats[0])
+}
+
+func TestChromeShotMaker_AcquireFailover(t *testing.T) {
+	c := NewChromeShotMaker([]string{"127.0.0.1:1", "127.0.0.1:2"}, ChromeConfig{FailureThreshold: 1})
+	_, _, err := c.acquire(context.Background())
+	require.Error(t, err)
+	for _, s := range c.Stats() {
+		require.False(t, s.Healthy)
+		require.Equal(t, int64(1), s.ConnectionErrors)
+		require.Equal(t, 0, s.InFlight)
+	}
+}
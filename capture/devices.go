@@ -0,0 +1,52 @@
+package capture
+
+import "sort"
+
+type Device struct {
+	Name              string  `json:"name"`
+	Width             int     `json:"width"`
+	Height            int     `json:"height"`
+	DeviceScaleFactor float64 `json:"device_scale_factor"`
+	Mobile            bool    `json:"mobile"`
+	Touch             bool    `json:"touch"`
+	UserAgent         string  `json:"user_agent,omitempty"`
+}
+
+const (
+	userAgentIPhone  = "Mozilla/5.0 (iPhone; CPU iPhone OS 13_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/13.0.1 Mobile/15E148 Safari/604.1"
+	userAgentIPad    = "Mozilla/5.0 (iPad; CPU OS 13_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/13.0.1 Mobile/15E148 Safari/604.1"
+	userAgentPixel2  = "Mozilla/5.0 (Linux; Android 10; Pixel 2) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/77.0.3865.116 Mobile Safari/537.36"
+	userAgentPixel3  = "Mozilla/5.0 (Linux; Android 10; Pixel 3) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/77.0.3865.116 Mobile Safari/537.36"
+	userAgentGalaxy  = "Mozilla/5.0 (Linux; Android 9; SM-G960F) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/77.0.3865.116 Mobile Safari/537.36"
+	userAgentDesktop = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/77.0.3865.120 Safari/537.36"
+)
+
+var devices = map[string]Device{
+	"iphone-se":     {Name: "iphone-se", Width: 320, Height: 568, DeviceScaleFactor: 2, Mobile: true, Touch: true, UserAgent: userAgentIPhone},
+	"iphone-8":      {Name: "iphone-8", Width: 375, Height: 667, DeviceScaleFactor: 2, Mobile: true, Touch: true, UserAgent: userAgentIPhone},
+	"iphone-8-plus": {Name: "iphone-8-plus", Width: 414, Height: 736, DeviceScaleFactor: 3, Mobile: true, Touch: true, UserAgent: userAgentIPhone},
+	"iphone-x":      {Name: "iphone-x", Width: 375, Height: 812, DeviceScaleFactor: 3, Mobile: true, Touch: true, UserAgent: userAgentIPhone},
+	"iphone-11":     {Name: "iphone-11", Width: 414, Height: 896, DeviceScaleFactor: 2, Mobile: true, Touch: true, UserAgent: userAgentIPhone},
+	"pixel-2":       {Name: "pixel-2", Width: 411, Height: 731, DeviceScaleFactor: 2.625, Mobile: true, Touch: true, UserAgent: userAgentPixel2},
+	"pixel-3":       {Name: "pixel-3", Width: 393, Height: 786, DeviceScaleFactor: 2.75, Mobile: true, Touch: true, UserAgent: userAgentPixel3},
+	"galaxy-s9":     {Name: "galaxy-s9", Width: 360, Height: 740, DeviceScaleFactor: 4, Mobile: true, Touch: true, UserAgent: userAgentGalaxy},
+	"ipad":          {Name: "ipad", Width: 768, Height: 1024, DeviceScaleFactor: 2, Mobile: true, Touch: true, UserAgent: userAgentIPad},
+	"ipad-pro":      {Name: "ipad-pro", Width: 1024, Height: 1366, DeviceScaleFactor: 2, Mobile: true, Touch: true, UserAgent: userAgentIPad},
+	"desktop-720p":  {Name: "desktop-720p", Width: 1280, Height: 720, DeviceScaleFactor: 1, UserAgent: userAgentDesktop},
+	"desktop-1080p": {Name: "desktop-1080p", Width: 1920, Height: 1080, DeviceScaleFactor: 1, UserAgent: userAgentDesktop},
+	"desktop-1440p": {Name: "desktop-1440p", Width: 2560, Height: 1440, DeviceScaleFactor: 1, UserAgent: userAgentDesktop},
+}
+
+func GetDevice(name string) (Device, bool) {
+	d, ok := devices[name]
+	return d, ok
+}
+
+func ListDevices() []Device {
+	list := make([]Device, 0, len(devices))
+	for _, d := range devices {
+		list = append(list, d)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
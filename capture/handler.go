@@ -3,10 +3,14 @@ package capture
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
+	"github.com/google/uuid"
+
 	"github.com/leveldorado/screenshot/queue"
 	"github.com/leveldorado/screenshot/store"
 )
@@ -14,87 +18,428 @@ import (
 type ShotResponse struct {
 	Success  bool           `json:"success"`
 	Metadata store.Metadata `json:"metadata"`
-	Error    string         `json:"error"`
+	// metadata of every element shot when request has selectors. Metadata holds the first of them
+	Elements []store.Metadata `json:"elements,omitempty"`
+	Error    string           `json:"error"`
+	// class of failure, e.g. robots_disallowed when url was rejected without navigation
+	ErrorCode ErrorClass `json:"error_code,omitempty"`
+	// capture attempts made including retries
+	Attempts int `json:"attempts,omitempty"`
 }
 
 type ShotRequest struct {
-	URL string `json:"url"`
+	URL         string `json:"url"`
+	JobID       string `json:"job_id,omitempty"`
+	JobItemID   string `json:"job_item_id,omitempty"`
+	CallbackURL string `json:"callback_url,omitempty"`
+	// set when failed request is requeued so its next failure is recorded to the same entry
+	FailedRequestID string `json:"failed_request_id,omitempty"`
+	// queue lane of request, normal when empty
+	Priority Priority `json:"priority,omitempty"`
+	// set when request is published by schedule, so saved versions link back to it
+	ScheduleID string `json:"schedule_id,omitempty"`
+	ShotOptions
+}
+
+type CallbackPayload struct {
+	URL   string `json:"url"`
+	JobID string `json:"job_id,omitempty"`
+	ShotResponse
+}
+
+type JobEvent struct {
+	JobID     string         `json:"job_id"`
+	JobItemID string         `json:"job_item_id"`
+	State     store.JobState `json:"state"`
+	Response  ShotResponse   `json:"response"`
+}
+
+// DeadLetter is published for shot request which failed after all capture attempts
+type DeadLetter struct {
+	FailedRequestID string                `json:"failed_request_id"`
+	Request         ShotRequest           `json:"request"`
+	Errors          []store.FailedAttempt `json:"errors"`
 }
 
-const ShotRequestTopic = "shot_request"
+const (
+	ShotRequestTopic = "shot_request"
+	JobEventTopic    = "job_event"
+	DeadLetterTopic  = "shot_request_dead_letter"
+)
 
 type service interface {
-	MakeShotAndSave(ctx context.Context, url string) (store.Metadata, error)
+	MakeShotAndSave(ctx context.Context, url string, opt ShotOptions, scheduleID string) ([]store.Metadata, error)
 }
 
 type subscriberReplier interface {
-	GroupSubscribe(ctx context.Context, topic, group string) (<-chan queue.Message, error)
+	GroupPull(ctx context.Context, topic, group string, demand <-chan struct{}) (<-chan queue.Message, error)
 	Reply(ctx context.Context, reply string, data interface{}) error
+	Publish(ctx context.Context, topic, reply string, data interface{}) error
+}
+
+type hostWaiter interface {
+	Wait(ctx context.Context, url string) (func(), error)
+	MaxWait(url string) time.Duration
+}
+
+type robotsChecker interface {
+	Check(ctx context.Context, url string) error
+}
+
+type callbackSender interface {
+	Send(ctx context.Context, callbackURL string, payload interface{}) (store.WebhookDelivery, error)
 }
 
 type QueueSubscriptionHandler struct {
 	s              service
 	q              subscriberReplier
+	cs             callbackSender
+	hl             hostWaiter
+	rc             robotsChecker
 	requestTimeout time.Duration
+	// slot is taken by every message in progress and by lanes asking queue for the next message
+	workers chan struct{}
+	lanes   *laneSelector
+	// unsubscribe closes subscription on shutdown, consumed is closed when no more messages are dispatched
+	unsubscribe context.CancelFunc
+	consumed    chan struct{}
+	// callbacks still being delivered, Stop waits for them too
+	callbacks sync.WaitGroup
 }
 
-func NewQueueSubscriptionHandler(s service, q subscriberReplier, requestTimeout time.Duration) *QueueSubscriptionHandler {
+const defaultWorkers = 4
+
+func NewQueueSubscriptionHandler(s service, q subscriberReplier, cs callbackSender, hl hostWaiter, rc robotsChecker, requestTimeout time.Duration, workers int, weights PriorityWeights) *QueueSubscriptionHandler {
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
 	return &QueueSubscriptionHandler{
 		s:              s,
 		q:              q,
+		cs:             cs,
+		hl:             hl,
+		rc:             rc,
 		requestTimeout: requestTimeout,
+		workers:        make(chan struct{}, workers),
+		lanes:          newLaneSelector(weights),
+		consumed:       make(chan struct{}),
 	}
 }
 
-const subscriptionGroupCapture = "capture"
+const (
+	subscriptionGroupCapture = "capture"
+	resubscribeDelay         = time.Second
+	publishTimeout           = 5 * time.Second
+)
+
+// publishContext bounds publish of dead letter, job event or requeued request. it does not derive from message
+// context, which is often done exactly when request failed by timeout
+func publishContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), publishTimeout)
+}
 
 func (h *QueueSubscriptionHandler) Run(ctx context.Context) error {
-	return h.subscribeTopics(ctx)
+	ctx, h.unsubscribe = context.WithCancel(ctx)
+	if err := h.subscribeTopics(ctx); err != nil {
+		close(h.consumed)
+		return err
+	}
+	return nil
 }
 
+// Stop leaves capture queue group and waits until in-flight captures are finished and replied and their callbacks are sent
 func (h *QueueSubscriptionHandler) Stop(ctx context.Context) error {
+	if h.unsubscribe == nil {
+		return nil
+	}
+	h.unsubscribe()
+	select {
+	case <-h.consumed:
+	case <-ctx.Done():
+		return fmt.Errorf(`timeout waiting for subscription to close: [error: %w]`, ctx.Err())
+	}
+	// every slot is free only when all workers are done
+	for i := 0; i < cap(h.workers); i++ {
+		select {
+		case h.workers <- struct{}{}:
+		case <-ctx.Done():
+			inFlight := len(h.workers) - i
+			for ; i > 0; i-- {
+				<-h.workers
+			}
+			return fmt.Errorf(`timeout waiting for in-flight captures: [in_flight: %d, error: %w]`, inFlight, ctx.Err())
+		}
+	}
+	sent := make(chan struct{})
+	go func() {
+		h.callbacks.Wait()
+		close(sent)
+	}()
+	select {
+	case <-sent:
+	case <-ctx.Done():
+		// slots are given back, so stop can be retried
+		for i := 0; i < cap(h.workers); i++ {
+			<-h.workers
+		}
+		return fmt.Errorf(`timeout waiting for callbacks: [error: %w]`, ctx.Err())
+	}
 	return nil
 }
 
 func (h *QueueSubscriptionHandler) subscribeTopics(ctx context.Context) error {
-	if err := h.subscribeTopic(ctx, ShotRequestTopic, h.makeShotAndSave); err != nil {
-		return fmt.Errorf(`failed to subscribe shot request topic: [error: %w]`, err)
+	if err := h.subscribeLanes(ctx, h.makeShotAndSave); err != nil {
+		return fmt.Errorf(`failed to subscribe shot request topics: [error: %w]`, err)
 	}
 	return nil
 }
 
 type messageHandler func(ctx context.Context, msg []byte) interface{}
 
-func (h *QueueSubscriptionHandler) subscribeTopic(ctx context.Context, topic string, mh messageHandler) error {
-	sub, err := h.q.GroupSubscribe(ctx, topic, subscriptionGroupCapture)
+func (h *QueueSubscriptionHandler) subscribeLanes(ctx context.Context, mh messageHandler) error {
+	ls, unsubscribe, err := h.subscribe(ctx)
 	if err != nil {
-		return fmt.Errorf(`failed to subscribe topic: [topic: %s, error: %w]`, topic, err)
+		return err
 	}
-	go func() {
-		for msg := range sub {
-			go h.handleMessage(topic, msg, mh)
-		}
-	}()
+	go h.consume(ctx, mh, ls, unsubscribe)
 	return nil
 }
 
+// subscribe joins capture group of every priority lane. lanes share context, so they are closed together
+func (h *QueueSubscriptionHandler) subscribe(ctx context.Context) (*laneSubscription, context.CancelFunc, error) {
+	subCtx, cancel := context.WithCancel(ctx)
+	demand := newLaneDemand()
+	var subs []<-chan queue.Message
+	for i, p := range priorities {
+		sub, err := h.q.GroupPull(subCtx, p.Topic(), subscriptionGroupCapture, demand[i])
+		if err != nil {
+			cancel()
+			return nil, nil, fmt.Errorf(`failed to subscribe topic: [topic: %s, error: %w]`, p.Topic(), err)
+		}
+		subs = append(subs, sub)
+	}
+	return newLaneSubscription(subs, demand), cancel, nil
+}
+
+// consume stays in capture group while all workers are busy, since leaving it would lose messages published to
+// core nats meanwhile. backpressure is applied by queue instead: lanes ask it for the next message only when worker
+// is free. subscription is opened again when queue closes every lane
+func (h *QueueSubscriptionHandler) consume(ctx context.Context, mh messageHandler, ls *laneSubscription, unsubscribe context.CancelFunc) {
+	defer close(h.consumed)
+	for {
+		h.dispatch(mh, ls)
+		unsubscribe()
+		if ctx.Err() != nil {
+			return
+		}
+		var err error
+		if ls, unsubscribe, err = h.resubscribe(ctx); err != nil {
+			return
+		}
+	}
+}
+
+// resubscribe retries subscription until it succeeds or context is done
+func (h *QueueSubscriptionHandler) resubscribe(ctx context.Context) (*laneSubscription, context.CancelFunc, error) {
+	for {
+		ls, unsubscribe, err := h.subscribe(ctx)
+		if err == nil {
+			return ls, unsubscribe, nil
+		}
+		log.Println(fmt.Sprintf(`failed to subscribe again: [error: %s]`, err))
+		select {
+		case <-time.After(resubscribeDelay):
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+}
+
+// dispatch runs every message in own worker and returns when subscription of every lane is closed. slot is taken
+// before the next message is asked for. lane of the next message is chosen by weights when several lanes have messages
+func (h *QueueSubscriptionHandler) dispatch(mh messageHandler, ls *laneSubscription) {
+	for {
+		h.workers <- struct{}{}
+		msg, p, ok := h.lanes.next(ls)
+		if !ok {
+			<-h.workers
+			return
+		}
+		go func(topic string, msg queue.Message) {
+			defer func() { <-h.workers }()
+			h.handleMessage(topic, msg, mh)
+		}(p.Topic(), msg)
+	}
+}
+
 func (h *QueueSubscriptionHandler) handleMessage(topic string, msg queue.Message, mh messageHandler) {
-	//TODO handle context timeout
-	msgCtx, _ := context.WithTimeout(context.Background(), h.requestTimeout)
+	msgCtx, cancel := context.WithTimeout(context.Background(), h.messageTimeout(msg.Data))
+	defer cancel()
 	resp := mh(msgCtx, msg.Data)
+	// failed request is acknowledged too, it is already dead-lettered. only crashed worker leaves message to redelivery
+	defer func() {
+		if err := msg.Ack(); err != nil {
+			log.Println(fmt.Sprintf(`failed to ack message: [topic: %s, error: %s]`, topic, err))
+		}
+	}()
+	if msg.Reply == "" {
+		return
+	}
 	if err := h.q.Reply(msgCtx, msg.Reply, resp); err != nil {
 		log.Println(fmt.Sprintf(`failed to publish reply: [topic: %s, reply: %s, resp: %+v, error: %s]`, topic, msg.Reply, resp, err))
 	}
 }
 
+// messageTimeout extends request timeout by max wait of host limits only when limits apply to url of request
+func (h *QueueSubscriptionHandler) messageTimeout(msg []byte) time.Duration {
+	if h.hl == nil {
+		return h.requestTimeout
+	}
+	var req ShotRequest
+	if err := json.Unmarshal(msg, &req); err != nil {
+		return h.requestTimeout
+	}
+	return h.requestTimeout + h.hl.MaxWait(req.URL)
+}
+
 func (h *QueueSubscriptionHandler) makeShotAndSave(ctx context.Context, msg []byte) interface{} {
 	var req ShotRequest
 	if err := json.Unmarshal(msg, &req); err != nil {
 		return ShotResponse{Error: fmt.Sprintf(`failed to unmarshal shot request: [msg: %s, error: %s]`, msg, err)}
 	}
-	metadata, err := h.s.MakeShotAndSave(ctx, req.URL)
+	resp, err := h.makeLimitedShot(ctx, req)
+	var limitErr *HostLimitTimeoutError
+	if errors.As(err, &limitErr) {
+		// busy host is not a failure of request, so it goes back to queue and job item stays queued
+		h.requeue(req, err)
+		return resp
+	}
+	state := store.JobStateSucceeded
+	var robotsErr *RobotsDisallowedError
+	if err != nil {
+		state = store.JobStateFailed
+		// disallowed url fails the same way on every attempt, so there is nothing to requeue
+		if !errors.As(err, &robotsErr) {
+			h.publishDeadLetter(req, err)
+		}
+	}
+	h.publishJobEvent(req, state, resp)
+	if req.CallbackURL != "" {
+		// delivery is retried with backoff so it must not hold the reply
+		h.callbacks.Add(1)
+		go func() {
+			defer h.callbacks.Done()
+			h.sendCallback(req, resp)
+		}()
+	}
+	return resp
+}
+
+func (h *QueueSubscriptionHandler) sendCallback(req ShotRequest, resp ShotResponse) {
+	payload := CallbackPayload{URL: req.URL, JobID: req.JobID, ShotResponse: resp}
+	if _, err := h.cs.Send(context.Background(), req.CallbackURL, payload); err != nil {
+		log.Println(fmt.Sprintf(`failed to send callback: [url: %s, callback_url: %s, error: %s]`, req.URL, req.CallbackURL, err))
+	}
+}
+
+// makeLimitedShot checks robots.txt and waits for host limits before job item is marked as running. capture itself is
+// bounded by request timeout
+func (h *QueueSubscriptionHandler) makeLimitedShot(ctx context.Context, req ShotRequest) (ShotResponse, error) {
+	if h.rc != nil {
+		if err := h.rc.Check(ctx, req.URL); err != nil {
+			return ShotResponse{Error: err.Error(), ErrorCode: ErrorClassRobotsDisallowed}, err
+		}
+	}
+	if h.hl != nil {
+		release, err := h.hl.Wait(ctx, req.URL)
+		if err != nil {
+			resp := ShotResponse{Error: fmt.Sprintf(`failed to wait for host limits: [url: %s, error: %s]`, req.URL, err)}
+			var limitErr *HostLimitTimeoutError
+			if errors.As(err, &limitErr) {
+				resp.ErrorCode = ErrorClassHostLimitTimeout
+			}
+			return resp, err
+		}
+		defer release()
+	}
+	h.publishJobEvent(req, store.JobStateRunning, ShotResponse{})
+	ctx, cancel := context.WithTimeout(ctx, h.requestTimeout)
+	defer cancel()
+	return h.makeShot(ctx, req)
+}
+
+func (h *QueueSubscriptionHandler) makeShot(ctx context.Context, req ShotRequest) (ShotResponse, error) {
+	list, err := h.s.MakeShotAndSave(ctx, req.URL, req.ShotOptions, req.ScheduleID)
 	if err != nil {
-		return ShotResponse{Error: fmt.Sprintf(`failed to make shot and save: [url: %s, error: %s]`, req.URL, err)}
+		resp := ShotResponse{Error: fmt.Sprintf(`failed to make shot and save: [url: %s, error: %s]`, req.URL, err)}
+		var shotErr *ShotError
+		if errors.As(err, &shotErr) {
+			resp.Attempts = shotErr.Attempts
+			resp.ErrorCode = shotErr.Class
+		}
+		return resp, err
+	}
+	resp := ShotResponse{Success: true, Metadata: list[0], Attempts: list[0].Attempts}
+	if len(req.Selectors) > 0 {
+		resp.Elements = list
+	}
+	return resp, nil
+}
+
+// UndeliveredDeadLetter builds dead letter of shot request which queue delivers for the last time, since previous
+// deliveries were never acknowledged, e.g. capture instance crashed or was killed while handling it
+func UndeliveredDeadLetter(data []byte, deliveries int) (string, interface{}) {
+	dl := DeadLetter{FailedRequestID: uuid.New().String()}
+	msg := fmt.Sprintf(`shot request was not acknowledged: [deliveries: %d]`, deliveries)
+	if err := json.Unmarshal(data, &dl.Request); err != nil {
+		msg = fmt.Sprintf(`malformed shot request was not acknowledged: [deliveries: %d, data: %s, error: %s]`, deliveries, data, err)
+	}
+	if dl.Request.FailedRequestID != "" {
+		dl.FailedRequestID = dl.Request.FailedRequestID
+	}
+	dl.Errors = []store.FailedAttempt{{At: time.Now().UTC(), Attempt: deliveries, ErrorClass: string(ErrorClassOther), Error: msg}}
+	return DeadLetterTopic, dl
+}
+
+func (h *QueueSubscriptionHandler) publishDeadLetter(req ShotRequest, err error) {
+	dl := DeadLetter{FailedRequestID: req.FailedRequestID, Request: req}
+	if dl.FailedRequestID == "" {
+		dl.FailedRequestID = uuid.New().String()
+	}
+	var shotErr *ShotError
+	if errors.As(err, &shotErr) {
+		dl.Errors = shotErr.History
+	} else {
+		// failure outside of capture attempts, e.g. host limits could not be checked or result could not be stored
+		dl.Errors = []store.FailedAttempt{{At: time.Now().UTC(), Attempt: 1, ErrorClass: string(ErrorClassOther), Error: err.Error()}}
+	}
+	ctx, cancel := publishContext()
+	defer cancel()
+	if err := h.q.Publish(ctx, DeadLetterTopic, "", dl); err != nil {
+		log.Println(fmt.Sprintf(`failed to publish dead letter: [url: %s, failed_request_id: %s, error: %s]`, req.URL, dl.FailedRequestID, err))
+	}
+}
+
+// requeue publishes request to its lane again without reply, waiting client already got host limit timeout. request
+// which could not be published is dead-lettered, so it is not lost
+func (h *QueueSubscriptionHandler) requeue(req ShotRequest, err error) {
+	topic := req.Priority.Topic()
+	ctx, cancel := publishContext()
+	defer cancel()
+	if pubErr := h.q.Publish(ctx, topic, "", req); pubErr != nil {
+		log.Println(fmt.Sprintf(`failed to requeue shot request: [url: %s, topic: %s, error: %s]`, req.URL, topic, pubErr))
+		h.publishDeadLetter(req, err)
+	}
+}
+
+func (h *QueueSubscriptionHandler) publishJobEvent(req ShotRequest, state store.JobState, resp ShotResponse) {
+	if req.JobID == "" {
+		return
+	}
+	event := JobEvent{JobID: req.JobID, JobItemID: req.JobItemID, State: state, Response: resp}
+	ctx, cancel := publishContext()
+	defer cancel()
+	if err := h.q.Publish(ctx, JobEventTopic, "", event); err != nil {
+		log.Println(fmt.Sprintf(`failed to publish job event: [event: %+v, error: %s]`, event, err))
 	}
-	return ShotResponse{Success: true, Metadata: metadata}
 }
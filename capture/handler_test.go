@@ -3,6 +3,10 @@ package capture
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 
@@ -20,16 +24,25 @@ type mockService struct {
 	mock.Mock
 }
 
-func (m *mockService) MakeShotAndSave(ctx context.Context, url string) (store.Metadata, error) {
-	args := m.Called(ctx, url)
-	return args.Get(0).(store.Metadata), args.Error(1)
+func (m *mockService) MakeShotAndSave(ctx context.Context, url string, opt ShotOptions, scheduleID string) ([]store.Metadata, error) {
+	args := m.Called(ctx, url, opt, scheduleID)
+	return args.Get(0).([]store.Metadata), args.Error(1)
+}
+
+type mockCallbackSender struct {
+	mock.Mock
+}
+
+func (m *mockCallbackSender) Send(ctx context.Context, callbackURL string, payload interface{}) (store.WebhookDelivery, error) {
+	args := m.Called(ctx, callbackURL, payload)
+	return args.Get(0).(store.WebhookDelivery), args.Error(1)
 }
 
 type mockSubscriberReplier struct {
 	mock.Mock
 }
 
-func (m *mockSubscriberReplier) GroupSubscribe(ctx context.Context, topic, group string) (<-chan queue.Message, error) {
+func (m *mockSubscriberReplier) GroupPull(ctx context.Context, topic, group string, demand <-chan struct{}) (<-chan queue.Message, error) {
 	args := m.Called(ctx, topic, group)
 	return args.Get(0).(chan queue.Message), args.Error(1)
 }
@@ -38,22 +51,28 @@ func (m *mockSubscriberReplier) Reply(ctx context.Context, reply string, data in
 	return m.Called(ctx, reply, data).Error(0)
 }
 
+func (m *mockSubscriberReplier) Publish(ctx context.Context, topic, reply string, data interface{}) error {
+	return m.Called(ctx, topic, reply, data).Error(0)
+}
+
 func TestQueueSubscriptionHandlerMakeShotAndSave(t *testing.T) {
 	s := &mockService{}
 	url := uuid.New().String()
-	metadata := store.Metadata{ID: uuid.New().String(), Url: url, Format: "jpeg"}
-	s.On("MakeShotAndSave", mock.Anything, url).Return(metadata, nil)
+	opt := ShotOptions{Format: FormatPNG, ViewportWidth: 1920, ViewportHeight: 1080, FullPage: Bool(true)}
+	metadata := store.Metadata{ID: uuid.New().String(), Url: url, Format: opt.Format, ViewportWidth: opt.ViewportWidth, ViewportHeight: opt.ViewportHeight, FullPage: *opt.FullPage}
+	s.On("MakeShotAndSave", mock.Anything, url, opt, "").Return([]store.Metadata{metadata}, nil)
 
 	resp := ShotResponse{Success: true, Metadata: metadata}
-	req := ShotRequest{URL: url}
+	req := ShotRequest{URL: url, ShotOptions: opt}
 	reqData, err := json.Marshal(req)
 	require.NoError(t, err)
 	msg := queue.Message{Data: reqData, Reply: uuid.New().String()}
 	msgChan := make(chan queue.Message)
 	q := &mockSubscriberReplier{}
-	q.On("GroupSubscribe", mock.Anything, ShotRequestTopic, subscriptionGroupCapture).Return(msgChan, nil)
+	q.On("GroupPull", mock.Anything, ShotRequestTopic, subscriptionGroupCapture).Return(msgChan, nil)
+	q.On("GroupPull", mock.Anything, mock.Anything, subscriptionGroupCapture).Return(make(chan queue.Message), nil)
 	q.On("Reply", mock.Anything, msg.Reply, resp).Return(nil)
-	h := NewQueueSubscriptionHandler(s, q, time.Second)
+	h := NewQueueSubscriptionHandler(s, q, nil, nil, nil, time.Second, 2, nil)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	require.NoError(t, h.Run(ctx))
@@ -62,3 +81,361 @@ func TestQueueSubscriptionHandlerMakeShotAndSave(t *testing.T) {
 	s.AssertExpectations(t)
 	q.AssertExpectations(t)
 }
+
+func TestQueueSubscriptionHandlerMakeShotAndSaveElements(t *testing.T) {
+	s := &mockService{}
+	url := uuid.New().String()
+	opt := ShotOptions{Selectors: []string{"header", ".pricing"}}
+	list := []store.Metadata{{ID: uuid.New().String(), Url: url, Selector: "header"}, {ID: uuid.New().String(), Url: url, Selector: ".pricing"}}
+	s.On("MakeShotAndSave", mock.Anything, url, opt, "").Return(list, nil)
+
+	req := ShotRequest{URL: url, ShotOptions: opt}
+	reqData, err := json.Marshal(req)
+	require.NoError(t, err)
+	h := NewQueueSubscriptionHandler(s, nil, nil, nil, nil, time.Second, 2, nil)
+	resp := h.makeShotAndSave(context.Background(), reqData)
+	require.Equal(t, ShotResponse{Success: true, Metadata: list[0], Elements: list}, resp)
+	s.AssertExpectations(t)
+}
+
+func TestQueueSubscriptionHandlerMakeShotAndSaveAttempts(t *testing.T) {
+	s := &mockService{}
+	url := uuid.New().String()
+	history := []store.FailedAttempt{{Attempt: 1, ErrorClass: "timeout"}, {Attempt: 2, ErrorClass: "timeout"}, {Attempt: 3, ErrorClass: "timeout"}}
+	s.On("MakeShotAndSave", mock.Anything, url, ShotOptions{}, "").Return([]store.Metadata(nil), &ShotError{URL: url, Attempts: 3, Class: ErrorClassTimeout, Err: context.DeadlineExceeded, History: history})
+
+	req := ShotRequest{URL: url, FailedRequestID: uuid.New().String()}
+	reqData, err := json.Marshal(req)
+	require.NoError(t, err)
+	q := &mockSubscriberReplier{}
+	q.On("Publish", mock.Anything, DeadLetterTopic, "", DeadLetter{FailedRequestID: req.FailedRequestID, Request: req, Errors: history}).Return(nil)
+	h := NewQueueSubscriptionHandler(s, q, nil, nil, nil, time.Second, 2, nil)
+	resp := h.makeShotAndSave(context.Background(), reqData).(ShotResponse)
+	require.False(t, resp.Success)
+	require.Equal(t, 3, resp.Attempts)
+	s.AssertExpectations(t)
+	q.AssertExpectations(t)
+}
+
+func TestQueueSubscriptionHandlerMakeShotAndSaveJob(t *testing.T) {
+	s := &mockService{}
+	url := uuid.New().String()
+	s.On("MakeShotAndSave", mock.Anything, url, ShotOptions{}, "").Return([]store.Metadata(nil), errors.New("some error"))
+
+	req := ShotRequest{URL: url, JobID: uuid.New().String(), JobItemID: uuid.New().String()}
+	reqData, err := json.Marshal(req)
+	require.NoError(t, err)
+	msgChan := make(chan queue.Message)
+	q := &mockSubscriberReplier{}
+	q.On("GroupPull", mock.Anything, ShotRequestTopic, subscriptionGroupCapture).Return(msgChan, nil)
+	q.On("GroupPull", mock.Anything, mock.Anything, subscriptionGroupCapture).Return(make(chan queue.Message), nil)
+	q.On("Publish", mock.Anything, JobEventTopic, "", JobEvent{JobID: req.JobID, JobItemID: req.JobItemID, State: store.JobStateRunning}).Return(nil)
+	q.On("Publish", mock.Anything, JobEventTopic, "", mock.MatchedBy(func(e JobEvent) bool {
+		return e.JobID == req.JobID && e.JobItemID == req.JobItemID && e.State == store.JobStateFailed && e.Response.Error != ""
+	})).Return(nil)
+	q.On("Publish", mock.Anything, DeadLetterTopic, "", mock.MatchedBy(func(dl DeadLetter) bool {
+		return dl.FailedRequestID != "" && dl.Request.URL == url && len(dl.Errors) == 1 && dl.Errors[0].Error == "some error"
+	})).Return(nil)
+	h := NewQueueSubscriptionHandler(s, q, nil, nil, nil, time.Second, 2, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, h.Run(ctx))
+	msgChan <- queue.Message{Data: reqData}
+	<-time.After(10 * time.Millisecond)
+	s.AssertExpectations(t)
+	q.AssertExpectations(t)
+}
+
+func TestQueueSubscriptionHandlerMakeShotAndSaveCallback(t *testing.T) {
+	s := &mockService{}
+	url := uuid.New().String()
+	metadata := store.Metadata{ID: uuid.New().String(), Url: url}
+	s.On("MakeShotAndSave", mock.Anything, url, ShotOptions{}, "").Return([]store.Metadata{metadata}, nil)
+
+	req := ShotRequest{URL: url, CallbackURL: "http://" + uuid.New().String()}
+	reqData, err := json.Marshal(req)
+	require.NoError(t, err)
+	msg := queue.Message{Data: reqData, Reply: uuid.New().String()}
+	msgChan := make(chan queue.Message)
+	resp := ShotResponse{Success: true, Metadata: metadata}
+	q := &mockSubscriberReplier{}
+	q.On("GroupPull", mock.Anything, ShotRequestTopic, subscriptionGroupCapture).Return(msgChan, nil)
+	q.On("GroupPull", mock.Anything, mock.Anything, subscriptionGroupCapture).Return(make(chan queue.Message), nil)
+	q.On("Reply", mock.Anything, msg.Reply, resp).Return(nil)
+	cs := &mockCallbackSender{}
+	cs.On("Send", mock.Anything, req.CallbackURL, CallbackPayload{URL: url, ShotResponse: resp}).Return(store.WebhookDelivery{Delivered: true}, nil)
+	h := NewQueueSubscriptionHandler(s, q, cs, nil, nil, time.Second, 2, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, h.Run(ctx))
+	msgChan <- msg
+	<-time.After(10 * time.Millisecond)
+	s.AssertExpectations(t)
+	q.AssertExpectations(t)
+	cs.AssertExpectations(t)
+}
+
+func TestQueueSubscriptionHandlerBoundedWorkers(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	calls, inFlight, maxInFlight := 0, 0, 0
+	s := &mockService{}
+	s.On("MakeShotAndSave", mock.Anything, mock.Anything, ShotOptions{}, "").Run(func(args mock.Arguments) {
+		mu.Lock()
+		calls++
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		<-release
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}).Return([]store.Metadata{{}}, nil)
+	q := queue.NewMemory(10)
+	h := NewQueueSubscriptionHandler(s, q, nil, nil, nil, time.Second, 2, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, h.Run(ctx))
+
+	for i := 0; i < 4; i++ {
+		require.NoError(t, q.Publish(ctx, ShotRequestTopic, "", ShotRequest{URL: uuid.New().String()}))
+	}
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return inFlight == 2
+	})
+	// messages over workers wait in queue until worker is free
+	<-time.After(10 * time.Millisecond)
+	mu.Lock()
+	require.Equal(t, 2, calls)
+	mu.Unlock()
+
+	close(release)
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls == 4
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, 2, maxInFlight)
+}
+
+func TestQueueSubscriptionHandlerSaturatedGroupLosesNothing(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	inFlight := 0
+	handled := map[string]int{}
+	s := &mockService{}
+	s.On("MakeShotAndSave", mock.Anything, mock.Anything, ShotOptions{}, "").Run(func(args mock.Arguments) {
+		mu.Lock()
+		inFlight++
+		handled[args.String(1)]++
+		mu.Unlock()
+		<-release
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}).Return([]store.Metadata{{}}, nil)
+	q := queue.NewMemory(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// every member of capture group has single worker
+	for i := 0; i < 2; i++ {
+		require.NoError(t, NewQueueSubscriptionHandler(s, q, nil, nil, nil, time.Second, 1, nil).Run(ctx))
+	}
+
+	var urls []string
+	for i := 0; i < 2; i++ {
+		urls = append(urls, uuid.New().String())
+		require.NoError(t, q.Publish(ctx, ShotRequestTopic, "", ShotRequest{URL: urls[i]}))
+	}
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return inFlight == 2
+	})
+	// published while every member is busy
+	for i := 0; i < 6; i++ {
+		url := uuid.New().String()
+		urls = append(urls, url)
+		require.NoError(t, q.Publish(ctx, PriorityBulk.Topic(), "", ShotRequest{URL: url, Priority: PriorityBulk}))
+	}
+	close(release)
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(handled) == len(urls)
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	for _, url := range urls {
+		require.Equal(t, 1, handled[url], url)
+	}
+}
+
+// waitFor polls condition up to a second
+func waitFor(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition is not satisfied in time")
+		}
+		<-time.After(time.Millisecond)
+	}
+}
+
+func TestQueueSubscriptionHandlerStopWaitsInFlight(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	url := uuid.New().String()
+	s := &mockService{}
+	s.On("MakeShotAndSave", mock.Anything, url, ShotOptions{}, "").Run(func(args mock.Arguments) {
+		close(started)
+		<-release
+	}).Return([]store.Metadata{{Url: url}}, nil)
+	q := queue.NewMemory(10)
+	h := NewQueueSubscriptionHandler(s, q, nil, nil, nil, time.Second, 2, nil)
+	require.NoError(t, h.Run(context.Background()))
+
+	reply := uuid.New().String()
+	replies, err := q.Subscribe(context.Background(), reply)
+	require.NoError(t, err)
+	require.NoError(t, q.Publish(context.Background(), ShotRequestTopic, reply, ShotRequest{URL: url}))
+	<-started
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.Error(t, h.Stop(stopCtx))
+
+	stopped := make(chan error)
+	go func() {
+		stopped <- h.Stop(context.Background())
+	}()
+	close(release)
+	require.NoError(t, <-stopped)
+	select {
+	case msg := <-replies:
+		var resp ShotResponse
+		require.NoError(t, json.Unmarshal(msg.Data, &resp))
+		require.True(t, resp.Success)
+	default:
+		t.Fatal("in-flight capture is not replied before stop")
+	}
+}
+
+func TestQueueSubscriptionHandlerStopWaitsCallbacks(t *testing.T) {
+	url := uuid.New().String()
+	s := &mockService{}
+	s.On("MakeShotAndSave", mock.Anything, url, ShotOptions{}, "").Return([]store.Metadata{{Url: url}}, nil)
+	release := make(chan struct{})
+	sent := make(chan struct{})
+	cs := &mockCallbackSender{}
+	cs.On("Send", mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		close(sent)
+		<-release
+	}).Return(store.WebhookDelivery{Delivered: true}, nil)
+	q := queue.NewMemory(10)
+	h := NewQueueSubscriptionHandler(s, q, cs, nil, nil, time.Second, 2, nil)
+	require.NoError(t, h.Run(context.Background()))
+	require.NoError(t, q.Publish(context.Background(), ShotRequestTopic, "", ShotRequest{URL: url, CallbackURL: "http://" + uuid.New().String()}))
+	<-sent
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.Error(t, h.Stop(stopCtx))
+	close(release)
+	require.NoError(t, h.Stop(context.Background()))
+}
+
+func TestQueueSubscriptionHandlerMakeShotAndSaveDeadLetterAfterTimeout(t *testing.T) {
+	url := uuid.New().String()
+	s := &mockService{}
+	s.On("MakeShotAndSave", mock.Anything, url, ShotOptions{}, "").Return([]store.Metadata{}, context.DeadlineExceeded)
+	q := &mockSubscriberReplier{}
+	q.On("Publish", mock.Anything, DeadLetterTopic, "", mock.Anything).Run(func(args mock.Arguments) {
+		// message context is done, dead letter is still published
+		require.NoError(t, args.Get(0).(context.Context).Err())
+	}).Return(nil)
+	h := NewQueueSubscriptionHandler(s, q, nil, nil, nil, time.Second, 2, nil)
+	reqData, err := json.Marshal(ShotRequest{URL: url})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	h.makeShotAndSave(ctx, reqData)
+	q.AssertExpectations(t)
+}
+
+type mockHostWaiter struct {
+	mock.Mock
+}
+
+func (m *mockHostWaiter) Wait(ctx context.Context, url string) (func(), error) {
+	args := m.Called(ctx, url)
+	return args.Get(0).(func()), args.Error(1)
+}
+
+func (m *mockHostWaiter) MaxWait(url string) time.Duration {
+	return time.Second
+}
+
+func TestQueueSubscriptionHandlerMakeShotAndSaveHostLimitTimeout(t *testing.T) {
+	s := &mockService{}
+	url := uuid.New().String()
+	hl := &mockHostWaiter{}
+	hl.On("Wait", mock.Anything, url).Return(func() {}, &HostLimitTimeoutError{Host: url, MaxWait: time.Second, Err: context.DeadlineExceeded})
+	req := ShotRequest{URL: url, JobID: uuid.New().String(), Priority: PriorityBulk}
+	reqData, err := json.Marshal(req)
+	require.NoError(t, err)
+	// request goes back to its lane instead of dead letter and job item stays queued
+	q := &mockSubscriberReplier{}
+	q.On("Publish", mock.Anything, PriorityBulk.Topic(), "", req).Return(nil)
+	h := NewQueueSubscriptionHandler(s, q, nil, hl, nil, time.Second, 2, nil)
+	resp := h.makeShotAndSave(context.Background(), reqData).(ShotResponse)
+	require.False(t, resp.Success)
+	require.Contains(t, resp.Error, "host limits")
+	require.Equal(t, ErrorClassHostLimitTimeout, resp.ErrorCode)
+	s.AssertExpectations(t)
+	q.AssertExpectations(t)
+}
+
+func TestQueueSubscriptionHandlerMakeShotAndSaveRobotsDisallowed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+	}))
+	defer srv.Close()
+	s := &mockService{}
+	req := ShotRequest{URL: srv.URL + "/private/page"}
+	reqData, err := json.Marshal(req)
+	require.NoError(t, err)
+	// no dead letter is expected, so publish fails the test
+	q := &mockSubscriberReplier{}
+	rc := NewRobotsChecker(RobotsConfig{Enabled: true})
+	h := NewQueueSubscriptionHandler(s, q, nil, nil, rc, time.Second, 2, nil)
+	resp := h.makeShotAndSave(context.Background(), reqData).(ShotResponse)
+	require.False(t, resp.Success)
+	require.Equal(t, ErrorClassRobotsDisallowed, resp.ErrorCode)
+	s.AssertExpectations(t)
+	q.AssertExpectations(t)
+}
+
+func TestUndeliveredDeadLetter(t *testing.T) {
+	req := ShotRequest{URL: "http://example.com", FailedRequestID: uuid.New().String()}
+	data, err := json.Marshal(req)
+	require.NoError(t, err)
+	topic, msg := UndeliveredDeadLetter(data, 5)
+	require.Equal(t, DeadLetterTopic, topic)
+	dl := msg.(DeadLetter)
+	require.Equal(t, req.FailedRequestID, dl.FailedRequestID)
+	require.Equal(t, req, dl.Request)
+	require.Len(t, dl.Errors, 1)
+	require.Equal(t, 5, dl.Errors[0].Attempt)
+
+	_, msg = UndeliveredDeadLetter([]byte("{"), 5)
+	dl = msg.(DeadLetter)
+	require.NotEmpty(t, dl.FailedRequestID)
+	require.Contains(t, dl.Errors[0].Error, "malformed")
+}
@@ -0,0 +1,192 @@
+package capture
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	neturl "net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type HostLimit struct {
+	// maximum number of captures of the same host running at once across all capture instances
+	MaxConcurrency int `yaml:"max_concurrency"`
+	// maximum number of captures of the same host started per second across all capture instances
+	RequestsPerSecond float64 `yaml:"requests_per_second"`
+}
+
+func (l HostLimit) enabled() bool {
+	return l.MaxConcurrency > 0 || l.RequestsPerSecond > 0
+}
+
+type HostLimitConfig struct {
+	// limit of every host. zero values disable limits
+	Default HostLimit `yaml:"default"`
+	// limits of particular hosts, e.g. "example.com"
+	Hosts map[string]HostLimit `yaml:"hosts"`
+	// slot of crashed capture instance is freed after lease. must be greater than capture request timeout
+	Lease time.Duration `yaml:"lease"`
+	// how often busy host is checked for free slot
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// request is delayed by host limits at most this period, then it fails
+	MaxWait time.Duration `yaml:"max_wait"`
+}
+
+const (
+	defaultHostLease        = 2 * time.Minute
+	defaultHostPollInterval = 200 * time.Millisecond
+	defaultHostMaxWait      = 5 * time.Minute
+)
+
+func (c HostLimitConfig) withDefaults() HostLimitConfig {
+	if c.Lease <= 0 {
+		c.Lease = defaultHostLease
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = defaultHostPollInterval
+	}
+	if c.MaxWait <= 0 {
+		c.MaxWait = defaultHostMaxWait
+	}
+	return c
+}
+
+func (c HostLimitConfig) limit(host string) HostLimit {
+	if l, ok := c.Hosts[host]; ok {
+		return l
+	}
+	return c.Default
+}
+
+// HostLimitTimeoutError is returned when host limits do not let capture start within max wait. host is busy rather
+// than broken, so request is worth queueing again
+type HostLimitTimeoutError struct {
+	Host    string
+	MaxWait time.Duration
+	Err     error
+}
+
+func (e *HostLimitTimeoutError) Error() string {
+	return fmt.Sprintf(`timeout waiting for host limits: [host: %s, max_wait: %s, error: %s]`, e.Host, e.MaxWait, e.Err)
+}
+
+func (e *HostLimitTimeoutError) Unwrap() error {
+	return e.Err
+}
+
+type hostLimitStore interface {
+	AcquireSlot(ctx context.Context, host, holder string, slots int, lease time.Duration) (bool, error)
+	ReleaseSlot(ctx context.Context, host, holder string) error
+	ReserveRate(ctx context.Context, host string, interval time.Duration, deadline time.Time) (time.Time, bool, error)
+}
+
+// HostLimiter delays captures of host which reached its concurrency or request rate. limits are shared through
+// database by every capture instance
+type HostLimiter struct {
+	st  hostLimitStore
+	cfg HostLimitConfig
+}
+
+func NewHostLimiter(st hostLimitStore, cfg HostLimitConfig) *HostLimiter {
+	return &HostLimiter{st: st, cfg: cfg.withDefaults()}
+}
+
+// hostLimit returns host of url and its limit. it returns false when no limit applies
+func (l *HostLimiter) hostLimit(url string) (string, HostLimit, bool) {
+	u, err := neturl.Parse(url)
+	if err != nil || u.Hostname() == "" {
+		// invalid url fails on navigation
+		return "", HostLimit{}, false
+	}
+	host := strings.ToLower(u.Hostname())
+	limit := l.cfg.limit(host)
+	return host, limit, limit.enabled()
+}
+
+// MaxWait is the longest period capture of url can be delayed by host limits. it is zero when no limit applies
+func (l *HostLimiter) MaxWait(url string) time.Duration {
+	if _, _, ok := l.hostLimit(url); !ok {
+		return 0
+	}
+	return l.cfg.MaxWait
+}
+
+// Wait blocks until host of url has free slot and its request rate allows next capture. returned func releases slot.
+// it returns *HostLimitTimeoutError when host is still busy after max wait
+func (l *HostLimiter) Wait(ctx context.Context, url string) (func(), error) {
+	host, limit, ok := l.hostLimit(url)
+	if !ok {
+		return func() {}, nil
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, l.cfg.MaxWait)
+	defer cancel()
+	release := func() {}
+	var err error
+	if limit.MaxConcurrency > 0 {
+		if release, err = l.acquire(waitCtx, host, limit.MaxConcurrency); err != nil {
+			return nil, l.timeoutError(ctx, host, err)
+		}
+	}
+	if limit.RequestsPerSecond > 0 {
+		if err = l.waitRate(waitCtx, host, limit.RequestsPerSecond); err != nil {
+			release()
+			return nil, l.timeoutError(ctx, host, err)
+		}
+	}
+	return release, nil
+}
+
+// timeoutError wraps err of wait which ran out of max wait. failure of store or parent context is returned as is
+func (l *HostLimiter) timeoutError(ctx context.Context, host string, err error) error {
+	if ctx.Err() != nil || !errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return &HostLimitTimeoutError{Host: host, MaxWait: l.cfg.MaxWait, Err: err}
+}
+
+func (l *HostLimiter) acquire(ctx context.Context, host string, slots int) (func(), error) {
+	holder := uuid.New().String()
+	for {
+		ok, err := l.st.AcquireSlot(ctx, host, holder, slots, l.cfg.Lease)
+		if err != nil {
+			return nil, fmt.Errorf(`failed to acquire host slot: [host: %s, error: %w]`, host, err)
+		}
+		if ok {
+			break
+		}
+		select {
+		case <-time.After(l.cfg.PollInterval):
+		case <-ctx.Done():
+			return nil, fmt.Errorf(`timeout waiting for free host slot: [host: %s, max_concurrency: %d, error: %w]`, host, slots, ctx.Err())
+		}
+	}
+	return func() {
+		if err := l.st.ReleaseSlot(context.Background(), host, holder); err != nil {
+			log.Println(fmt.Sprintf(`failed to release host slot: [host: %s, error: %s]`, host, err))
+		}
+	}, nil
+}
+
+// waitRate reserves request time of host only when it comes before ctx deadline. reservation which would outlive max
+// wait is refused right away, otherwise requests given up on would push next request time ever further and starve host
+func (l *HostLimiter) waitRate(ctx context.Context, host string, rps float64) error {
+	interval := time.Duration(float64(time.Second) / rps)
+	deadline, _ := ctx.Deadline()
+	at, ok, err := l.st.ReserveRate(ctx, host, interval, deadline)
+	if err != nil {
+		return fmt.Errorf(`failed to reserve host request rate: [host: %s, error: %w]`, host, err)
+	}
+	if !ok {
+		return fmt.Errorf(`host request rate is reserved past max wait: [host: %s, requests_per_second: %v, next_at: %s, error: %w]`, host, rps, at, context.DeadlineExceeded)
+	}
+	select {
+	case <-time.After(time.Until(at)):
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf(`timeout waiting for host request rate: [host: %s, requests_per_second: %v, error: %w]`, host, rps, ctx.Err())
+	}
+}
@@ -0,0 +1,84 @@
+package capture
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type mockHostLimitStore struct {
+	mock.Mock
+}
+
+func (m *mockHostLimitStore) AcquireSlot(ctx context.Context, host, holder string, slots int, lease time.Duration) (bool, error) {
+	args := m.Called(ctx, host, holder, slots, lease)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *mockHostLimitStore) ReleaseSlot(ctx context.Context, host, holder string) error {
+	return m.Called(ctx, host, holder).Error(0)
+}
+
+func (m *mockHostLimitStore) ReserveRate(ctx context.Context, host string, interval time.Duration, deadline time.Time) (time.Time, bool, error) {
+	args := m.Called(ctx, host, interval, deadline)
+	return args.Get(0).(time.Time), args.Bool(1), args.Error(2)
+}
+
+func TestHostLimiter_WaitDelaysBusyHost(t *testing.T) {
+	st := &mockHostLimitStore{}
+	st.On("AcquireSlot", mock.Anything, "example.com", mock.Anything, 2, time.Minute).Return(false, nil).Twice()
+	st.On("AcquireSlot", mock.Anything, "example.com", mock.Anything, 2, time.Minute).Return(true, nil).Once()
+	st.On("ReserveRate", mock.Anything, "example.com", 500*time.Millisecond, mock.Anything).Return(time.Now().Add(20*time.Millisecond), true, nil)
+	st.On("ReleaseSlot", mock.Anything, "example.com", mock.Anything).Return(nil)
+	l := NewHostLimiter(st, HostLimitConfig{
+		Hosts:        map[string]HostLimit{"example.com": {MaxConcurrency: 2, RequestsPerSecond: 2}},
+		Lease:        time.Minute,
+		PollInterval: 10 * time.Millisecond,
+	})
+	start := time.Now()
+	release, err := l.Wait(context.Background(), "https://Example.com:8443/pricing")
+	require.NoError(t, err)
+	require.True(t, time.Since(start) >= 20*time.Millisecond)
+	release()
+	st.AssertExpectations(t)
+}
+
+func TestHostLimiter_WaitTimeout(t *testing.T) {
+	st := &mockHostLimitStore{}
+	st.On("AcquireSlot", mock.Anything, "example.com", mock.Anything, 1, mock.Anything).Return(false, nil)
+	l := NewHostLimiter(st, HostLimitConfig{Default: HostLimit{MaxConcurrency: 1}, PollInterval: time.Millisecond, MaxWait: 20 * time.Millisecond})
+	require.Equal(t, 20*time.Millisecond, l.MaxWait("http://example.com"))
+	_, err := l.Wait(context.Background(), "http://example.com")
+	var limitErr *HostLimitTimeoutError
+	require.True(t, errors.As(err, &limitErr))
+	require.Equal(t, "example.com", limitErr.Host)
+}
+
+func TestHostLimiter_WaitWithoutLimits(t *testing.T) {
+	st := &mockHostLimitStore{}
+	l := NewHostLimiter(st, HostLimitConfig{Hosts: map[string]HostLimit{"example.com": {MaxConcurrency: 1}}})
+	require.Zero(t, l.MaxWait("http://other.com"))
+	release, err := l.Wait(context.Background(), "http://other.com")
+	require.NoError(t, err)
+	release()
+	st.AssertExpectations(t)
+}
+
+func TestHostLimiter_WaitRefusedRateReservation(t *testing.T) {
+	st := &mockHostLimitStore{}
+	st.On("ReserveRate", mock.Anything, "example.com", time.Second, mock.MatchedBy(func(deadline time.Time) bool {
+		return time.Until(deadline) <= time.Minute && time.Until(deadline) > 0
+	})).Return(time.Now().Add(time.Hour), false, nil)
+	l := NewHostLimiter(st, HostLimitConfig{Default: HostLimit{RequestsPerSecond: 1}, MaxWait: time.Minute})
+	start := time.Now()
+	_, err := l.Wait(context.Background(), "http://example.com")
+	var limitErr *HostLimitTimeoutError
+	require.True(t, errors.As(err, &limitErr))
+	// refused reservation is not waited for
+	require.True(t, time.Since(start) < time.Second)
+	st.AssertExpectations(t)
+}
@@ -0,0 +1,141 @@
+package capture
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type ShotOptions struct {
+	Format            string  `json:"format,omitempty" yaml:"format"`
+	Quality           int     `json:"quality,omitempty" yaml:"quality"`
+	ViewportWidth     int     `json:"viewport_width,omitempty" yaml:"viewport_width"`
+	ViewportHeight    int     `json:"viewport_height,omitempty" yaml:"viewport_height"`
+	DeviceScaleFactor float64 `json:"device_scale_factor,omitempty" yaml:"device_scale_factor"`
+	// nil keeps default, so false can override default true
+	FullPage *bool  `json:"full_page,omitempty" yaml:"full_page"`
+	DelayMS  int    `json:"delay_ms,omitempty" yaml:"delay_ms"`
+	Device   string `json:"device,omitempty" yaml:"device"`
+	// wait conditions checked after page stopped loading in order: network idle, selector, expression, delay
+	WaitNetworkIdleMS int    `json:"wait_network_idle_ms,omitempty" yaml:"wait_network_idle_ms"`
+	WaitSelector      string `json:"wait_selector,omitempty" yaml:"wait_selector"`
+	WaitExpression    string `json:"wait_expression,omitempty" yaml:"wait_expression"`
+	// css selectors of elements captured instead of whole page. every element is saved as separate file
+	Selectors []string `json:"selectors,omitempty" yaml:"selectors"`
+	// used only with pdf format
+	PDF *PDFOptions `json:"pdf,omitempty" yaml:"pdf"`
+}
+
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+	FormatPDF  = "pdf"
+
+	maxQuality   = 100
+	maxDelayMS   = 60000
+	maxSelectors = 20
+)
+
+// Bool returns pointer to b for boolean options, which are nil when not set
+func Bool(b bool) *bool {
+	return &b
+}
+
+func boolValue(b *bool) bool {
+	return b != nil && *b
+}
+
+func (o ShotOptions) Validate() error {
+	switch o.Format {
+	case "", FormatJPEG, FormatPNG, FormatPDF:
+	default:
+		return fmt.Errorf(`unsupported format %s. please use one of (jpeg, png, pdf)`, o.Format)
+	}
+	if _, ok := GetDevice(o.Device); o.Device != "" && !ok {
+		return fmt.Errorf(`unknown device %s. please use one of the device presets`, o.Device)
+	}
+	if o.Quality < 0 || o.Quality > maxQuality {
+		return fmt.Errorf(`quality out of range: [quality: %d, min: 0, max: %d]`, o.Quality, maxQuality)
+	}
+	if o.ViewportWidth < 0 || o.ViewportHeight < 0 || o.DeviceScaleFactor < 0 {
+		return fmt.Errorf(`viewport parameters can not be negative: [width: %d, height: %d, device_scale_factor: %v]`,
+			o.ViewportWidth, o.ViewportHeight, o.DeviceScaleFactor)
+	}
+	if o.DelayMS < 0 || o.DelayMS > maxDelayMS {
+		return fmt.Errorf(`delay out of range: [delay_ms: %d, min: 0, max: %d]`, o.DelayMS, maxDelayMS)
+	}
+	if o.WaitNetworkIdleMS < 0 || o.WaitNetworkIdleMS > maxDelayMS {
+		return fmt.Errorf(`network idle wait out of range: [wait_network_idle_ms: %d, min: 0, max: %d]`, o.WaitNetworkIdleMS, maxDelayMS)
+	}
+	if len(o.Selectors) > maxSelectors {
+		return fmt.Errorf(`too many selectors: [count: %d, max: %d]`, len(o.Selectors), maxSelectors)
+	}
+	for _, selector := range o.Selectors {
+		if strings.TrimSpace(selector) == "" {
+			return errors.New("selector can not be empty")
+		}
+	}
+	if o.Format == FormatPDF && len(o.Selectors) > 0 {
+		return errors.New("selectors are not supported with pdf format")
+	}
+	if o.PDF != nil {
+		if err := o.PDF.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o ShotOptions) WithDefaults(defaults ShotOptions) ShotOptions {
+	if o.Format == "" {
+		o.Format = defaults.Format
+	}
+	if o.Quality == 0 {
+		o.Quality = defaults.Quality
+	}
+	if o.ViewportWidth == 0 {
+		o.ViewportWidth = defaults.ViewportWidth
+	}
+	if o.ViewportHeight == 0 {
+		o.ViewportHeight = defaults.ViewportHeight
+	}
+	if o.DeviceScaleFactor == 0 {
+		o.DeviceScaleFactor = defaults.DeviceScaleFactor
+	}
+	if o.FullPage == nil {
+		o.FullPage = defaults.FullPage
+	}
+	if o.DelayMS == 0 {
+		o.DelayMS = defaults.DelayMS
+	}
+	if o.Device == "" {
+		o.Device = defaults.Device
+	}
+	if o.WaitNetworkIdleMS == 0 {
+		o.WaitNetworkIdleMS = defaults.WaitNetworkIdleMS
+	}
+	if o.WaitSelector == "" {
+		o.WaitSelector = defaults.WaitSelector
+	}
+	if o.WaitExpression == "" {
+		o.WaitExpression = defaults.WaitExpression
+	}
+	if len(o.Selectors) == 0 {
+		o.Selectors = defaults.Selectors
+	}
+	if o.PDF == nil {
+		o.PDF = defaults.PDF
+	} else if defaults.PDF != nil {
+		pdf := o.PDF.withDefaults(*defaults.PDF)
+		o.PDF = &pdf
+	}
+	return o
+}
+
+func (o ShotOptions) withDevice() ShotOptions {
+	d, ok := GetDevice(o.Device)
+	if !ok {
+		return o
+	}
+	return o.WithDefaults(ShotOptions{ViewportWidth: d.Width, ViewportHeight: d.Height, DeviceScaleFactor: d.DeviceScaleFactor})
+}
@@ -0,0 +1,84 @@
+package capture
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShotOptions_WithDefaults(t *testing.T) {
+	defaults := ShotOptions{Format: FormatJPEG, Quality: 80, ViewportWidth: 1280, ViewportHeight: 800, FullPage: Bool(true)}
+	opt := ShotOptions{Format: FormatPNG, ViewportHeight: 600, DelayMS: 500}
+	require.Equal(t, ShotOptions{Format: FormatPNG, Quality: 80, ViewportWidth: 1280, ViewportHeight: 600, FullPage: Bool(true), DelayMS: 500},
+		opt.WithDefaults(defaults))
+}
+
+func TestShotOptions_WithDefaultsFalseOverride(t *testing.T) {
+	defaults := ShotOptions{FullPage: Bool(true), PDF: &PDFOptions{Landscape: Bool(true), PrintBackground: Bool(true)}}
+	opt := ShotOptions{FullPage: Bool(false), PDF: &PDFOptions{Landscape: Bool(false), PrintBackground: Bool(false)}}.WithDefaults(defaults)
+	require.False(t, *opt.FullPage)
+	require.False(t, *opt.PDF.Landscape)
+	require.False(t, *opt.PDF.PrintBackground)
+	args := opt.PDF.printArgs()
+	require.False(t, *args.Landscape)
+	require.False(t, *args.PrintBackground)
+	// options which are not set keep defaults
+	opt = ShotOptions{PDF: &PDFOptions{}}.WithDefaults(defaults)
+	require.True(t, *opt.FullPage)
+	require.True(t, *opt.PDF.Landscape)
+}
+
+func TestShotOptions_WithDefaultsWaitConditions(t *testing.T) {
+	defaults := ShotOptions{WaitNetworkIdleMS: 500, WaitSelector: "#app"}
+	opt := ShotOptions{WaitSelector: ".content", WaitExpression: "window.ready"}
+	require.Equal(t, ShotOptions{WaitNetworkIdleMS: 500, WaitSelector: ".content", WaitExpression: "window.ready"}, opt.WithDefaults(defaults))
+}
+
+func TestShotOptions_Validate(t *testing.T) {
+	require.NoError(t, ShotOptions{}.Validate())
+	require.NoError(t, ShotOptions{Format: FormatPNG, Quality: 100, ViewportWidth: 375, ViewportHeight: 812, DeviceScaleFactor: 3}.Validate())
+	require.Error(t, ShotOptions{Format: "gif"}.Validate())
+	require.Error(t, ShotOptions{Quality: 101}.Validate())
+	require.Error(t, ShotOptions{ViewportWidth: -1}.Validate())
+	require.Error(t, ShotOptions{DelayMS: maxDelayMS + 1}.Validate())
+	require.NoError(t, ShotOptions{Device: "iphone-x"}.Validate())
+	require.Error(t, ShotOptions{Device: "nokia-3310"}.Validate())
+	require.NoError(t, ShotOptions{WaitNetworkIdleMS: 500, WaitSelector: "#app", WaitExpression: "window.ready"}.Validate())
+	require.Error(t, ShotOptions{WaitNetworkIdleMS: -1}.Validate())
+	require.NoError(t, ShotOptions{Selectors: []string{"header", ".pricing table"}}.Validate())
+	require.Error(t, ShotOptions{Selectors: []string{" "}}.Validate())
+	require.Error(t, ShotOptions{Selectors: make([]string, maxSelectors+1)}.Validate())
+	margin := 0.5
+	negative := -1.0
+	require.NoError(t, ShotOptions{Format: FormatPDF, PDF: &PDFOptions{PaperSize: "a4", MarginTop: &margin}}.Validate())
+	require.Error(t, ShotOptions{Format: FormatPDF, PDF: &PDFOptions{PaperSize: "b7"}}.Validate())
+	require.Error(t, ShotOptions{Format: FormatPDF, PDF: &PDFOptions{MarginLeft: &negative}}.Validate())
+	require.Error(t, ShotOptions{Format: FormatPDF, Selectors: []string{"header"}}.Validate())
+}
+
+func TestShotOptions_WithDevice(t *testing.T) {
+	opt := ShotOptions{Device: "iphone-x", ViewportHeight: 2000}
+	require.Equal(t, ShotOptions{Device: "iphone-x", ViewportWidth: 375, ViewportHeight: 2000, DeviceScaleFactor: 3}, opt.withDevice())
+	require.Equal(t, ShotOptions{ViewportWidth: 100}, ShotOptions{ViewportWidth: 100}.withDevice())
+}
+
+func TestShotOptions_WithDefaultsPDF(t *testing.T) {
+	zero, one := 0.0, 1.0
+	defaults := ShotOptions{Format: FormatJPEG, PDF: &PDFOptions{PaperSize: "a4", PrintBackground: Bool(true), MarginTop: &one, MarginBottom: &one}}
+	opt := ShotOptions{Format: FormatPDF, PDF: &PDFOptions{Landscape: Bool(true), MarginTop: &zero}}.WithDefaults(defaults)
+	require.Equal(t, &PDFOptions{PaperSize: "a4", Landscape: Bool(true), PrintBackground: Bool(true), MarginTop: &zero, MarginBottom: &one}, opt.PDF)
+	require.Equal(t, defaults.PDF, ShotOptions{}.WithDefaults(defaults).PDF)
+	// defaults must not be modified by merge
+	require.Equal(t, &one, defaults.PDF.MarginTop)
+}
+
+func TestPDFOptions_PrintArgs(t *testing.T) {
+	zero := 0.0
+	args := PDFOptions{PaperSize: "letter", Landscape: Bool(true), MarginLeft: &zero}.printArgs()
+	require.Equal(t, 8.5, *args.PaperWidth)
+	require.Equal(t, 11.0, *args.PaperHeight)
+	require.True(t, *args.Landscape)
+	require.False(t, *args.PrintBackground)
+	require.Equal(t, 0.0, *args.MarginLeft)
+	require.Nil(t, args.MarginTop)
+}
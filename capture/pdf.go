@@ -0,0 +1,92 @@
+package capture
+
+import (
+	"fmt"
+
+	"github.com/mafredri/cdp/protocol/page"
+)
+
+type PDFOptions struct {
+	PaperSize string `json:"paper_size,omitempty" yaml:"paper_size"`
+	// nil keeps default, so false can override default true
+	Landscape       *bool `json:"landscape,omitempty" yaml:"landscape"`
+	PrintBackground *bool `json:"print_background,omitempty" yaml:"print_background"`
+	// margins in inches. chrome default (1cm) is used when not set
+	MarginTop    *float64 `json:"margin_top,omitempty" yaml:"margin_top"`
+	MarginBottom *float64 `json:"margin_bottom,omitempty" yaml:"margin_bottom"`
+	MarginLeft   *float64 `json:"margin_left,omitempty" yaml:"margin_left"`
+	MarginRight  *float64 `json:"margin_right,omitempty" yaml:"margin_right"`
+}
+
+type paperSize struct {
+	width, height float64
+}
+
+// paper sizes in inches
+var paperSizes = map[string]paperSize{
+	"letter":  {width: 8.5, height: 11},
+	"legal":   {width: 8.5, height: 14},
+	"tabloid": {width: 11, height: 17},
+	"a3":      {width: 11.69, height: 16.54},
+	"a4":      {width: 8.27, height: 11.69},
+	"a5":      {width: 5.83, height: 8.27},
+}
+
+func (o PDFOptions) validate() error {
+	if _, ok := paperSizes[o.PaperSize]; o.PaperSize != "" && !ok {
+		return fmt.Errorf(`unsupported paper size %s. please use one of (letter, legal, tabloid, a3, a4, a5)`, o.PaperSize)
+	}
+	for _, m := range []*float64{o.MarginTop, o.MarginBottom, o.MarginLeft, o.MarginRight} {
+		if m != nil && *m < 0 {
+			return fmt.Errorf(`pdf margins can not be negative: [margin: %v]`, *m)
+		}
+	}
+	return nil
+}
+
+func (o PDFOptions) withDefaults(defaults PDFOptions) PDFOptions {
+	if o.PaperSize == "" {
+		o.PaperSize = defaults.PaperSize
+	}
+	if o.Landscape == nil {
+		o.Landscape = defaults.Landscape
+	}
+	if o.PrintBackground == nil {
+		o.PrintBackground = defaults.PrintBackground
+	}
+	if o.MarginTop == nil {
+		o.MarginTop = defaults.MarginTop
+	}
+	if o.MarginBottom == nil {
+		o.MarginBottom = defaults.MarginBottom
+	}
+	if o.MarginLeft == nil {
+		o.MarginLeft = defaults.MarginLeft
+	}
+	if o.MarginRight == nil {
+		o.MarginRight = defaults.MarginRight
+	}
+	return o
+}
+
+func (o PDFOptions) printArgs() *page.PrintToPDFArgs {
+	args := page.NewPrintToPDFArgs().
+		SetLandscape(boolValue(o.Landscape)).
+		SetPrintBackground(boolValue(o.PrintBackground))
+	if size, ok := paperSizes[o.PaperSize]; ok {
+		args.SetPaperWidth(size.width).SetPaperHeight(size.height)
+	}
+	if o.MarginTop != nil {
+		args.SetMarginTop(*o.MarginTop)
+	}
+	if o.MarginBottom != nil {
+		args.SetMarginBottom(*o.MarginBottom)
+	}
+	if o.MarginLeft != nil {
+		args.SetMarginLeft(*o.MarginLeft)
+	}
+	if o.MarginRight != nil {
+		args.SetMarginRight(*o.MarginRight)
+	}
+	return args
+}
@@ -0,0 +1,184 @@
+package capture
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/leveldorado/screenshot/queue"
+)
+
+// Priority selects queue lane of shot request. interactive requests use higher lane so they are not
+// queued behind large batches
+type Priority string
+
+const (
+	PriorityHigh   Priority = "high"
+	PriorityNormal Priority = "normal"
+	PriorityBulk   Priority = "bulk"
+)
+
+// priorities are ordered from the highest, the first one wins when lanes are even
+var priorities = []Priority{PriorityHigh, PriorityNormal, PriorityBulk}
+
+func (p Priority) Validate() error {
+	switch p {
+	case PriorityHigh, PriorityNormal, PriorityBulk, "":
+		return nil
+	default:
+		return fmt.Errorf(`unsupported priority %s. please use one of (high, normal, bulk)`, p)
+	}
+}
+
+// Topic returns shot request topic of priority lane. normal lane keeps original topic, so requests published
+// before lanes were introduced are still handled
+func (p Priority) Topic() string {
+	switch p {
+	case PriorityHigh:
+		return ShotRequestTopic + "_high"
+	case PriorityBulk:
+		return ShotRequestTopic + "_bulk"
+	default:
+		return ShotRequestTopic
+	}
+}
+
+// ShotRequestTopics returns topics of all priority lanes
+func ShotRequestTopics() []string {
+	var list []string
+	for _, p := range priorities {
+		list = append(list, p.Topic())
+	}
+	return list
+}
+
+// PriorityWeights is share of free workers given to lane while other lanes have messages too
+type PriorityWeights map[Priority]int
+
+var defaultPriorityWeights = PriorityWeights{PriorityHigh: 6, PriorityNormal: 3, PriorityBulk: 1}
+
+func (w PriorityWeights) withDefaults() PriorityWeights {
+	res := PriorityWeights{}
+	for _, p := range priorities {
+		res[p] = w[p]
+		if res[p] <= 0 {
+			res[p] = defaultPriorityWeights[p]
+		}
+	}
+	return res
+}
+
+// laneSelector picks next message by smooth weighted round robin among lanes which have message ready, so with
+// default weights out of every 10 messages handled under load 6 are high, 3 normal and 1 bulk
+type laneSelector struct {
+	weights PriorityWeights
+	// kept between subscriptions so pause does not reset the order
+	current map[Priority]int
+}
+
+func newLaneSelector(weights PriorityWeights) *laneSelector {
+	return &laneSelector{weights: weights.withDefaults(), current: map[Priority]int{}}
+}
+
+// laneSubscription is group subscription of every lane. lanes are indexed in priorities order
+type laneSubscription struct {
+	subs []<-chan queue.Message
+	// lane takes message from queue only when it is asked on demand, so at most one message of lane waits for worker.
+	// demand channel holds single request, lane which has not taken it yet is not asked again
+	demand []chan struct{}
+	// message taken from lane while looking for ready lanes and waiting for selection
+	pending []*queue.Message
+}
+
+// newLaneDemand returns demand channel of every lane
+func newLaneDemand() []chan struct{} {
+	var demand []chan struct{}
+	for range priorities {
+		demand = append(demand, make(chan struct{}, 1))
+	}
+	return demand
+}
+
+func newLaneSubscription(subs []<-chan queue.Message, demand []chan struct{}) *laneSubscription {
+	return &laneSubscription{subs: subs, demand: demand, pending: make([]*queue.Message, len(subs))}
+}
+
+// next returns next message and its priority. it returns false when every lane is closed and no message is pending
+func (s *laneSelector) next(ls *laneSubscription) (queue.Message, Priority, bool) {
+	for {
+		ready, open := ls.poll()
+		if ready {
+			return s.pick(ls)
+		}
+		if !open {
+			return queue.Message{}, "", false
+		}
+		ls.wait()
+	}
+}
+
+// poll asks every lane without pending message for the next one and takes it when it is ready without blocking
+func (ls *laneSubscription) poll() (ready, open bool) {
+	for i, sub := range ls.subs {
+		if ls.pending[i] == nil && sub != nil {
+			select {
+			case ls.demand[i] <- struct{}{}:
+			default:
+			}
+			select {
+			case msg, ok := <-sub:
+				ls.receive(i, msg, ok)
+			default:
+			}
+		}
+		ready = ready || ls.pending[i] != nil
+		open = open || ls.subs[i] != nil
+	}
+	return ready, open
+}
+
+// wait blocks until any open lane has message or is closed
+func (ls *laneSubscription) wait() {
+	var cases []reflect.SelectCase
+	var index []int
+	for i, sub := range ls.subs {
+		if sub == nil {
+			continue
+		}
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(sub)})
+		index = append(index, i)
+	}
+	chosen, value, ok := reflect.Select(cases)
+	var msg queue.Message
+	if ok {
+		msg = value.Interface().(queue.Message)
+	}
+	ls.receive(index[chosen], msg, ok)
+}
+
+func (ls *laneSubscription) receive(i int, msg queue.Message, ok bool) {
+	if !ok {
+		ls.subs[i] = nil
+		return
+	}
+	ls.pending[i] = &msg
+}
+
+func (s *laneSelector) pick(ls *laneSubscription) (queue.Message, Priority, bool) {
+	total, best := 0, -1
+	for i, msg := range ls.pending {
+		if msg == nil {
+			continue
+		}
+		p := priorities[i]
+		s.current[p] += s.weights[p]
+		total += s.weights[p]
+		if best < 0 || s.current[p] > s.current[priorities[best]] {
+			best = i
+		}
+	}
+	p := priorities[best]
+	s.current[p] -= total
+	msg := *ls.pending[best]
+	ls.pending[best] = nil
+	return msg, p, true
+}
@@ -0,0 +1,64 @@
+package capture
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/leveldorado/screenshot/queue"
+)
+
+func TestPriority_Topic(t *testing.T) {
+	require.Equal(t, ShotRequestTopic, Priority("").Topic())
+	require.Equal(t, ShotRequestTopic, PriorityNormal.Topic())
+	require.Equal(t, []string{"shot_request_high", "shot_request", "shot_request_bulk"}, ShotRequestTopics())
+	require.NoError(t, PriorityBulk.Validate())
+	require.Error(t, Priority("urgent").Validate())
+}
+
+func fillLane(n int) chan queue.Message {
+	c := make(chan queue.Message, n)
+	for i := 0; i < n; i++ {
+		c <- queue.Message{}
+	}
+	return c
+}
+
+func TestLaneSelector_Weights(t *testing.T) {
+	high, normal, bulk := fillLane(20), fillLane(20), fillLane(20)
+	ls := newLaneSubscription([]<-chan queue.Message{high, normal, bulk}, newLaneDemand())
+	s := newLaneSelector(nil)
+	counts := map[Priority]int{}
+	var order []Priority
+	for i := 0; i < 10; i++ {
+		_, p, ok := s.next(ls)
+		require.True(t, ok)
+		counts[p]++
+		order = append(order, p)
+	}
+	require.Equal(t, map[Priority]int{PriorityHigh: 6, PriorityNormal: 3, PriorityBulk: 1}, counts)
+	require.Equal(t, PriorityHigh, order[0])
+}
+
+func TestLaneSelector_OnlyReadyLanes(t *testing.T) {
+	high, normal, bulk := make(chan queue.Message), make(chan queue.Message), fillLane(2)
+	close(bulk)
+	ls := newLaneSubscription([]<-chan queue.Message{high, normal, bulk}, newLaneDemand())
+	s := newLaneSelector(PriorityWeights{PriorityBulk: 1})
+	for i := 0; i < 2; i++ {
+		_, p, ok := s.next(ls)
+		require.True(t, ok)
+		require.Equal(t, PriorityBulk, p)
+	}
+	go func() {
+		high <- queue.Message{Reply: "high"}
+		close(high)
+		close(normal)
+	}()
+	msg, p, ok := s.next(ls)
+	require.True(t, ok)
+	require.Equal(t, PriorityHigh, p)
+	require.Equal(t, "high", msg.Reply)
+	_, _, ok = s.next(ls)
+	require.False(t, ok)
+}
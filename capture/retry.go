@@ -0,0 +1,147 @@
+package capture
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mafredri/cdp/rpcc"
+
+	"github.com/leveldorado/screenshot/store"
+)
+
+// ErrorClass groups capture failures so retry policy can decide which of them are worth another attempt
+type ErrorClass string
+
+const (
+	// navigation, wait condition or waiting for free chrome target took longer than attempt timeout
+	ErrorClassTimeout ErrorClass = "timeout"
+	// chrome is unavailable or connection to it is lost during capture
+	ErrorClassConnection ErrorClass = "connection"
+	// host name of page can not be resolved
+	ErrorClassDNS ErrorClass = "dns"
+	// page can not be loaded for other network reason e.g. connection refused or reset
+	ErrorClassNetwork ErrorClass = "network"
+	ErrorClassOther   ErrorClass = "other"
+	// url is disallowed by robots.txt of its host, so page is not loaded at all. it is never retried
+	ErrorClassRobotsDisallowed ErrorClass = "robots_disallowed"
+	// host limits did not let capture start within max wait, request is queued again
+	ErrorClassHostLimitTimeout ErrorClass = "host_limit_timeout"
+)
+
+type RetryPolicy struct {
+	MaxAttempts    int           `yaml:"max_attempts"`
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+	// each attempt is limited by this timeout, so timed out navigation can be retried within request timeout
+	AttemptTimeout time.Duration `yaml:"attempt_timeout"`
+	RetryOn        []ErrorClass  `yaml:"retry_on"`
+}
+
+var defaultRetryOn = []ErrorClass{ErrorClassTimeout, ErrorClassConnection, ErrorClassNetwork}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts < 1 {
+		p.MaxAttempts = 1
+	}
+	if p.RetryOn == nil {
+		p.RetryOn = defaultRetryOn
+	}
+	return p
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if d >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+	return d
+}
+
+func (p RetryPolicy) retryable(class ErrorClass) bool {
+	for _, c := range p.RetryOn {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// NavigationError is reported by chrome when page can not be loaded e.g. net::ERR_NAME_NOT_RESOLVED
+type NavigationError struct {
+	URL  string
+	Text string
+}
+
+func (e *NavigationError) Error() string {
+	return fmt.Sprintf(`page navigation failed: [url: %s, error: %s]`, e.URL, e.Text)
+}
+
+type connectionError struct {
+	err error
+}
+
+func (e *connectionError) Error() string {
+	return e.err.Error()
+}
+
+func (e *connectionError) Unwrap() error {
+	return e.err
+}
+
+// ShotError is returned when capture failed after all attempts. Err is the last error
+type ShotError struct {
+	URL      string
+	Attempts int
+	Class    ErrorClass
+	Err      error
+	History  []store.FailedAttempt
+}
+
+func (e *ShotError) Error() string {
+	return fmt.Sprintf(`failed to make shot: [url: %s, attempts: %d, error_class: %s, error: %s]`, e.URL, e.Attempts, e.Class, e.Err)
+}
+
+func (e *ShotError) Unwrap() error {
+	return e.Err
+}
+
+var dnsErrors = []string{"net::ERR_NAME_NOT_RESOLVED", "net::ERR_NAME_RESOLUTION_FAILED"}
+
+func classifyError(err error) ErrorClass {
+	class := ErrorClassOther
+	// cdp wraps errors with Cause instead of Unwrap so both chains are followed
+	for ; err != nil; err = cause(err) {
+		var navErr *NavigationError
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			return ErrorClassTimeout
+		case errors.As(err, &navErr):
+			for _, text := range dnsErrors {
+				if strings.Contains(navErr.Text, text) {
+					return ErrorClassDNS
+				}
+			}
+			return ErrorClassNetwork
+		case errors.Is(err, rpcc.ErrConnClosing):
+			class = ErrorClassConnection
+		}
+		var connErr *connectionError
+		if errors.As(err, &connErr) {
+			class = ErrorClassConnection
+		}
+	}
+	return class
+}
+
+func cause(err error) error {
+	if c, ok := err.(interface{ Cause() error }); ok {
+		return c.Cause()
+	}
+	return errors.Unwrap(err)
+}
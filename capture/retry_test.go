@@ -0,0 +1,52 @@
+package capture
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mafredri/cdp/rpcc"
+	"github.com/stretchr/testify/require"
+)
+
+type causer struct {
+	err error
+}
+
+func (c causer) Error() string {
+	return c.err.Error()
+}
+
+func (c causer) Cause() error {
+	return c.err
+}
+
+func TestClassifyError(t *testing.T) {
+	for _, tc := range []struct {
+		err   error
+		class ErrorClass
+	}{
+		{err: fmt.Errorf(`failed to wait for page: [error: %w]`, context.DeadlineExceeded), class: ErrorClassTimeout},
+		{err: &connectionError{err: fmt.Errorf(`timeout waiting for free chrome target: [error: %w]`, context.DeadlineExceeded)}, class: ErrorClassTimeout},
+		{err: &connectionError{err: errors.New("no chrome endpoint available")}, class: ErrorClassConnection},
+		{err: fmt.Errorf(`failed to capture screenshot: [error: %w]`, causer{err: rpcc.ErrConnClosing}), class: ErrorClassConnection},
+		{err: fmt.Errorf(`failed to navigate to page: [error: %w]`, &NavigationError{Text: "net::ERR_NAME_NOT_RESOLVED"}), class: ErrorClassDNS},
+		{err: &NavigationError{Text: "net::ERR_CONNECTION_REFUSED"}, class: ErrorClassNetwork},
+		{err: errors.New("element not found: [selector: header]"), class: ErrorClassOther},
+	} {
+		require.Equal(t, tc.class, classifyError(tc.err), tc.err.Error())
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 3 * time.Second}.withDefaults()
+	require.Equal(t, 1, p.MaxAttempts)
+	require.Equal(t, time.Second, p.backoff(1))
+	require.Equal(t, 2*time.Second, p.backoff(2))
+	require.Equal(t, 3*time.Second, p.backoff(3))
+	require.True(t, p.retryable(ErrorClassTimeout))
+	require.False(t, p.retryable(ErrorClassDNS))
+	require.False(t, RetryPolicy{RetryOn: []ErrorClass{}}.withDefaults().retryable(ErrorClassTimeout))
+}
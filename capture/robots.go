@@ -0,0 +1,268 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	neturl "net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+type RobotsConfig struct {
+	// when enabled url disallowed by robots.txt of its host is rejected instead of captured
+	Enabled bool `yaml:"enabled"`
+	// robots.txt group is selected by this user agent, e.g. "ScreenshotBot"
+	UserAgent string `yaml:"user_agent"`
+	// robots.txt of host is fetched again after this period
+	CacheTTL     time.Duration `yaml:"cache_ttl"`
+	FetchTimeout time.Duration `yaml:"fetch_timeout"`
+}
+
+const (
+	defaultRobotsUserAgent    = "ScreenshotBot"
+	defaultRobotsCacheTTL     = time.Hour
+	defaultRobotsFetchTimeout = 5 * time.Second
+	// unavailable robots.txt disallows host only for short period, so host is checked again soon
+	robotsUnavailableTTL = time.Minute
+	// longer robots.txt is truncated as rfc 9309 allows
+	robotsMaxSize = 500 << 10
+)
+
+func (c RobotsConfig) withDefaults() RobotsConfig {
+	if c.UserAgent == "" {
+		c.UserAgent = defaultRobotsUserAgent
+	}
+	if c.CacheTTL <= 0 {
+		c.CacheTTL = defaultRobotsCacheTTL
+	}
+	if c.FetchTimeout <= 0 {
+		c.FetchTimeout = defaultRobotsFetchTimeout
+	}
+	return c
+}
+
+// RobotsDisallowedError is returned for url which robots.txt of its host disallows for configured user agent
+type RobotsDisallowedError struct {
+	URL       string
+	UserAgent string
+}
+
+func (e *RobotsDisallowedError) Error() string {
+	return fmt.Sprintf(`url is disallowed by robots.txt: [url: %s, user_agent: %s]`, e.URL, e.UserAgent)
+}
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+	re      *regexp.Regexp
+}
+
+type robotsGroup struct {
+	agents []string
+	rules  []robotsRule
+}
+
+type robotsEntry struct {
+	rules   []robotsRule
+	expires time.Time
+}
+
+// RobotsChecker fetches robots.txt of every host once per cache period and checks urls against it
+type RobotsChecker struct {
+	cfg RobotsConfig
+	cl  *http.Client
+
+	mu    sync.Mutex
+	cache map[string]robotsEntry
+}
+
+func NewRobotsChecker(cfg RobotsConfig) *RobotsChecker {
+	return &RobotsChecker{cfg: cfg.withDefaults(), cl: &http.Client{}, cache: map[string]robotsEntry{}}
+}
+
+// Check returns *RobotsDisallowedError when url is disallowed. it does nothing when checker is disabled
+func (c *RobotsChecker) Check(ctx context.Context, url string) error {
+	if !c.cfg.Enabled {
+		return nil
+	}
+	u, err := neturl.Parse(url)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		// robots.txt applies only to web pages, invalid url fails on navigation
+		return nil
+	}
+	rules, ok := c.rules(ctx, u)
+	if !ok {
+		return nil
+	}
+	if !robotsAllowed(rules, robotsPath(u)) {
+		return &RobotsDisallowedError{URL: url, UserAgent: c.cfg.UserAgent}
+	}
+	return nil
+}
+
+// rules returns rules of url host for configured user agent. it returns false when robots.txt could not be fetched
+func (c *RobotsChecker) rules(ctx context.Context, u *neturl.URL) ([]robotsRule, bool) {
+	origin := strings.ToLower(u.Scheme + "://" + u.Host)
+	c.mu.Lock()
+	e, ok := c.cache[origin]
+	c.mu.Unlock()
+	if ok && time.Now().Before(e.expires) {
+		return e.rules, true
+	}
+	rules, ttl, err := c.fetch(ctx, origin)
+	if err != nil {
+		// host which can not be reached fails on navigation anyway, so capture is not rejected
+		log.Println(fmt.Sprintf(`failed to fetch robots.txt: [origin: %s, error: %s]`, origin, err))
+		return nil, false
+	}
+	c.mu.Lock()
+	c.cache[origin] = robotsEntry{rules: rules, expires: time.Now().Add(ttl)}
+	c.mu.Unlock()
+	return rules, true
+}
+
+var disallowAll = []robotsRule{{allow: false, pattern: "/", re: robotsPattern("/")}}
+
+// fetch returns rules of origin and period they are cached for. missing robots.txt allows everything, server
+// error disallows everything as rfc 9309 requires
+func (c *RobotsChecker) fetch(ctx context.Context, origin string) ([]robotsRule, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.FetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, origin+"/robots.txt", nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf(`failed to create request: [origin: %s, error: %w]`, origin, err)
+	}
+	req.Header.Set("User-Agent", c.cfg.UserAgent)
+	resp, err := c.cl.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf(`failed to send request: [origin: %s, error: %w]`, origin, err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 500:
+		return disallowAll, robotsUnavailableTTL, nil
+	case resp.StatusCode >= 400:
+		return nil, c.cfg.CacheTTL, nil
+	case resp.StatusCode >= 300:
+		// redirects are followed by client, so it is redirect loop or missing location
+		return nil, 0, fmt.Errorf(`unexpected status: [origin: %s, status: %d]`, origin, resp.StatusCode)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, robotsMaxSize))
+	if err != nil {
+		return nil, 0, fmt.Errorf(`failed to read robots.txt: [origin: %s, error: %w]`, origin, err)
+	}
+	return selectRobotsRules(parseRobots(data), c.cfg.UserAgent), c.cfg.CacheTTL, nil
+}
+
+func parseRobots(data []byte) []robotsGroup {
+	var groups []robotsGroup
+	var current *robotsGroup
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		value := strings.TrimSpace(line[i+1:])
+		switch key {
+		case "user-agent":
+			// consecutive user agent lines share the same group
+			if current == nil || len(current.rules) > 0 {
+				groups = append(groups, robotsGroup{})
+				current = &groups[len(groups)-1]
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+		case "allow", "disallow":
+			// empty disallow allows everything, so it adds no rule
+			if current == nil || value == "" {
+				continue
+			}
+			current.rules = append(current.rules, robotsRule{allow: key == "allow", pattern: value, re: robotsPattern(value)})
+		}
+	}
+	return groups
+}
+
+func (g robotsGroup) hasAgent(agent string) bool {
+	for _, a := range g.agents {
+		if a == agent {
+			return true
+		}
+	}
+	return false
+}
+
+// selectRobotsRules merges groups of user agent product token. groups of "*" are used when none matches
+func selectRobotsRules(groups []robotsGroup, userAgent string) []robotsRule {
+	token := strings.ToLower(userAgent)
+	if i := strings.IndexAny(token, "/ "); i >= 0 {
+		token = token[:i]
+	}
+	var matched, wildcard []robotsRule
+	found := false
+	for _, g := range groups {
+		switch {
+		case g.hasAgent(token):
+			matched = append(matched, g.rules...)
+			found = true
+		case g.hasAgent("*"):
+			wildcard = append(wildcard, g.rules...)
+		}
+	}
+	if found {
+		return matched
+	}
+	return wildcard
+}
+
+// robotsAllowed applies the most specific rule matching path. allow wins when rules are equally specific
+func robotsAllowed(rules []robotsRule, path string) bool {
+	if path == "/robots.txt" {
+		return true
+	}
+	allowed, longest := true, -1
+	for _, r := range rules {
+		if !r.re.MatchString(path) {
+			continue
+		}
+		if len(r.pattern) > longest || (len(r.pattern) == longest && r.allow) {
+			allowed, longest = r.allow, len(r.pattern)
+		}
+	}
+	return allowed
+}
+
+// robotsPattern matches path prefix. "*" matches any sequence and trailing "$" anchors end of path
+func robotsPattern(pattern string) *regexp.Regexp {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	expr := "^" + strings.Replace(regexp.QuoteMeta(pattern), `\*`, `.*`, -1)
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+func robotsPath(u *neturl.URL) string {
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return path
+}
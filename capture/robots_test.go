@@ -0,0 +1,79 @@
+package capture
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testRobots = `# comment
+User-agent: *
+Disallow: /
+
+User-agent: ScreenshotBot
+User-agent: OtherBot
+Disallow: /private
+Allow: /private/public
+Disallow: /*.pdf$
+Disallow: /search?
+
+Sitemap: https://example.com/sitemap.xml
+`
+
+func TestRobotsAllowed(t *testing.T) {
+	groups := parseRobots([]byte(testRobots))
+	rules := selectRobotsRules(groups, "ScreenshotBot/1.0")
+	for path, allowed := range map[string]bool{
+		"/":                    true,
+		"/private":             false,
+		"/private/page":        false,
+		"/private/public/page": true,
+		"/doc.pdf":             false,
+		"/doc.pdf?x=1":         true,
+		"/search?q=1":          false,
+		"/searching":           true,
+		"/robots.txt":          true,
+	} {
+		require.Equal(t, allowed, robotsAllowed(rules, path), path)
+	}
+	rules = selectRobotsRules(groups, "UnknownBot")
+	require.False(t, robotsAllowed(rules, "/page"))
+	require.True(t, robotsAllowed(selectRobotsRules(parseRobots(nil), "UnknownBot"), "/page"))
+}
+
+func TestRobotsChecker_Check(t *testing.T) {
+	var fetched int32
+	status := int32(http.StatusOK)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetched, 1)
+		require.Equal(t, "/robots.txt", r.URL.Path)
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+		_, _ = w.Write([]byte(testRobots))
+	}))
+	defer srv.Close()
+	rc := NewRobotsChecker(RobotsConfig{Enabled: true})
+	ctx := context.Background()
+	require.NoError(t, rc.Check(ctx, srv.URL+"/page"))
+	err := rc.Check(ctx, srv.URL+"/private/page")
+	var robotsErr *RobotsDisallowedError
+	require.True(t, errors.As(err, &robotsErr))
+	require.Equal(t, "ScreenshotBot", robotsErr.UserAgent)
+	// robots.txt is cached
+	require.Equal(t, int32(1), atomic.LoadInt32(&fetched))
+
+	atomic.StoreInt32(&status, http.StatusNotFound)
+	rc = NewRobotsChecker(RobotsConfig{Enabled: true})
+	require.NoError(t, rc.Check(ctx, srv.URL+"/private/page"))
+
+	atomic.StoreInt32(&status, http.StatusServiceUnavailable)
+	rc = NewRobotsChecker(RobotsConfig{Enabled: true})
+	require.Error(t, rc.Check(ctx, srv.URL+"/page"))
+
+	rc = NewRobotsChecker(RobotsConfig{})
+	require.NoError(t, rc.Check(ctx, srv.URL+"/private/page"))
+}
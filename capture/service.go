@@ -4,13 +4,21 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"log"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/leveldorado/screenshot/store"
 )
 
+// Shot is captured image of whole page or of element matched by selector
+type Shot struct {
+	Selector string
+	Data     io.Reader
+}
+
 type shotMaker interface {
-	MakeShot(ctx context.Context, url, format string, quality int) (io.Reader, error)
+	MakeShot(ctx context.Context, url string, opt ShotOptions) ([]Shot, error)
 }
 
 type fileSaver interface {
@@ -22,34 +30,92 @@ type metadataSaver interface {
 }
 
 type DefaultService struct {
-	sm          shotMaker
-	fs          fileSaver
-	ms          metadataSaver
-	shotFormat  string
-	shotQuality int
+	sm       shotMaker
+	fs       fileSaver
+	ms       metadataSaver
+	defaults ShotOptions
+	retry    RetryPolicy
 }
 
-func NewDefaultService(sm shotMaker, fs fileSaver, ms metadataSaver, format string, quality int) *DefaultService {
-	return &DefaultService{sm: sm, fs: fs, ms: ms, shotFormat: format, shotQuality: quality}
+func NewDefaultService(sm shotMaker, fs fileSaver, ms metadataSaver, defaults ShotOptions, retry RetryPolicy) *DefaultService {
+	return &DefaultService{sm: sm, fs: fs, ms: ms, defaults: defaults, retry: retry.withDefaults()}
 }
 
-func (s *DefaultService) MakeShotAndSave(ctx context.Context, url string) (store.Metadata, error) {
-	shot, err := s.sm.MakeShot(ctx, url, s.shotFormat, s.shotQuality)
+// MakeShotAndSave captures url and saves every shot as new version. schedule id is empty unless request is published by schedule
+func (s *DefaultService) MakeShotAndSave(ctx context.Context, url string, opt ShotOptions, scheduleID string) ([]store.Metadata, error) {
+	if opt.Device == "" {
+		opt.Device = s.defaults.Device
+	}
+	opt = opt.withDevice().WithDefaults(s.defaults)
+	shots, attempts, err := s.makeShot(ctx, url, opt)
 	if err != nil {
-		return store.Metadata{}, fmt.Errorf(`failed to make shot: [url: %s, error: %w]`, url, err)
+		return nil, err
+	}
+	var list []store.Metadata
+	for _, shot := range shots {
+		metadata, err := s.save(ctx, url, opt, shot, attempts, scheduleID)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, metadata)
+	}
+	return list, nil
+}
+
+// makeShot retries failures of retryable classes with exponential backoff. failure is returned as *ShotError
+func (s *DefaultService) makeShot(ctx context.Context, url string, opt ShotOptions) ([]Shot, int, error) {
+	var history []store.FailedAttempt
+	for attempt := 1; ; attempt++ {
+		shots, err := s.attempt(ctx, url, opt)
+		if err == nil {
+			return shots, attempt, nil
+		}
+		class := classifyError(err)
+		history = append(history, store.FailedAttempt{At: time.Now().UTC(), Attempt: attempt, ErrorClass: string(class), Error: err.Error()})
+		shotErr := &ShotError{URL: url, Attempts: attempt, Class: class, Err: err, History: history}
+		if attempt >= s.retry.MaxAttempts || !s.retry.retryable(class) || ctx.Err() != nil {
+			return nil, attempt, shotErr
+		}
+		log.Println(fmt.Sprintf(`retrying failed shot: [url: %s, attempt: %d, error_class: %s, error: %s]`, url, attempt, class, err))
+		select {
+		case <-time.After(s.retry.backoff(attempt)):
+		case <-ctx.Done():
+			return nil, attempt, shotErr
+		}
+	}
+}
+
+func (s *DefaultService) attempt(ctx context.Context, url string, opt ShotOptions) ([]Shot, error) {
+	if s.retry.AttemptTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.retry.AttemptTimeout)
+		defer cancel()
 	}
+	return s.sm.MakeShot(ctx, url, opt)
+}
+
+func (s *DefaultService) save(ctx context.Context, url string, opt ShotOptions, shot Shot, attempts int, scheduleID string) (store.Metadata, error) {
 	fileID := uuid.New().String()
-	if err = s.fs.Save(ctx, shot, fileID, url); err != nil {
+	if err := s.fs.Save(ctx, shot.Data, fileID, url); err != nil {
 		return store.Metadata{}, fmt.Errorf(`failed to store file: [id: %s, name: %s, error: %w]`, fileID, url, err)
 	}
 	metadata := store.Metadata{
-		ID:      uuid.New().String(),
-		Url:     url,
-		Format:  s.shotFormat,
-		Quality: s.shotQuality,
-		FileID:  fileID,
+		ID:                uuid.New().String(),
+		Url:               url,
+		Format:            opt.Format,
+		Quality:           opt.Quality,
+		ViewportWidth:     opt.ViewportWidth,
+		ViewportHeight:    opt.ViewportHeight,
+		DeviceScaleFactor: opt.DeviceScaleFactor,
+		FullPage:          boolValue(opt.FullPage),
+		DelayMS:           opt.DelayMS,
+		Device:            opt.Device,
+		Selector:          shot.Selector,
+		Attempts:          attempts,
+		ScheduleID:        scheduleID,
+		FileID:            fileID,
 	}
-	if err = s.ms.Save(ctx, &metadata); err != nil {
+	if err := s.ms.Save(ctx, &metadata); err != nil {
 		return store.Metadata{}, fmt.Errorf(`failed to save screen shot metadata: [doc: %+v, error: %w]`, metadata, err)
 	}
 	return metadata, nil
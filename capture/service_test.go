@@ -2,9 +2,11 @@ package capture
 
 import (
 	"context"
+	"errors"
 	"io"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -19,9 +21,9 @@ type mockShotMaker struct {
 	mock.Mock
 }
 
-func (m *mockShotMaker) MakeShot(ctx context.Context, url, format string, quality int) (io.Reader, error) {
-	args := m.Called(ctx, url, format, quality)
-	return args.Get(0).(io.Reader), args.Error(1)
+func (m *mockShotMaker) MakeShot(ctx context.Context, url string, opt ShotOptions) ([]Shot, error) {
+	args := m.Called(ctx, url, opt)
+	return args.Get(0).([]Shot), args.Error(1)
 }
 
 type mockFileSaver struct {
@@ -43,10 +45,13 @@ func (m *mockMetadataSaver) Save(ctx context.Context, doc *store.Metadata) error
 func TestDefaultService_MakeShot(t *testing.T) {
 	sm := &mockShotMaker{}
 	url := uuid.New().String()
-	format := "jpeg"
-	quality := 80
+	defaults := ShotOptions{Format: FormatJPEG, Quality: 80}
+	opt := ShotOptions{ViewportWidth: 375, ViewportHeight: 812, DeviceScaleFactor: 2, FullPage: Bool(true), DelayMS: 100}
+	expectedOpt := opt
+	expectedOpt.Format = defaults.Format
+	expectedOpt.Quality = defaults.Quality
 	file := strings.NewReader(uuid.New().String())
-	sm.On("MakeShot", mock.Anything, url, format, quality).Return(file, nil)
+	sm.On("MakeShot", mock.Anything, url, expectedOpt).Return([]Shot{{Data: file}}, nil)
 	fs := &mockFileSaver{}
 	fs.On("Save", mock.Anything, file, mock.Anything, url).Return(nil)
 	ms := &mockMetadataSaver{}
@@ -58,15 +63,106 @@ func TestDefaultService_MakeShot(t *testing.T) {
 		savedMetadata.Version = 1
 	}).Return(nil)
 
-	s := NewDefaultService(sm, fs, ms, format, quality)
-	resp, err := s.MakeShotAndSave(context.Background(), url)
+	s := NewDefaultService(sm, fs, ms, defaults, RetryPolicy{})
+	scheduleID := uuid.New().String()
+	list, err := s.MakeShotAndSave(context.Background(), url, opt, scheduleID)
 	require.NoError(t, err)
+	require.Len(t, list, 1)
+	resp := list[0]
 	require.Equal(t, resp, *savedMetadata)
 	require.Equal(t, url, resp.Url)
-	require.Equal(t, format, resp.Format)
-	require.Equal(t, quality, resp.Quality)
+	require.Equal(t, scheduleID, resp.ScheduleID)
+	require.Equal(t, expectedOpt.Format, resp.Format)
+	require.Equal(t, expectedOpt.Quality, resp.Quality)
+	require.Equal(t, expectedOpt.ViewportWidth, resp.ViewportWidth)
+	require.Equal(t, expectedOpt.ViewportHeight, resp.ViewportHeight)
+	require.Equal(t, expectedOpt.DeviceScaleFactor, resp.DeviceScaleFactor)
+	require.Equal(t, *expectedOpt.FullPage, resp.FullPage)
+	require.Equal(t, expectedOpt.DelayMS, resp.DelayMS)
 	require.Equal(t, version, resp.Version)
 	sm.AssertExpectations(t)
 	fs.AssertExpectations(t)
 	ms.AssertExpectations(t)
 }
+
+func TestDefaultService_MakeShotWithDevice(t *testing.T) {
+	sm := &mockShotMaker{}
+	url := uuid.New().String()
+	defaults := ShotOptions{Format: FormatJPEG, Quality: 80, ViewportWidth: 1280, ViewportHeight: 800, DeviceScaleFactor: 1}
+	expectedOpt := ShotOptions{Format: FormatJPEG, Quality: 80, ViewportWidth: 411, ViewportHeight: 731, DeviceScaleFactor: 2.625, Device: "pixel-2"}
+	file := strings.NewReader(uuid.New().String())
+	sm.On("MakeShot", mock.Anything, url, expectedOpt).Return([]Shot{{Data: file}}, nil)
+	fs := &mockFileSaver{}
+	fs.On("Save", mock.Anything, file, mock.Anything, url).Return(nil)
+	ms := &mockMetadataSaver{}
+	ms.On("Save", mock.Anything, mock.Anything).Return(nil)
+
+	s := NewDefaultService(sm, fs, ms, defaults, RetryPolicy{})
+	list, err := s.MakeShotAndSave(context.Background(), url, ShotOptions{Device: "pixel-2"}, "")
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	resp := list[0]
+	require.Equal(t, "pixel-2", resp.Device)
+	require.Equal(t, expectedOpt.ViewportWidth, resp.ViewportWidth)
+	require.Equal(t, expectedOpt.ViewportHeight, resp.ViewportHeight)
+	sm.AssertExpectations(t)
+}
+
+func TestDefaultService_MakeElementShots(t *testing.T) {
+	sm := &mockShotMaker{}
+	url := uuid.New().String()
+	opt := ShotOptions{Format: FormatPNG, Selectors: []string{"header", "#pricing"}}
+	shots := []Shot{{Selector: "header", Data: strings.NewReader(uuid.New().String())}, {Selector: "#pricing", Data: strings.NewReader(uuid.New().String())}}
+	sm.On("MakeShot", mock.Anything, url, opt).Return(shots, nil)
+	fs := &mockFileSaver{}
+	fs.On("Save", mock.Anything, shots[0].Data, mock.Anything, url).Return(nil)
+	fs.On("Save", mock.Anything, shots[1].Data, mock.Anything, url).Return(nil)
+	ms := &mockMetadataSaver{}
+	ms.On("Save", mock.Anything, mock.Anything).Return(nil)
+
+	s := NewDefaultService(sm, fs, ms, ShotOptions{}, RetryPolicy{})
+	list, err := s.MakeShotAndSave(context.Background(), url, opt, "")
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	require.Equal(t, "header", list[0].Selector)
+	require.Equal(t, "#pricing", list[1].Selector)
+	require.NotEqual(t, list[0].FileID, list[1].FileID)
+	sm.AssertExpectations(t)
+	fs.AssertExpectations(t)
+	ms.AssertExpectations(t)
+}
+
+func TestDefaultService_MakeShotRetry(t *testing.T) {
+	sm := &mockShotMaker{}
+	url := uuid.New().String()
+	file := strings.NewReader(uuid.New().String())
+	sm.On("MakeShot", mock.Anything, url, ShotOptions{}).Return([]Shot(nil), &connectionError{err: errors.New("connection refused")}).Once()
+	sm.On("MakeShot", mock.Anything, url, ShotOptions{}).Return([]Shot{{Data: file}}, nil).Once()
+	fs := &mockFileSaver{}
+	fs.On("Save", mock.Anything, file, mock.Anything, url).Return(nil)
+	ms := &mockMetadataSaver{}
+	ms.On("Save", mock.Anything, mock.Anything).Return(nil)
+
+	s := NewDefaultService(sm, fs, ms, ShotOptions{}, RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+	list, err := s.MakeShotAndSave(context.Background(), url, ShotOptions{}, "")
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	require.Equal(t, 2, list[0].Attempts)
+	sm.AssertExpectations(t)
+}
+
+func TestDefaultService_MakeShotNotRetryable(t *testing.T) {
+	sm := &mockShotMaker{}
+	url := uuid.New().String()
+	sm.On("MakeShot", mock.Anything, url, ShotOptions{}).Return([]Shot(nil), &NavigationError{URL: url, Text: "net::ERR_NAME_NOT_RESOLVED"}).Once()
+
+	s := NewDefaultService(sm, nil, nil, ShotOptions{}, RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+	_, err := s.MakeShotAndSave(context.Background(), url, ShotOptions{}, "")
+	var shotErr *ShotError
+	require.True(t, errors.As(err, &shotErr))
+	require.Equal(t, 1, shotErr.Attempts)
+	require.Equal(t, ErrorClassDNS, shotErr.Class)
+	require.Len(t, shotErr.History, 1)
+	require.Equal(t, string(ErrorClassDNS), shotErr.History[0].ErrorClass)
+	sm.AssertExpectations(t)
+}
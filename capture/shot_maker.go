@@ -4,37 +4,68 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"io"
+	"log"
+	"math"
 
 	"github.com/mafredri/cdp"
-	"github.com/mafredri/cdp/devtool"
+	"github.com/mafredri/cdp/protocol/dom"
+	"github.com/mafredri/cdp/protocol/emulation"
 	"github.com/mafredri/cdp/protocol/page"
-	"github.com/mafredri/cdp/rpcc"
 )
 
 type ChromeShotMaker struct {
-	addr string
+	b *endpointBalancer
 }
 
-func NewChromeShotMaker(addr string) *ChromeShotMaker {
-	return &ChromeShotMaker{addr: addr}
+func NewChromeShotMaker(addrs []string, cfg ChromeConfig) *ChromeShotMaker {
+	return &ChromeShotMaker{b: newEndpointBalancer(addrs, cfg)}
 }
 
-func (c *ChromeShotMaker) buildClient(ctx context.Context) (*cdp.Client, func(), error) {
-	devt := devtool.New(c.addr)
-	pt, err := devt.Create(ctx)
-	if err != nil {
-		return nil, nil, fmt.Errorf(`failed to create page target: [chrome_address: %s, error: %w]`, c.addr, err)
+// Run warms up target pools and starts probing of unhealthy endpoints. chrome may be not ready yet so
+// warm up failure is not fatal
+func (c *ChromeShotMaker) Run(ctx context.Context) error {
+	for _, e := range c.b.endpoints {
+		go func(e *endpoint) {
+			if err := e.pool.warmup(ctx); err != nil {
+				log.Println(fmt.Sprintf(`failed to warm up chrome target pool: [chrome_address: %s, error: %s]`, e.pool.addr, err))
+			}
+		}(e)
 	}
-	conn, err := rpcc.DialContext(ctx, pt.WebSocketDebuggerURL)
-	if err != nil {
-		devt.Close(ctx, pt)
-		return nil, nil, fmt.Errorf(`failed to dial web socket debugger url: [url: %s, error: %w]`, pt.WebSocketDebuggerURL, err)
+	go c.b.runProbes(ctx)
+	return nil
+}
+
+func (c *ChromeShotMaker) Stop(ctx context.Context) error {
+	for _, e := range c.b.endpoints {
+		e.pool.close()
+	}
+	return nil
+}
+
+func (c *ChromeShotMaker) Stats() []EndpointStats {
+	return c.b.Stats()
+}
+
+// acquire takes target from least loaded endpoint. on connection error next endpoint is tried
+func (c *ChromeShotMaker) acquire(ctx context.Context) (*endpoint, *pooledTarget, error) {
+	tried := map[*endpoint]bool{}
+	var lastErr error
+	for e := c.b.pick(tried); e != nil; e = c.b.pick(tried) {
+		tried[e] = true
+		t, err := e.pool.acquire(ctx)
+		if err == nil {
+			c.b.recordSuccess(e)
+			return e, t, nil
+		}
+		c.b.done(e)
+		// timeout waiting for free target is not endpoint failure
+		if ctx.Err() != nil {
+			return nil, nil, err
+		}
+		c.b.recordFailure(e, err)
+		lastErr = err
 	}
-	return cdp.NewClient(conn), func() {
-		conn.Close()
-		devt.Close(ctx, pt)
-	}, nil
+	return nil, nil, fmt.Errorf(`no chrome endpoint available: [endpoints: %d, last_error: %w]`, len(c.b.endpoints), lastErr)
 }
 
 func navigateToPage(ctx context.Context, cl *cdp.Client, url string) error {
@@ -42,13 +73,18 @@ func navigateToPage(ctx context.Context, cl *cdp.Client, url string) error {
 	if err != nil {
 		return fmt.Errorf(`failed to create frame stopped event client: [error: %w]`, err)
 	}
+	// connection is reused by pool so stream must be closed explicitly
+	defer frameStopedEventClient.Close()
 	if err = cl.Page.Enable(ctx); err != nil {
 		return fmt.Errorf(`failed to enable page domain notification: [error: %w]`, err)
 	}
-	_, err = cl.Page.Navigate(ctx, page.NewNavigateArgs(url))
+	reply, err := cl.Page.Navigate(ctx, page.NewNavigateArgs(url))
 	if err != nil {
 		return fmt.Errorf(`failed navigate site url: [url: %s, error: %w]`, url, err)
 	}
+	if reply.ErrorText != nil && *reply.ErrorText != "" {
+		return &NavigationError{URL: url, Text: *reply.ErrorText}
+	}
 	_, err = frameStopedEventClient.Recv()
 	if err != nil {
 		return fmt.Errorf(`failed to receive frame stopped event: [error: %w]`, err)
@@ -56,22 +92,185 @@ func navigateToPage(ctx context.Context, cl *cdp.Client, url string) error {
 	return nil
 }
 
-func (c *ChromeShotMaker) MakeShot(ctx context.Context, url, format string, quality int) (io.Reader, error) {
-	cl, close, err := c.buildClient(ctx)
+const (
+	defaultViewportWidth  = 800
+	defaultViewportHeight = 600
+	maxTouchPoints        = 5
+)
+
+func overrideDeviceMetrics(ctx context.Context, cl *cdp.Client, opt ShotOptions) error {
+	device, _ := GetDevice(opt.Device)
+	if opt.ViewportWidth == 0 && opt.ViewportHeight == 0 && opt.DeviceScaleFactor == 0 && !device.Mobile {
+		return nil
+	}
+	width, height := opt.ViewportWidth, opt.ViewportHeight
+	if width == 0 {
+		width = defaultViewportWidth
+	}
+	if height == 0 {
+		height = defaultViewportHeight
+	}
+	if err := cl.Emulation.SetDeviceMetricsOverride(ctx, emulation.NewSetDeviceMetricsOverrideArgs(width, height, opt.DeviceScaleFactor, device.Mobile)); err != nil {
+		return fmt.Errorf(`failed to override device metrics: [width: %d, height: %d, device_scale_factor: %v, mobile: %t, error: %w]`,
+			width, height, opt.DeviceScaleFactor, device.Mobile, err)
+	}
+	return nil
+}
+
+func emulateDevice(ctx context.Context, cl *cdp.Client, name string) error {
+	device, ok := GetDevice(name)
+	if !ok {
+		return nil
+	}
+	if device.Touch {
+		if err := cl.Emulation.SetTouchEmulationEnabled(ctx, emulation.NewSetTouchEmulationEnabledArgs(true).SetMaxTouchPoints(maxTouchPoints)); err != nil {
+			return fmt.Errorf(`failed to enable touch emulation: [device: %s, error: %w]`, name, err)
+		}
+	}
+	if device.UserAgent != "" {
+		if err := cl.Emulation.SetUserAgentOverride(ctx, emulation.NewSetUserAgentOverrideArgs(device.UserAgent)); err != nil {
+			return fmt.Errorf(`failed to override user agent: [device: %s, user_agent: %s, error: %w]`, name, device.UserAgent, err)
+		}
+	}
+	return nil
+}
+
+func expandViewportToFullPage(ctx context.Context, cl *cdp.Client, opt ShotOptions) (page.Viewport, error) {
+	metrics, err := cl.Page.GetLayoutMetrics(ctx)
 	if err != nil {
-		return nil, fmt.Errorf(`failed to build client: [error: %w]`, err)
+		return page.Viewport{}, fmt.Errorf(`failed to get layout metrics: [error: %w]`, err)
+	}
+	width := int(math.Ceil(metrics.ContentSize.Width))
+	height := int(math.Ceil(metrics.ContentSize.Height))
+	device, _ := GetDevice(opt.Device)
+	if err = cl.Emulation.SetDeviceMetricsOverride(ctx, emulation.NewSetDeviceMetricsOverrideArgs(width, height, opt.DeviceScaleFactor, device.Mobile)); err != nil {
+		return page.Viewport{}, fmt.Errorf(`failed to override device metrics: [width: %d, height: %d, error: %w]`, width, height, err)
+	}
+	return page.Viewport{Width: float64(width), Height: float64(height), Scale: 1}, nil
+}
+
+func quadToViewport(q dom.Quad, layout page.LayoutViewport) page.Viewport {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for i := 0; i+1 < len(q); i += 2 {
+		minX, maxX = math.Min(minX, q[i]), math.Max(maxX, q[i])
+		minY, maxY = math.Min(minY, q[i+1]), math.Max(maxY, q[i+1])
+	}
+	// box model is relative to viewport while clip is relative to document
+	return page.Viewport{X: minX + float64(layout.PageX), Y: minY + float64(layout.PageY), Width: maxX - minX, Height: maxY - minY, Scale: 1}
+}
+
+func getElementClip(ctx context.Context, cl *cdp.Client, root dom.NodeID, selector string) (page.Viewport, error) {
+	node, err := cl.DOM.QuerySelector(ctx, dom.NewQuerySelectorArgs(root, selector))
+	if err != nil {
+		return page.Viewport{}, fmt.Errorf(`failed to query selector: [selector: %s, error: %w]`, selector, err)
+	}
+	if node.NodeID == 0 {
+		return page.Viewport{}, fmt.Errorf(`element not found: [selector: %s]`, selector)
+	}
+	box, err := cl.DOM.GetBoxModel(ctx, dom.NewGetBoxModelArgs().SetNodeID(node.NodeID))
+	if err != nil {
+		return page.Viewport{}, fmt.Errorf(`failed to get box model: [selector: %s, error: %w]`, selector, err)
+	}
+	metrics, err := cl.Page.GetLayoutMetrics(ctx)
+	if err != nil {
+		return page.Viewport{}, fmt.Errorf(`failed to get layout metrics: [error: %w]`, err)
+	}
+	clip := quadToViewport(box.Model.Border, metrics.LayoutViewport)
+	if clip.Width <= 0 || clip.Height <= 0 {
+		return page.Viewport{}, fmt.Errorf(`element has empty box: [selector: %s]`, selector)
+	}
+	return clip, nil
+}
+
+// captureElements takes all element shots in one navigation. viewport is expanded to full page
+// so elements below the fold are rendered
+func captureElements(ctx context.Context, cl *cdp.Client, url string, opt ShotOptions) ([]Shot, error) {
+	if _, err := expandViewportToFullPage(ctx, cl, opt); err != nil {
+		return nil, fmt.Errorf(`failed to expand viewport to full page: [url: %s, error: %w]`, url, err)
+	}
+	doc, err := cl.DOM.GetDocument(ctx, dom.NewGetDocumentArgs())
+	if err != nil {
+		return nil, fmt.Errorf(`failed to get document: [url: %s, error: %w]`, url, err)
+	}
+	var shots []Shot
+	for _, selector := range opt.Selectors {
+		clip, err := getElementClip(ctx, cl, doc.Root.NodeID, selector)
+		if err != nil {
+			return nil, fmt.Errorf(`failed to get element clip: [url: %s, error: %w]`, url, err)
+		}
+		args := page.NewCaptureScreenshotArgs().
+			SetFormat(opt.Format).
+			SetQuality(opt.Quality).
+			SetClip(clip)
+		screenshot, err := cl.Page.CaptureScreenshot(ctx, args)
+		if err != nil {
+			return nil, fmt.Errorf(`failed to capture element screenshot [url: %s, selector: %s, error: %w]`, url, selector, err)
+		}
+		shots = append(shots, Shot{Selector: selector, Data: bytes.NewBuffer(screenshot.Data)})
+	}
+	return shots, nil
+}
+
+func printToPDF(ctx context.Context, cl *cdp.Client, url string, opt ShotOptions) ([]Shot, error) {
+	var pdfOpt PDFOptions
+	if opt.PDF != nil {
+		pdfOpt = *opt.PDF
+	}
+	reply, err := cl.Page.PrintToPDF(ctx, pdfOpt.printArgs())
+	if err != nil {
+		return nil, fmt.Errorf(`failed to print pdf [url: %s, options: %+v, error: %w]`, url, pdfOpt, err)
+	}
+	return []Shot{{Data: bytes.NewBuffer(reply.Data)}}, nil
+}
+
+func (c *ChromeShotMaker) MakeShot(ctx context.Context, url string, opt ShotOptions) ([]Shot, error) {
+	e, t, err := c.acquire(ctx)
+	if err != nil {
+		return nil, &connectionError{err: fmt.Errorf(`failed to acquire chrome target: [error: %w]`, err)}
+	}
+	defer c.b.done(e)
+	defer e.pool.release(t)
+	cl := t.cl
+	if err = overrideDeviceMetrics(ctx, cl, opt); err != nil {
+		return nil, err
+	}
+	if err = emulateDevice(ctx, cl, opt.Device); err != nil {
+		return nil, err
+	}
+	var tracker *networkTracker
+	if opt.WaitNetworkIdleMS > 0 {
+		// tracking starts before navigation to see requests made during page load
+		if tracker, err = startNetworkTracker(ctx, cl); err != nil {
+			return nil, err
+		}
+		defer tracker.close()
 	}
-	defer close()
 	if err = navigateToPage(ctx, cl, url); err != nil {
-		return nil, fmt.Errorf(`failed to navigate to page: [error: %s]`, err)
+		return nil, fmt.Errorf(`failed to navigate to page: [error: %w]`, err)
+	}
+	if err = waitForPage(ctx, cl, tracker, opt); err != nil {
+		return nil, fmt.Errorf(`failed to wait for page: [url: %s, error: %w]`, url, err)
+	}
+	if opt.Format == FormatPDF {
+		return printToPDF(ctx, cl, url, opt)
+	}
+	if len(opt.Selectors) > 0 {
+		return captureElements(ctx, cl, url, opt)
+	}
+	args := page.NewCaptureScreenshotArgs().
+		SetFormat(opt.Format).
+		SetQuality(opt.Quality)
+	if boolValue(opt.FullPage) {
+		clip, err := expandViewportToFullPage(ctx, cl, opt)
+		if err != nil {
+			return nil, fmt.Errorf(`failed to expand viewport to full page: [url: %s, error: %w]`, url, err)
+		}
+		args.SetClip(clip)
 	}
-	screenshot, err := cl.Page.CaptureScreenshot(ctx, page.NewCaptureScreenshotArgs().
-		SetFormat(format).
-		SetQuality(quality))
+	screenshot, err := cl.Page.CaptureScreenshot(ctx, args)
 	if err != nil {
-		return nil, fmt.Errorf(`failed to capture screenshot [url: %s, format: %s, quality: %d, error: %w]`,
-			url, format, quality, err)
+		return nil, fmt.Errorf(`failed to capture screenshot [url: %s, options: %+v, error: %w]`, url, opt, err)
 	}
-	buff := bytes.NewBuffer(screenshot.Data)
-	return buff, nil
+	return []Shot{{Data: bytes.NewBuffer(screenshot.Data)}}, nil
 }
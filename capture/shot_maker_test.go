@@ -7,19 +7,27 @@ import (
 	"testing"
 	"time"
 
+	"github.com/mafredri/cdp/protocol/dom"
+	"github.com/mafredri/cdp/protocol/page"
 	"github.com/stretchr/testify/require"
 )
 
+func TestQuadToViewport(t *testing.T) {
+	q := dom.Quad{10, 20, 110, 20, 110, 70, 10, 70}
+	require.Equal(t, page.Viewport{X: 10, Y: 520, Width: 100, Height: 50, Scale: 1}, quadToViewport(q, page.LayoutViewport{PageY: 500}))
+}
+
 const testChromeAddressEnvVariable = "SCREENSHOT_TEST_CHROME"
 
 func TestChromeShotMaker_MakeShot(t *testing.T) {
 	address := os.Getenv(testChromeAddressEnvVariable)
-	sm := NewChromeShotMaker(address)
+	sm := NewChromeShotMaker([]string{address}, ChromeConfig{Pool: PoolConfig{Size: 2}})
 	go func() {
-		image, err := sm.MakeShot(context.Background(), "http://facebook.com", "jpeg", 80)
+		shots, err := sm.MakeShot(context.Background(), "http://facebook.com", ShotOptions{Format: FormatJPEG, Quality: 80})
 		require.NoError(t, err)
 		// do not know how to automatically test screenshot generation
-		require.NotNil(t, image)
+		require.Len(t, shots, 1)
+		image := shots[0].Data
 
 		data, err := ioutil.ReadAll(image)
 		require.NoError(t, err)
@@ -27,14 +35,30 @@ func TestChromeShotMaker_MakeShot(t *testing.T) {
 	}()
 
 	go func() {
-		image, err := sm.MakeShot(context.Background(), "http://google.com", "jpeg", 80)
+		shots, err := sm.MakeShot(context.Background(), "http://google.com", ShotOptions{Format: FormatJPEG, Quality: 80, ViewportWidth: 375, ViewportHeight: 812, DeviceScaleFactor: 3, FullPage: Bool(true), Device: "iphone-x"})
 		require.NoError(t, err)
 		// do not know how to automatically test screenshot generation
-		require.NotNil(t, image)
+		require.Len(t, shots, 1)
+		image := shots[0].Data
 
 		data, err := ioutil.ReadAll(image)
 		require.NoError(t, err)
 		require.NoError(t, ioutil.WriteFile("image2.jpeg", data, os.ModePerm))
 	}()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+		defer cancel()
+		shots, err := sm.MakeShot(ctx, "http://google.com", ShotOptions{Format: FormatPNG, WaitNetworkIdleMS: 500, WaitSelector: "input[name=q]", WaitExpression: "document.readyState === 'complete'"})
+		require.NoError(t, err)
+		require.Len(t, shots, 1)
+	}()
+
+	go func() {
+		shots, err := sm.MakeShot(context.Background(), "http://google.com", ShotOptions{Format: FormatPNG, Selectors: []string{"body", "form"}})
+		require.NoError(t, err)
+		require.Len(t, shots, 2)
+		require.Equal(t, "form", shots[1].Selector)
+	}()
 	<-time.After(10 * time.Second)
 }
@@ -0,0 +1,64 @@
+package capture
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/leveldorado/screenshot/queue"
+)
+
+// ChromeStatsTopic is subscribed by every capture worker without queue group so each of them replies
+const ChromeStatsTopic = "chrome_stats"
+
+type WorkerStats struct {
+	Worker    string          `json:"worker"`
+	Endpoints []EndpointStats `json:"endpoints"`
+}
+
+type statsProvider interface {
+	Stats() []EndpointStats
+}
+
+type subscriber interface {
+	Subscribe(ctx context.Context, topic string) (<-chan queue.Message, error)
+	Reply(ctx context.Context, reply string, data interface{}) error
+}
+
+type StatsHandler struct {
+	sp     statsProvider
+	q      subscriber
+	worker string
+}
+
+func NewStatsHandler(sp statsProvider, q subscriber) *StatsHandler {
+	worker, err := os.Hostname()
+	if err != nil {
+		worker = "unknown"
+	}
+	return &StatsHandler{sp: sp, q: q, worker: fmt.Sprintf(`%s-%d`, worker, os.Getpid())}
+}
+
+func (h *StatsHandler) Run(ctx context.Context) error {
+	sub, err := h.q.Subscribe(ctx, ChromeStatsTopic)
+	if err != nil {
+		return fmt.Errorf(`failed to subscribe chrome stats topic: [error: %w]`, err)
+	}
+	go func() {
+		for msg := range sub {
+			if msg.Reply == "" {
+				continue
+			}
+			stats := WorkerStats{Worker: h.worker, Endpoints: h.sp.Stats()}
+			if err := h.q.Reply(ctx, msg.Reply, stats); err != nil {
+				log.Println(fmt.Sprintf(`failed to reply chrome stats: [reply: %s, error: %s]`, msg.Reply, err))
+			}
+		}
+	}()
+	return nil
+}
+
+func (h *StatsHandler) Stop(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,39 @@
+package capture
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/leveldorado/screenshot/queue"
+	"github.com/stretchr/testify/require"
+)
+
+type staticStats []EndpointStats
+
+func (s staticStats) Stats() []EndpointStats { return s }
+
+func TestStatsHandler_Run(t *testing.T) {
+	q := queue.NewMemory(10)
+	stats := staticStats{{Address: "localhost:9222", Healthy: true, Captures: 3}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, NewStatsHandler(stats, q).Run(ctx))
+	require.NoError(t, NewStatsHandler(stats, q).Run(ctx))
+
+	replies, err := q.Subscribe(ctx, "reply")
+	require.NoError(t, err)
+	require.NoError(t, q.Publish(ctx, ChromeStatsTopic, "reply", struct{}{}))
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-replies:
+			var ws WorkerStats
+			require.NoError(t, json.Unmarshal(msg.Data, &ws))
+			require.NotEmpty(t, ws.Worker)
+			require.Equal(t, []EndpointStats(stats), ws.Endpoints)
+		case <-time.After(time.Second):
+			t.Fatal("stats reply not received")
+		}
+	}
+}
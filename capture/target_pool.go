@@ -0,0 +1,289 @@
+package capture
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mafredri/cdp"
+	"github.com/mafredri/cdp/devtool"
+	"github.com/mafredri/cdp/protocol/runtime"
+	"github.com/mafredri/cdp/protocol/target"
+	"github.com/mafredri/cdp/rpcc"
+	"github.com/mafredri/cdp/session"
+)
+
+type PoolConfig struct {
+	// maximum number of concurrent captures and warm targets kept per chrome instance
+	Size               int           `yaml:"size"`
+	HealthCheckTimeout time.Duration `yaml:"health_check_timeout"`
+}
+
+const (
+	defaultPoolSize           = 4
+	defaultHealthCheckTimeout = 2 * time.Second
+	blankPageURL              = "about:blank"
+	// warm target is created in background, so its creation is not bound by capture context
+	replenishTimeout = 10 * time.Second
+)
+
+func (c PoolConfig) withDefaults() PoolConfig {
+	if c.Size <= 0 {
+		c.Size = defaultPoolSize
+	}
+	if c.HealthCheckTimeout <= 0 {
+		c.HealthCheckTimeout = defaultHealthCheckTimeout
+	}
+	return c
+}
+
+// browserConn is single browser level connection. page targets are attached to it as sessions
+type browserConn struct {
+	conn     *rpcc.Conn
+	cl       *cdp.Client
+	sessions *session.Manager
+}
+
+func (b *browserConn) alive() bool {
+	select {
+	case <-b.conn.Context().Done():
+		return false
+	default:
+		return true
+	}
+}
+
+func (b *browserConn) close() {
+	b.sessions.Close()
+	b.conn.Close()
+}
+
+// pooledTarget is page target living in own browser context. it serves single capture, so captures never share
+// cookies, storage or cache
+type pooledTarget struct {
+	browser   *browserConn
+	contextID target.BrowserContextID
+	targetID  target.ID
+	conn      *rpcc.Conn
+	cl        *cdp.Client
+}
+
+type targetPool struct {
+	addr  string
+	cfg   PoolConfig
+	slots chan struct{}
+
+	mu      sync.Mutex
+	browser *browserConn
+	idle    []*pooledTarget
+	closed  bool
+	// warm targets being created in background, close waits for them so browser is not dialed again after it
+	replenishing sync.WaitGroup
+}
+
+var errPoolClosed = errors.New("target pool is closed")
+
+func newTargetPool(addr string, cfg PoolConfig) *targetPool {
+	cfg = cfg.withDefaults()
+	return &targetPool{addr: addr, cfg: cfg, slots: make(chan struct{}, cfg.Size)}
+}
+
+func (p *targetPool) getBrowser(ctx context.Context) (*browserConn, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, fmt.Errorf(`failed to get browser: [chrome_address: %s, error: %w]`, p.addr, errPoolClosed)
+	}
+	if p.browser != nil && p.browser.alive() {
+		return p.browser, nil
+	}
+	if p.browser != nil {
+		p.browser.close()
+		p.browser = nil
+	}
+	ver, err := devtool.New(p.addr).Version(ctx)
+	if err != nil {
+		return nil, fmt.Errorf(`failed to get browser version: [chrome_address: %s, error: %w]`, p.addr, err)
+	}
+	conn, err := rpcc.DialContext(ctx, ver.WebSocketDebuggerURL)
+	if err != nil {
+		return nil, fmt.Errorf(`failed to dial browser web socket debugger url: [url: %s, error: %w]`, ver.WebSocketDebuggerURL, err)
+	}
+	cl := cdp.NewClient(conn)
+	sessions, err := session.NewManager(cl)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf(`failed to create session manager: [chrome_address: %s, error: %w]`, p.addr, err)
+	}
+	p.browser = &browserConn{conn: conn, cl: cl, sessions: sessions}
+	return p.browser, nil
+}
+
+func (p *targetPool) create(ctx context.Context) (*pooledTarget, error) {
+	b, err := p.getBrowser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	bc, err := b.cl.Target.CreateBrowserContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf(`failed to create browser context: [chrome_address: %s, error: %w]`, p.addr, err)
+	}
+	t := &pooledTarget{browser: b, contextID: bc.BrowserContextID}
+	pt, err := b.cl.Target.CreateTarget(ctx, target.NewCreateTargetArgs(blankPageURL).SetBrowserContextID(bc.BrowserContextID))
+	if err != nil {
+		p.destroy(t)
+		return nil, fmt.Errorf(`failed to create page target: [chrome_address: %s, error: %w]`, p.addr, err)
+	}
+	t.targetID = pt.TargetID
+	if t.conn, err = b.sessions.Dial(ctx, pt.TargetID); err != nil {
+		p.destroy(t)
+		return nil, fmt.Errorf(`failed to attach to page target: [target_id: %s, error: %w]`, pt.TargetID, err)
+	}
+	t.cl = cdp.NewClient(t.conn)
+	return t, nil
+}
+
+func (p *targetPool) destroy(t *pooledTarget) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.cfg.HealthCheckTimeout)
+	defer cancel()
+	if t.conn != nil {
+		t.conn.Close()
+	}
+	if !t.browser.alive() {
+		return
+	}
+	if t.targetID != "" {
+		if _, err := t.browser.cl.Target.CloseTarget(ctx, target.NewCloseTargetArgs(t.targetID)); err != nil {
+			log.Println(fmt.Sprintf(`failed to close page target: [target_id: %s, error: %s]`, t.targetID, err))
+		}
+	}
+	if err := t.browser.cl.Target.DisposeBrowserContext(ctx, target.NewDisposeBrowserContextArgs(t.contextID)); err != nil {
+		log.Println(fmt.Sprintf(`failed to dispose browser context: [context_id: %s, error: %s]`, t.contextID, err))
+	}
+}
+
+func (p *targetPool) healthy(t *pooledTarget) bool {
+	if !t.browser.alive() {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.cfg.HealthCheckTimeout)
+	defer cancel()
+	_, err := t.cl.Runtime.Evaluate(ctx, runtime.NewEvaluateArgs("1"))
+	return err == nil
+}
+
+func (p *targetPool) popIdle() *pooledTarget {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.idle) == 0 {
+		return nil
+	}
+	t := p.idle[len(p.idle)-1]
+	p.idle = p.idle[:len(p.idle)-1]
+	return t
+}
+
+// pushIdle keeps target warm unless pool is closed or already has warm target for every slot
+func (p *targetPool) pushIdle(t *pooledTarget) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed || len(p.idle) >= p.cfg.Size {
+		return false
+	}
+	p.idle = append(p.idle, t)
+	return true
+}
+
+// acquire waits for free slot and returns healthy warm target or creates new one
+func (p *targetPool) acquire(ctx context.Context) (*pooledTarget, error) {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, fmt.Errorf(`timeout waiting for free chrome target: [pool_size: %d, error: %w]`, p.cfg.Size, ctx.Err())
+	}
+	for t := p.popIdle(); t != nil; t = p.popIdle() {
+		if p.healthy(t) {
+			return t, nil
+		}
+		p.destroy(t)
+	}
+	t, err := p.create(ctx)
+	if err != nil {
+		<-p.slots
+		return nil, err
+	}
+	return t, nil
+}
+
+// release disposes target with its browser context after capture and creates fresh one in background, so pool
+// stays warm without carrying state of one capture into the next
+func (p *targetPool) release(t *pooledTarget) {
+	p.destroy(t)
+	<-p.slots
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	p.replenishing.Add(1)
+	go func() {
+		defer p.replenishing.Done()
+		p.replenish()
+	}()
+}
+
+func (p *targetPool) replenish() {
+	p.mu.Lock()
+	closed := p.closed
+	p.mu.Unlock()
+	if closed {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), replenishTimeout)
+	defer cancel()
+	t, err := p.create(ctx)
+	if err != nil {
+		log.Println(fmt.Sprintf(`failed to create warm page target: [chrome_address: %s, error: %s]`, p.addr, err))
+		return
+	}
+	if !p.pushIdle(t) {
+		p.destroy(t)
+	}
+}
+
+// warmup creates targets up to pool size so first captures do not wait for target creation
+func (p *targetPool) warmup(ctx context.Context) error {
+	for i := 0; i < p.cfg.Size; i++ {
+		t, err := p.acquire(ctx)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if !p.pushIdle(t) {
+				p.destroy(t)
+			}
+			<-p.slots
+		}()
+	}
+	return nil
+}
+
+func (p *targetPool) close() {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+	// target created meanwhile is rejected by pushIdle and destroyed before browser is closed below
+	p.replenishing.Wait()
+	for t := p.popIdle(); t != nil; t = p.popIdle() {
+		p.destroy(t)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.browser != nil {
+		p.browser.close()
+		p.browser = nil
+	}
+}
@@ -0,0 +1,68 @@
+package capture
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoolConfig_WithDefaults(t *testing.T) {
+	require.Equal(t, PoolConfig{Size: defaultPoolSize, HealthCheckTimeout: defaultHealthCheckTimeout}, PoolConfig{}.withDefaults())
+	cfg := PoolConfig{Size: 10, HealthCheckTimeout: time.Second}
+	require.Equal(t, cfg, cfg.withDefaults())
+}
+
+func TestTargetPool_AcquireWaitsForFreeSlot(t *testing.T) {
+	p := newTargetPool("http://localhost:0", PoolConfig{Size: 1})
+	p.slots <- struct{}{}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := p.acquire(ctx)
+	require.Error(t, err)
+	require.Len(t, p.slots, 1)
+}
+
+func TestTargetPool_AcquireReleasesSlotOnCreateError(t *testing.T) {
+	p := newTargetPool("http://localhost:0", PoolConfig{Size: 1})
+	_, err := p.acquire(context.Background())
+	require.Error(t, err)
+	require.Len(t, p.slots, 0)
+}
+
+func TestTargetPool_PushIdleKeepsTargetPerSlot(t *testing.T) {
+	p := newTargetPool("http://localhost:0", PoolConfig{Size: 1})
+	require.True(t, p.pushIdle(&pooledTarget{}))
+	require.False(t, p.pushIdle(&pooledTarget{}))
+	require.NotNil(t, p.popIdle())
+	p.closed = true
+	require.False(t, p.pushIdle(&pooledTarget{}))
+}
+
+func TestTargetPool_ClosedPoolDoesNotDialBrowser(t *testing.T) {
+	p := newTargetPool("http://localhost:0", PoolConfig{Size: 1})
+	p.close()
+	_, err := p.getBrowser(context.Background())
+	require.True(t, errors.Is(err, errPoolClosed))
+	p.replenish()
+	require.Nil(t, p.browser)
+}
+
+func TestTargetPool_CloseWaitsForReplenish(t *testing.T) {
+	p := newTargetPool("http://localhost:0", PoolConfig{Size: 1})
+	p.replenishing.Add(1)
+	closed := make(chan struct{})
+	go func() {
+		p.close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("pool is closed while target is being replenished")
+	case <-time.After(10 * time.Millisecond):
+	}
+	p.replenishing.Done()
+	<-closed
+}
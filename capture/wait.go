@@ -0,0 +1,194 @@
+package capture
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mafredri/cdp"
+	"github.com/mafredri/cdp/protocol/network"
+	"github.com/mafredri/cdp/protocol/runtime"
+	"github.com/mafredri/cdp/rpcc"
+)
+
+const waitPollInterval = 100 * time.Millisecond
+
+// networkTracker counts in-flight requests of page from Network domain events
+type networkTracker struct {
+	mu         sync.Mutex
+	inFlight   map[network.RequestID]struct{}
+	lastChange time.Time
+	streams    []rpcc.Stream
+}
+
+func startNetworkTracker(ctx context.Context, cl *cdp.Client) (*networkTracker, error) {
+	t := &networkTracker{inFlight: map[network.RequestID]struct{}{}, lastChange: time.Now()}
+	sent, err := cl.Network.RequestWillBeSent(ctx)
+	if err != nil {
+		return nil, fmt.Errorf(`failed to create request will be sent event client: [error: %w]`, err)
+	}
+	t.streams = append(t.streams, sent)
+	finished, err := cl.Network.LoadingFinished(ctx)
+	if err != nil {
+		t.close()
+		return nil, fmt.Errorf(`failed to create loading finished event client: [error: %w]`, err)
+	}
+	t.streams = append(t.streams, finished)
+	failed, err := cl.Network.LoadingFailed(ctx)
+	if err != nil {
+		t.close()
+		return nil, fmt.Errorf(`failed to create loading failed event client: [error: %w]`, err)
+	}
+	t.streams = append(t.streams, failed)
+	if err = cl.Network.Enable(ctx, network.NewEnableArgs()); err != nil {
+		t.close()
+		return nil, fmt.Errorf(`failed to enable network domain notification: [error: %w]`, err)
+	}
+	go func() {
+		for {
+			ev, err := sent.Recv()
+			if err != nil {
+				return
+			}
+			t.update(ev.RequestID, true)
+		}
+	}()
+	go func() {
+		for {
+			ev, err := finished.Recv()
+			if err != nil {
+				return
+			}
+			t.update(ev.RequestID, false)
+		}
+	}()
+	go func() {
+		for {
+			ev, err := failed.Recv()
+			if err != nil {
+				return
+			}
+			t.update(ev.RequestID, false)
+		}
+	}()
+	return t, nil
+}
+
+func (t *networkTracker) update(id network.RequestID, started bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if started {
+		t.inFlight[id] = struct{}{}
+	} else {
+		delete(t.inFlight, id)
+	}
+	t.lastChange = time.Now()
+}
+
+func (t *networkTracker) idleFor() (int, time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.inFlight) > 0 {
+		return len(t.inFlight), 0
+	}
+	return 0, time.Since(t.lastChange)
+}
+
+func (t *networkTracker) close() {
+	for _, s := range t.streams {
+		s.Close()
+	}
+}
+
+// waitIdle waits until there are no in-flight requests for idle duration
+func (t *networkTracker) waitIdle(ctx context.Context, idle time.Duration) error {
+	ticker := time.NewTicker(waitPollInterval)
+	defer ticker.Stop()
+	for {
+		inFlight, idleFor := t.idleFor()
+		if inFlight == 0 && idleFor >= idle {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf(`timeout waiting for network idle: [idle_ms: %d, in_flight_requests: %d, error: %w]`, idle.Milliseconds(), inFlight, ctx.Err())
+		}
+	}
+}
+
+// waitForExpression evaluates expression in page until it becomes truthy. exceptions are not fatal
+// because expression may refer to objects which page creates later
+func waitForExpression(ctx context.Context, rt cdp.Runtime, expression string) error {
+	args := runtime.NewEvaluateArgs(fmt.Sprintf(`!!(%s)`, expression)).SetReturnByValue(true)
+	ticker := time.NewTicker(waitPollInterval)
+	defer ticker.Stop()
+	var lastErr string
+	for {
+		reply, err := rt.Evaluate(ctx, args)
+		switch {
+		case err != nil:
+			lastErr = err.Error()
+		case reply.ExceptionDetails != nil:
+			lastErr = reply.ExceptionDetails.Text
+			if reply.ExceptionDetails.Exception != nil && reply.ExceptionDetails.Exception.Description != nil {
+				lastErr = *reply.ExceptionDetails.Exception.Description
+			}
+		default:
+			var truthy bool
+			if err = json.Unmarshal(reply.Result.Value, &truthy); err == nil && truthy {
+				return nil
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf(`timeout waiting for expression: [expression: %s, last_error: %s, error: %w]`, expression, lastErr, ctx.Err())
+		}
+	}
+}
+
+func waitForSelector(ctx context.Context, rt cdp.Runtime, selector string) error {
+	quoted, err := json.Marshal(selector)
+	if err != nil {
+		return fmt.Errorf(`failed to quote selector: [selector: %s, error: %w]`, selector, err)
+	}
+	if err = waitForExpression(ctx, rt, fmt.Sprintf(`document.querySelector(%s) !== null`, quoted)); err != nil {
+		return fmt.Errorf(`failed to wait for selector: [selector: %s, error: %w]`, selector, err)
+	}
+	return nil
+}
+
+// waitForPage applies wait conditions after page stopped loading. all of them are bounded by ctx deadline
+func waitForPage(ctx context.Context, cl *cdp.Client, tracker *networkTracker, opt ShotOptions) error {
+	if tracker != nil {
+		if err := tracker.waitIdle(ctx, time.Duration(opt.WaitNetworkIdleMS)*time.Millisecond); err != nil {
+			return err
+		}
+	}
+	if opt.WaitSelector != "" {
+		if err := waitForSelector(ctx, cl.Runtime, opt.WaitSelector); err != nil {
+			return err
+		}
+	}
+	if opt.WaitExpression != "" {
+		if err := waitForExpression(ctx, cl.Runtime, opt.WaitExpression); err != nil {
+			return err
+		}
+	}
+	return waitDelay(ctx, opt.DelayMS)
+}
+
+func waitDelay(ctx context.Context, delayMS int) error {
+	if delayMS == 0 {
+		return nil
+	}
+	select {
+	case <-time.After(time.Duration(delayMS) * time.Millisecond):
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf(`context done before delay elapsed: [delay_ms: %d, error: %w]`, delayMS, ctx.Err())
+	}
+}
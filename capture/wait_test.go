@@ -0,0 +1,161 @@
+package capture
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mafredri/cdp"
+	"github.com/mafredri/cdp/protocol/network"
+	"github.com/mafredri/cdp/protocol/runtime"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestNetworkTracker() *networkTracker {
+	return &networkTracker{inFlight: map[network.RequestID]struct{}{}, lastChange: time.Now()}
+}
+
+type networkEvent struct {
+	id      network.RequestID
+	started bool
+}
+
+func TestNetworkTracker_Update(t *testing.T) {
+	for name, tc := range map[string]struct {
+		events   []networkEvent
+		inFlight int
+	}{
+		"no requests":          {inFlight: 0},
+		"request in flight":    {events: []networkEvent{{id: "1", started: true}}, inFlight: 1},
+		"request finished":     {events: []networkEvent{{id: "1", started: true}, {id: "1"}}, inFlight: 0},
+		"one of two finished":  {events: []networkEvent{{id: "1", started: true}, {id: "2", started: true}, {id: "2"}}, inFlight: 1},
+		"request failed":       {events: []networkEvent{{id: "1", started: true}, {id: "2", started: true}, {id: "1"}, {id: "2"}}, inFlight: 0},
+		"unknown finished":     {events: []networkEvent{{id: "1", started: true}, {id: "2"}}, inFlight: 1},
+		"redirect same id":     {events: []networkEvent{{id: "1", started: true}, {id: "1", started: true}, {id: "1"}}, inFlight: 0},
+		"finished then reused": {events: []networkEvent{{id: "1", started: true}, {id: "1"}, {id: "1", started: true}}, inFlight: 1},
+	} {
+		tr := newTestNetworkTracker()
+		for _, ev := range tc.events {
+			tr.update(ev.id, ev.started)
+		}
+		inFlight, idleFor := tr.idleFor()
+		require.Equal(t, tc.inFlight, inFlight, name)
+		if inFlight > 0 {
+			require.Zero(t, idleFor, name)
+		}
+	}
+}
+
+func TestNetworkTracker_IdleWindowResets(t *testing.T) {
+	tr := newTestNetworkTracker()
+	tr.lastChange = time.Now().Add(-time.Minute)
+	_, idleFor := tr.idleFor()
+	require.True(t, idleFor >= time.Minute)
+
+	// request which started and finished meanwhile starts idle window again
+	tr.update("1", true)
+	tr.update("1", false)
+	_, idleFor = tr.idleFor()
+	require.True(t, idleFor < time.Minute)
+}
+
+func TestNetworkTracker_WaitIdle(t *testing.T) {
+	tr := newTestNetworkTracker()
+	tr.update("1", true)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		tr.update("1", false)
+	}()
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, tr.waitIdle(ctx, 200*time.Millisecond))
+	require.True(t, time.Since(start) >= 250*time.Millisecond)
+}
+
+func TestNetworkTracker_WaitIdleTimeout(t *testing.T) {
+	tr := newTestNetworkTracker()
+	tr.update("1", true)
+	tr.update("2", true)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := tr.waitIdle(ctx, 500*time.Millisecond)
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+	require.Contains(t, err.Error(), "timeout waiting for network idle")
+	require.Contains(t, err.Error(), "idle_ms: 500")
+	require.Contains(t, err.Error(), "in_flight_requests: 2")
+}
+
+// fakeRuntime replies to evaluate with replies in order, the last one is repeated
+type fakeRuntime struct {
+	cdp.Runtime
+	mu          sync.Mutex
+	replies     []fakeEvaluation
+	expressions []string
+}
+
+type fakeEvaluation struct {
+	reply *runtime.EvaluateReply
+	err   error
+}
+
+func (f *fakeRuntime) Evaluate(ctx context.Context, args *runtime.EvaluateArgs) (*runtime.EvaluateReply, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.expressions = append(f.expressions, args.Expression)
+	ev := f.replies[0]
+	if len(f.replies) > 1 {
+		f.replies = f.replies[1:]
+	}
+	return ev.reply, ev.err
+}
+
+func evaluated(value string) fakeEvaluation {
+	return fakeEvaluation{reply: &runtime.EvaluateReply{Result: runtime.RemoteObject{Type: "boolean", Value: json.RawMessage(value)}}}
+}
+
+func TestWaitForExpression(t *testing.T) {
+	rt := &fakeRuntime{replies: []fakeEvaluation{
+		{reply: &runtime.EvaluateReply{ExceptionDetails: &runtime.ExceptionDetails{Text: "Uncaught"}}},
+		evaluated("false"),
+		evaluated("true"),
+	}}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, waitForExpression(ctx, rt, "window.appReady"))
+	require.Equal(t, []string{"!!(window.appReady)", "!!(window.appReady)", "!!(window.appReady)"}, rt.expressions)
+}
+
+func TestWaitForExpressionTimeout(t *testing.T) {
+	description := "ReferenceError: appReady is not defined"
+	for name, tc := range map[string]struct {
+		reply     fakeEvaluation
+		lastError string
+	}{
+		"falsy":     {reply: evaluated("false"), lastError: "last_error: ,"},
+		"exception": {reply: fakeEvaluation{reply: &runtime.EvaluateReply{ExceptionDetails: &runtime.ExceptionDetails{Text: "Uncaught", Exception: &runtime.RemoteObject{Description: &description}}}}, lastError: "last_error: " + description},
+		"text only": {reply: fakeEvaluation{reply: &runtime.EvaluateReply{ExceptionDetails: &runtime.ExceptionDetails{Text: "Uncaught"}}}, lastError: "last_error: Uncaught"},
+		"rpc error": {reply: fakeEvaluation{err: errors.New("connection closed")}, lastError: "last_error: connection closed"},
+	} {
+		rt := &fakeRuntime{replies: []fakeEvaluation{tc.reply}}
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		err := waitForExpression(ctx, rt, "appReady")
+		cancel()
+		require.True(t, errors.Is(err, context.DeadlineExceeded), name)
+		require.Contains(t, err.Error(), "timeout waiting for expression: [expression: appReady", name)
+		require.Contains(t, err.Error(), tc.lastError, name)
+	}
+}
+
+func TestWaitForSelectorTimeout(t *testing.T) {
+	rt := &fakeRuntime{replies: []fakeEvaluation{evaluated("false")}}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := waitForSelector(ctx, rt, `#app "loaded"`)
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+	require.Contains(t, err.Error(), `failed to wait for selector: [selector: #app "loaded"`)
+	require.Equal(t, `!!(document.querySelector("#app \"loaded\"") !== null)`, rt.expressions[0])
+}
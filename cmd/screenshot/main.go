@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/leveldorado/screenshot/bootstrap"
@@ -26,12 +27,14 @@ func main() {
 		log.Println(fmt.Sprintf("failed to run runner: [error: %s]", err))
 		os.Exit(1)
 	}
-	quit := make(chan os.Signal)
-	signal.Notify(quit, os.Interrupt, os.Kill)
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 	<-quit
-	cancel()
-	stopContext, _ := context.WithTimeout(context.Background(), gracefulShutdownPeriod)
+	// runner is stopped before context is canceled so in-flight captures can finish and reply
+	stopContext, stopCancel := context.WithTimeout(context.Background(), gracefulShutdownPeriod)
+	defer stopCancel()
 	if err := r.Stop(stopContext); err != nil {
 		log.Println(fmt.Sprintf(`failed to stop runner with error: %s`, err))
 	}
+	cancel()
 }
@@ -0,0 +1,184 @@
+package diff
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+
+	// register decoders for formats produced by capture
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+const (
+	// changed pixels are grouped into cells of this size to build regions
+	regionCellSize = 16
+	// decoded image and diff image take 4 bytes per pixel each, so it bounds memory taken by one diff
+	MaxPixels = 50 << 20
+)
+
+var ErrImageTooLarge = errors.New("image is too large")
+
+var highlightColor = color.RGBA{R: 255, A: 255}
+
+type Options struct {
+	// maximum per channel difference (0-255) which is not counted as change. helps to ignore jpeg compression noise
+	Tolerance uint8
+}
+
+type Region struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+type Result struct {
+	Width         int      `json:"width"`
+	Height        int      `json:"height"`
+	ChangedPixels int      `json:"changed_pixels"`
+	TotalPixels   int      `json:"total_pixels"`
+	ChangedRatio  float64  `json:"changed_ratio"`
+	Regions       []Region `json:"regions"`
+	// image of target version with unchanged pixels faded and changed pixels in red
+	Image *image.RGBA `json:"-"`
+}
+
+// Decode checks dimensions from image header before pixels are decoded, so image over MaxPixels is rejected with
+// ErrImageTooLarge without allocating it
+func Decode(r io.Reader) (image.Image, error) {
+	header := &bytes.Buffer{}
+	cfg, _, err := image.DecodeConfig(io.TeeReader(r, header))
+	if err != nil {
+		return nil, fmt.Errorf(`failed to decode image config: [error: %w]`, err)
+	}
+	if err = checkSize(cfg.Width, cfg.Height); err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(io.MultiReader(header, r))
+	if err != nil {
+		return nil, fmt.Errorf(`failed to decode image: [error: %w]`, err)
+	}
+	return img, nil
+}
+
+func checkSize(width, height int) error {
+	if width < 0 || height < 0 || (height > 0 && width > MaxPixels/height) {
+		return fmt.Errorf(`failed to check image size: [width: %d, height: %d, max_pixels: %d, error: %w]`, width, height, MaxPixels, ErrImageTooLarge)
+	}
+	return nil
+}
+
+// Compare compares images pixel by pixel. if sizes differ area covered only by one of images is counted as changed.
+// it returns ErrImageTooLarge when area covering both images is over MaxPixels
+func Compare(from, to image.Image, opt Options) (Result, error) {
+	fb, tb := from.Bounds(), to.Bounds()
+	width, height := max(fb.Dx(), tb.Dx()), max(fb.Dy(), tb.Dy())
+	if err := checkSize(width, height); err != nil {
+		return Result{}, err
+	}
+	f, t := toRGBA(from), toRGBA(to)
+	res := Result{Width: width, Height: height, TotalPixels: width * height, Image: image.NewRGBA(image.Rect(0, 0, width, height))}
+	cellsX, cellsY := (width+regionCellSize-1)/regionCellSize, (height+regionCellSize-1)/regionCellSize
+	// bounds of changed pixels inside every cell, empty for cells without changes
+	cells := make([]image.Rectangle, cellsX*cellsY)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			out := res.Image.Pix[res.Image.PixOffset(x, y):]
+			if x < fb.Dx() && y < fb.Dy() && x < tb.Dx() && y < tb.Dy() {
+				fp, tp := f.Pix[f.PixOffset(x, y):], t.Pix[t.PixOffset(x, y):]
+				if !isChanged(fp, tp, opt.Tolerance) {
+					fade(out, tp)
+					continue
+				}
+			}
+			res.ChangedPixels++
+			out[0], out[1], out[2], out[3] = highlightColor.R, highlightColor.G, highlightColor.B, highlightColor.A
+			i := (y/regionCellSize)*cellsX + x/regionCellSize
+			cells[i] = cells[i].Union(image.Rect(x, y, x+1, y+1))
+		}
+	}
+	if res.TotalPixels > 0 {
+		res.ChangedRatio = float64(res.ChangedPixels) / float64(res.TotalPixels)
+	}
+	res.Regions = buildRegions(cells, cellsX, cellsY)
+	return res, nil
+}
+
+// toRGBA returns image as *image.RGBA starting at zero point, so pixels are read from Pix slice instead of At. decoders
+// produce other types (e.g. *image.NRGBA for png, *image.YCbCr for jpeg), draw converts them by its fast paths
+func toRGBA(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	if rgba, ok := img.(*image.RGBA); ok && b.Min == (image.Point{}) {
+		return rgba
+	}
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	return rgba
+}
+
+// isChanged compares pixels given as the first 4 bytes (r, g, b, a) of slices
+func isChanged(a, b []byte, tolerance uint8) bool {
+	return channelDiff(a[0], b[0]) > tolerance || channelDiff(a[1], b[1]) > tolerance ||
+		channelDiff(a[2], b[2]) > tolerance || channelDiff(a[3], b[3]) > tolerance
+}
+
+func channelDiff(a, b uint8) uint8 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// fade writes pale copy of unchanged pixel c to out so highlighted changes stand out
+func fade(out, c []byte) {
+	gray := uint8((uint16(c[0]) + uint16(c[1]) + uint16(c[2])) / 3)
+	v := 255 - (255-gray)/4
+	out[0], out[1], out[2], out[3] = v, v, v, 255
+}
+
+// buildRegions joins adjacent changed cells (including diagonal) into bounding boxes
+func buildRegions(cells []image.Rectangle, cellsX, cellsY int) []Region {
+	visited := make([]bool, len(cells))
+	regions := []Region{}
+	for start := range cells {
+		if cells[start].Empty() || visited[start] {
+			continue
+		}
+		bounds := image.Rectangle{}
+		stack := []int{start}
+		visited[start] = true
+		for len(stack) > 0 {
+			i := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			bounds = bounds.Union(cells[i])
+			cx, cy := i%cellsX, i/cellsX
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					nx, ny := cx+dx, cy+dy
+					if nx < 0 || ny < 0 || nx >= cellsX || ny >= cellsY {
+						continue
+					}
+					n := ny*cellsX + nx
+					if !cells[n].Empty() && !visited[n] {
+						visited[n] = true
+						stack = append(stack, n)
+					}
+				}
+			}
+		}
+		regions = append(regions, Region{X: bounds.Min.X, Y: bounds.Min.Y, Width: bounds.Dx(), Height: bounds.Dy()})
+	}
+	return regions
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
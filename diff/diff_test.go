@@ -0,0 +1,123 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func filledImage(width, height int, c color.Color) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+	return img
+}
+
+func TestCompare(t *testing.T) {
+	from := filledImage(100, 50, color.White)
+	to := filledImage(100, 50, color.White)
+	draw.Draw(to, image.Rect(10, 10, 20, 15), image.Black, image.Point{}, draw.Src)
+	draw.Draw(to, image.Rect(80, 40, 90, 50), image.Black, image.Point{}, draw.Src)
+	draw.Draw(to, image.Rect(22, 12, 30, 14), image.Black, image.Point{}, draw.Src)
+	res, err := Compare(from, to, Options{})
+	require.NoError(t, err)
+	require.Equal(t, 100, res.Width)
+	require.Equal(t, 50, res.Height)
+	require.Equal(t, 5000, res.TotalPixels)
+	require.Equal(t, 166, res.ChangedPixels)
+	require.InDelta(t, 0.0332, res.ChangedRatio, 0.0001)
+	require.Equal(t, []Region{{X: 10, Y: 10, Width: 20, Height: 5}, {X: 80, Y: 40, Width: 10, Height: 10}}, res.Regions)
+	require.Equal(t, highlightColor, res.Image.RGBAAt(15, 12))
+	require.NotEqual(t, highlightColor, res.Image.RGBAAt(50, 25))
+}
+
+func TestCompareTolerance(t *testing.T) {
+	from := filledImage(10, 10, color.RGBA{R: 100, G: 100, B: 100, A: 255})
+	to := filledImage(10, 10, color.RGBA{R: 104, G: 98, B: 100, A: 255})
+	res, err := Compare(from, to, Options{})
+	require.NoError(t, err)
+	require.Equal(t, 100, res.ChangedPixels)
+	res, err = Compare(from, to, Options{Tolerance: 5})
+	require.NoError(t, err)
+	require.Equal(t, 0, res.ChangedPixels)
+	require.Empty(t, res.Regions)
+}
+
+func TestCompareDifferentSizes(t *testing.T) {
+	from := filledImage(10, 10, color.White)
+	to := filledImage(10, 20, color.White)
+	res, err := Compare(from, to, Options{})
+	require.NoError(t, err)
+	require.Equal(t, 200, res.TotalPixels)
+	require.Equal(t, 100, res.ChangedPixels)
+	require.Equal(t, []Region{{X: 0, Y: 10, Width: 10, Height: 10}}, res.Regions)
+}
+
+func TestDecode(t *testing.T) {
+	buff := &bytes.Buffer{}
+	require.NoError(t, png.Encode(buff, filledImage(3, 2, color.Black)))
+	img, err := Decode(buff)
+	require.NoError(t, err)
+	require.Equal(t, image.Rect(0, 0, 3, 2), img.Bounds())
+	_, err = Decode(bytes.NewReader([]byte("not an image")))
+	require.Error(t, err)
+}
+
+func TestCompareDecodedTypes(t *testing.T) {
+	from := image.NewNRGBA(image.Rect(0, 0, 20, 20))
+	draw.Draw(from, from.Bounds(), image.White, image.Point{}, draw.Src)
+	to := filledImage(30, 30, color.White)
+	draw.Draw(to, image.Rect(15, 15, 20, 20), image.Black, image.Point{}, draw.Src)
+	// sub image does not start at zero point
+	res, err := Compare(from, to.SubImage(image.Rect(10, 10, 30, 30)), Options{})
+	require.NoError(t, err)
+	require.Equal(t, 400, res.TotalPixels)
+	require.Equal(t, 25, res.ChangedPixels)
+	require.Equal(t, []Region{{X: 5, Y: 5, Width: 5, Height: 5}}, res.Regions)
+	require.Equal(t, highlightColor, res.Image.RGBAAt(7, 7))
+
+	ycbcr := image.NewYCbCr(image.Rect(0, 0, 20, 20), image.YCbCrSubsampleRatio444)
+	for i := range ycbcr.Y {
+		ycbcr.Y[i], ycbcr.Cb[i], ycbcr.Cr[i] = 255, 128, 128
+	}
+	res, err = Compare(from, ycbcr, Options{})
+	require.NoError(t, err)
+	require.Zero(t, res.ChangedPixels)
+}
+
+func TestCompareTooLarge(t *testing.T) {
+	_, err := Compare(filledImage(1, 1, color.White), image.NewUniform(color.White), Options{})
+	require.True(t, errors.Is(err, ErrImageTooLarge))
+}
+
+// pngHeader is png signature and header chunk, enough for decoding of image config
+func pngHeader(width, height uint32) []byte {
+	chunk := make([]byte, 17)
+	copy(chunk, "IHDR")
+	binary.BigEndian.PutUint32(chunk[4:], width)
+	binary.BigEndian.PutUint32(chunk[8:], height)
+	// bit depth 8, rgba
+	chunk[12], chunk[13] = 8, 6
+	data := []byte("\x89PNG\r\n\x1a\n")
+	data = append(data, 0, 0, 0, 13)
+	data = append(data, chunk...)
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(chunk))
+	return append(data, crc...)
+}
+
+func TestDecodeTooLarge(t *testing.T) {
+	_, err := Decode(bytes.NewReader(pngHeader(100000, 100000)))
+	require.True(t, errors.Is(err, ErrImageTooLarge))
+	// header within limit is decoded further and fails on missing pixel data
+	_, err = Decode(bytes.NewReader(pngHeader(10, 10)))
+	require.Error(t, err)
+	require.False(t, errors.Is(err, ErrImageTooLarge))
+}
@@ -0,0 +1,278 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+type JetStreamConfig struct {
+	Stream string `yaml:"stream"`
+	// topics kept in stream until they are acknowledged. other topics go through core nats
+	Subjects []string      `yaml:"subjects"`
+	MaxAge   time.Duration `yaml:"max_age"`
+	Replicas int           `yaml:"replicas"`
+	// message is delivered again when it is not acknowledged within ack wait (e.g. worker crashed)
+	AckWait time.Duration `yaml:"ack_wait"`
+	// message is not delivered any more after this number of deliveries
+	MaxDeliver int `yaml:"max_deliver"`
+	// builds dead letter of message delivered for the last time, it is published instead of handing message to
+	// consumer. nil hands message to consumer and it is dropped when it is not acknowledged again
+	DeadLetter func(data []byte, deliveries int) (topic string, msg interface{}) `yaml:"-"`
+}
+
+const (
+	defaultJetStreamStream = "SHOT_REQUESTS"
+	defaultJetStreamMaxAge = 24 * time.Hour
+	defaultAckWait         = time.Minute
+	defaultMaxDeliver      = 5
+	// reply subject does not survive redelivery as message reply, so it is kept in header
+	replyHeader    = "Screenshot-Reply"
+	publishTimeout = 5 * time.Second
+	fetchWait      = 5 * time.Second
+	fetchRetryWait = time.Second
+)
+
+func (c JetStreamConfig) withDefaults() JetStreamConfig {
+	if c.Stream == "" {
+		c.Stream = defaultJetStreamStream
+	}
+	if c.MaxAge <= 0 {
+		c.MaxAge = defaultJetStreamMaxAge
+	}
+	if c.Replicas <= 0 {
+		c.Replicas = 1
+	}
+	if c.AckWait <= 0 {
+		c.AckWait = defaultAckWait
+	}
+	if c.MaxDeliver <= 0 {
+		c.MaxDeliver = defaultMaxDeliver
+	}
+	return c
+}
+
+// JetStream keeps messages of configured subjects in persistent work queue stream. message is removed from stream
+// only when handler acknowledges it, so request taken by crashed worker is delivered to another one after ack wait
+type JetStream struct {
+	*NATS
+	js  nats.JetStreamContext
+	cfg JetStreamConfig
+}
+
+func NewJetStream(addr string, bufferSize int, timeout time.Duration, cfg JetStreamConfig) (*JetStream, error) {
+	n, err := NewNATS(addr, bufferSize, timeout)
+	if err != nil {
+		return nil, err
+	}
+	js, err := n.conn.JetStream()
+	if err != nil {
+		return nil, fmt.Errorf(`failed to get jetstream context: [addr: %s, error: %w]`, addr, err)
+	}
+	q := &JetStream{NATS: n, js: js, cfg: cfg.withDefaults()}
+	if err = q.ensureStream(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (q *JetStream) ensureStream() error {
+	sc := &nats.StreamConfig{
+		Name:      q.cfg.Stream,
+		Subjects:  q.cfg.Subjects,
+		Retention: nats.WorkQueuePolicy,
+		Storage:   nats.FileStorage,
+		MaxAge:    q.cfg.MaxAge,
+		Replicas:  q.cfg.Replicas,
+	}
+	_, err := q.js.StreamInfo(q.cfg.Stream)
+	switch {
+	case errors.Is(err, nats.ErrStreamNotFound):
+		_, err = q.js.AddStream(sc)
+	case err == nil:
+		_, err = q.js.UpdateStream(sc)
+	}
+	if err != nil {
+		return fmt.Errorf(`failed to ensure jetstream stream: [stream: %s, subjects: %v, error: %w]`, q.cfg.Stream, q.cfg.Subjects, err)
+	}
+	return nil
+}
+
+func (q *JetStream) persistent(topic string) bool {
+	for _, s := range q.cfg.Subjects {
+		if s == topic {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *JetStream) Publish(ctx context.Context, topic, reply string, data interface{}) error {
+	if !q.persistent(topic) {
+		return q.NATS.Publish(ctx, topic, reply, data)
+	}
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf(`failed to marshal data to json: [data: %+v, error: %w]`, data, err)
+	}
+	msg := nats.NewMsg(topic)
+	msg.Data = bytes
+	if reply != "" {
+		msg.Header.Set(replyHeader, reply)
+	}
+	// stream acknowledges stored message, publish fails when it is not stored
+	pubCtx, cancel := context.WithTimeout(ctx, publishTimeout)
+	defer cancel()
+	if _, err = q.js.PublishMsg(msg, nats.Context(pubCtx)); err != nil {
+		return fmt.Errorf(`failed to publish message to stream: [stream: %s, topic: %s, reply: %s, data: %s, error: %w]`, q.cfg.Stream, topic, reply, bytes, err)
+	}
+	return nil
+}
+
+// GroupSubscribe pulls messages of persistent topic by durable consumer shared by group members
+func (q *JetStream) GroupSubscribe(ctx context.Context, topic, group string) (<-chan Message, error) {
+	return q.GroupPull(ctx, topic, group, nil)
+}
+
+// GroupPull fetches message only after consumer sends on demand, so busy consumer does not hold messages other
+// members could handle. message is fetched only when previous one is taken from channel too
+func (q *JetStream) GroupPull(ctx context.Context, topic, group string, demand <-chan struct{}) (<-chan Message, error) {
+	if !q.persistent(topic) {
+		return q.NATS.GroupPull(ctx, topic, group, demand)
+	}
+	durable := consumerName(topic, group)
+	if err := q.ensureConsumer(topic, durable); err != nil {
+		return nil, err
+	}
+	// bound subscription does not delete durable consumer on unsubscribe
+	sub, err := q.js.PullSubscribe(topic, durable, nats.Bind(q.cfg.Stream, durable))
+	if err != nil {
+		return nil, fmt.Errorf(`failed to pull subscribe: [stream: %s, topic: %s, consumer: %s, error: %w]`, q.cfg.Stream, topic, durable, err)
+	}
+	c := make(chan Message)
+	go q.pull(ctx, topic, sub, demand, c)
+	return c, nil
+}
+
+func consumerName(topic, group string) string {
+	return strings.NewReplacer(".", "_", "*", "_", ">", "_").Replace(group + "_" + topic)
+}
+
+func (q *JetStream) ensureConsumer(topic, durable string) error {
+	cc := &nats.ConsumerConfig{
+		Durable:       durable,
+		AckPolicy:     nats.AckExplicitPolicy,
+		AckWait:       q.cfg.AckWait,
+		MaxDeliver:    q.cfg.MaxDeliver,
+		FilterSubject: topic,
+	}
+	_, err := q.js.ConsumerInfo(q.cfg.Stream, durable)
+	switch {
+	case errors.Is(err, nats.ErrConsumerNotFound):
+		_, err = q.js.AddConsumer(q.cfg.Stream, cc)
+	case err == nil:
+		_, err = q.js.UpdateConsumer(q.cfg.Stream, cc)
+	}
+	if err != nil {
+		return fmt.Errorf(`failed to ensure jetstream consumer: [stream: %s, consumer: %s, error: %w]`, q.cfg.Stream, durable, err)
+	}
+	return nil
+}
+
+func (q *JetStream) pull(ctx context.Context, topic string, sub *nats.Subscription, demand <-chan struct{}, c chan<- Message) {
+	defer close(c)
+	defer func() {
+		if err := sub.Unsubscribe(); err != nil {
+			log.Println(fmt.Sprintf(`failed to unsubscribe pull subscription: [topic: %s, error: %s]`, topic, err))
+		}
+	}()
+	for await(ctx, demand) {
+		if m, ok := q.next(ctx, topic, sub); ok {
+			q.forward(ctx, topic, m, c)
+		}
+	}
+}
+
+// next fetches message which should be handed to consumer. message delivered for the last time was not
+// acknowledged by previous deliveries (e.g. capture instance crashed), so it is dead-lettered instead
+func (q *JetStream) next(ctx context.Context, topic string, sub *nats.Subscription) (*nats.Msg, bool) {
+	for {
+		m, ok := q.fetch(ctx, topic, sub)
+		if !ok {
+			return nil, false
+		}
+		if !q.deadLetter(topic, m) {
+			return m, true
+		}
+	}
+}
+
+// deadLetter publishes dead letter of message which reached max deliver and terminates it. it returns false when
+// message should be handed to consumer
+func (q *JetStream) deadLetter(topic string, m *nats.Msg) bool {
+	if q.cfg.DeadLetter == nil {
+		return false
+	}
+	meta, err := m.Metadata()
+	if err != nil {
+		log.Println(fmt.Sprintf(`failed to get message metadata: [topic: %s, error: %s]`, topic, err))
+		return false
+	}
+	if meta.NumDelivered < uint64(q.cfg.MaxDeliver) {
+		return false
+	}
+	dlTopic, dl := q.cfg.DeadLetter(m.Data, int(meta.NumDelivered))
+	// message is not redelivered after the last delivery, so it must not depend on subscription context
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+	if err = q.Publish(ctx, dlTopic, "", dl); err != nil {
+		// consumer gets the last chance to handle message rather than it is lost
+		log.Println(fmt.Sprintf(`failed to publish dead letter: [topic: %s, dead_letter_topic: %s, error: %s]`, topic, dlTopic, err))
+		return false
+	}
+	if err = m.Term(); err != nil {
+		log.Println(fmt.Sprintf(`failed to terminate message: [topic: %s, error: %s]`, topic, err))
+	}
+	return true
+}
+
+// fetch waits for the next message of stream. it returns false when context is done
+func (q *JetStream) fetch(ctx context.Context, topic string, sub *nats.Subscription) (*nats.Msg, bool) {
+	for ctx.Err() == nil {
+		fetchCtx, cancel := context.WithTimeout(ctx, fetchWait)
+		msgs, err := sub.Fetch(1, nats.Context(fetchCtx))
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, nats.ErrTimeout) {
+				continue
+			}
+			log.Println(fmt.Sprintf(`failed to fetch message: [stream: %s, topic: %s, error: %s]`, q.cfg.Stream, topic, err))
+			select {
+			case <-time.After(fetchRetryWait):
+			case <-ctx.Done():
+			}
+			continue
+		}
+		if len(msgs) > 0 {
+			return msgs[0], true
+		}
+	}
+	return nil, false
+}
+
+func (q *JetStream) forward(ctx context.Context, topic string, m *nats.Msg, c chan<- Message) {
+	select {
+	case c <- Message{Data: m.Data, Reply: m.Header.Get(replyHeader), ack: func() error { return m.Ack() }}:
+	case <-ctx.Done():
+		// subscription is closed before message is taken, so it is given back to stream without waiting for ack wait
+		if err := m.Nak(); err != nil {
+			log.Println(fmt.Sprintf(`failed to return message to stream: [topic: %s, error: %s]`, topic, err))
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessage_Ack(t *testing.T) {
+	require.NoError(t, Message{}.Ack())
+	ackErr := errors.New("ack failed")
+	acked := 0
+	msg := Message{ack: func() error {
+		acked++
+		return ackErr
+	}}
+	require.Equal(t, ackErr, msg.Ack())
+	require.Equal(t, 1, acked)
+}
+
+func TestJetStream_GroupSubscribeRedelivery(t *testing.T) {
+	address := os.Getenv(testNATSAddressEnvVariable)
+	topic := uuid.New().String()
+	cfg := JetStreamConfig{Stream: uuid.New().String(), Subjects: []string{topic}, AckWait: time.Second, MaxDeliver: 2}
+	n, err := NewJetStream(address, 10, time.Second, cfg)
+	require.NoError(t, err)
+	group := uuid.New().String()
+	reply := uuid.New().String()
+	reqData := map[string]string{"TEST": "OK"}
+	require.NoError(t, n.Publish(context.Background(), topic, reply, reqData))
+
+	// first subscriber takes message and exits without ack
+	ctx, cancel := context.WithCancel(context.Background())
+	sub, err := n.GroupSubscribe(ctx, topic, group)
+	require.NoError(t, err)
+	msg := <-sub
+	require.Equal(t, reply, msg.Reply)
+	cancel()
+	for range sub {
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	sub, err = n.GroupSubscribe(ctx, topic, group)
+	require.NoError(t, err)
+	select {
+	case msg = <-sub:
+	case <-time.After(10 * time.Second):
+		t.Fatal("message is not redelivered")
+	}
+	msgData := map[string]string{}
+	require.NoError(t, json.Unmarshal(msg.Data, &msgData))
+	require.Equal(t, reqData, msgData)
+	require.Equal(t, reply, msg.Reply)
+	require.NoError(t, msg.Ack())
+	select {
+	case <-sub:
+		t.Fatal("acknowledged message is delivered again")
+	case <-time.After(2 * cfg.AckWait):
+	}
+}
+
+func TestJetStream_GroupSubscribeDeadLetter(t *testing.T) {
+	address := os.Getenv(testNATSAddressEnvVariable)
+	topic := uuid.New().String()
+	dlTopic := uuid.New().String()
+	deliveries := make(chan int, 1)
+	cfg := JetStreamConfig{Stream: uuid.New().String(), Subjects: []string{topic}, AckWait: time.Second, MaxDeliver: 2,
+		DeadLetter: func(data []byte, n int) (string, interface{}) {
+			deliveries <- n
+			return dlTopic, json.RawMessage(data)
+		}}
+	n, err := NewJetStream(address, 10, time.Second, cfg)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dl, err := n.Subscribe(ctx, dlTopic)
+	require.NoError(t, err)
+	group := uuid.New().String()
+	reqData := map[string]string{"TEST": "OK"}
+	require.NoError(t, n.Publish(context.Background(), topic, "", reqData))
+
+	sub, err := n.GroupSubscribe(ctx, topic, group)
+	require.NoError(t, err)
+	// the first delivery is not acknowledged, e.g. worker crashed
+	<-sub
+	var msg Message
+	select {
+	case msg = <-dl:
+	case <-time.After(10 * time.Second):
+		t.Fatal("dead letter is not published after the last delivery")
+	}
+	require.Equal(t, 2, <-deliveries)
+	msgData := map[string]string{}
+	require.NoError(t, json.Unmarshal(msg.Data, &msgData))
+	require.Equal(t, reqData, msgData)
+	select {
+	case <-sub:
+		t.Fatal("dead-lettered message is handed to consumer")
+	case <-time.After(2 * cfg.AckWait):
+	}
+}
@@ -0,0 +1,175 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+type memorySubscription struct {
+	c      chan Message
+	done   <-chan struct{}
+	mu     sync.RWMutex
+	closed bool
+}
+
+// deliver waits for room in subscription buffer. it fails when ctx is done first, so publisher is not stalled by
+// busy consumer
+func (s *memorySubscription) deliver(ctx context.Context, msg Message) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil
+	}
+	select {
+	case s.c <- msg:
+	case <-s.done:
+	case <-ctx.Done():
+		return fmt.Errorf(`timeout waiting for subscriber buffer: [error: %w]`, ctx.Err())
+	}
+	return nil
+}
+
+func (s *memorySubscription) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	close(s.c)
+}
+
+type memoryGroup struct {
+	members []*memorySubscription
+	next    int
+}
+
+// Memory is in-process queue with the same semantics as NATS core: every plain subscriber receives message
+// and only one member of each group receives it. intended for standalone mode when api and capture live in one process
+type Memory struct {
+	mu         sync.Mutex
+	bufferSize int
+	subs       map[string][]*memorySubscription
+	groups     map[string]map[string]*memoryGroup
+}
+
+func NewMemory(bufferSize int) *Memory {
+	return &Memory{
+		bufferSize: bufferSize,
+		subs:       map[string][]*memorySubscription{},
+		groups:     map[string]map[string]*memoryGroup{},
+	}
+}
+
+func (m *Memory) Publish(ctx context.Context, topic, reply string, data interface{}) error {
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf(`failed to marshal data to json: [data: %+v, error: %w]`, data, err)
+	}
+	msg := Message{Data: bytes, Reply: reply}
+	for _, s := range m.receivers(topic) {
+		if err = s.deliver(ctx, msg); err != nil {
+			return fmt.Errorf(`failed to publish message: [topic: %s, reply: %s, data: %s, error: %w]`, topic, reply, bytes, err)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Reply(ctx context.Context, reply string, data interface{}) error {
+	if err := m.Publish(ctx, reply, "", data); err != nil {
+		return fmt.Errorf(`failed to publish reply message: [reply: %s, error: %w]`, reply, err)
+	}
+	return nil
+}
+
+func (m *Memory) receivers(topic string) []*memorySubscription {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := append([]*memorySubscription{}, m.subs[topic]...)
+	for _, g := range m.groups[topic] {
+		if len(g.members) == 0 {
+			continue
+		}
+		g.next = g.next % len(g.members)
+		list = append(list, g.members[g.next])
+		g.next++
+	}
+	return list
+}
+
+func (m *Memory) Subscribe(ctx context.Context, topic string) (<-chan Message, error) {
+	s := &memorySubscription{c: make(chan Message, m.bufferSize), done: ctx.Done()}
+	m.mu.Lock()
+	m.subs[topic] = append(m.subs[topic], s)
+	m.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		m.mu.Lock()
+		m.subs[topic] = removeSubscription(m.subs[topic], s)
+		if len(m.subs[topic]) == 0 {
+			delete(m.subs, topic)
+		}
+		m.mu.Unlock()
+		s.close()
+	}()
+	return s.c, nil
+}
+
+func (m *Memory) GroupSubscribe(ctx context.Context, topic, group string) (<-chan Message, error) {
+	s := &memorySubscription{c: make(chan Message, m.bufferSize), done: ctx.Done()}
+	m.mu.Lock()
+	if m.groups[topic] == nil {
+		m.groups[topic] = map[string]*memoryGroup{}
+	}
+	g := m.groups[topic][group]
+	if g == nil {
+		g = &memoryGroup{}
+		m.groups[topic][group] = g
+	}
+	g.members = append(g.members, s)
+	m.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		m.mu.Lock()
+		g.members = removeSubscription(g.members, s)
+		if len(g.members) == 0 {
+			delete(m.groups[topic], group)
+		}
+		m.mu.Unlock()
+		s.close()
+	}()
+	return s.c, nil
+}
+
+// GroupPull forwards message of group member only after consumer sends on demand. messages wait in member buffer
+// meanwhile and publish blocks when it is full until its context is done
+func (m *Memory) GroupPull(ctx context.Context, topic, group string, demand <-chan struct{}) (<-chan Message, error) {
+	sub, err := m.GroupSubscribe(ctx, topic, group)
+	if err != nil {
+		return nil, err
+	}
+	c := make(chan Message)
+	go func() {
+		defer close(c)
+		for await(ctx, demand) {
+			msg, ok := <-sub
+			if !ok {
+				return
+			}
+			c <- msg
+		}
+		// messages delivered before subscription is closed are handed over instead of being dropped
+		for msg := range sub {
+			c <- msg
+		}
+	}()
+	return c, nil
+}
+
+func removeSubscription(list []*memorySubscription, s *memorySubscription) []*memorySubscription {
+	for i, el := range list {
+		if el == s {
+			return append(list[:i:i], list[i+1:]...)
+		}
+	}
+	return list
+}
@@ -0,0 +1,120 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemory_Subscribe(t *testing.T) {
+	m := NewMemory(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	topic := uuid.New().String()
+	group := uuid.New().String()
+	groupSub, err := m.GroupSubscribe(ctx, topic, group)
+	require.NoError(t, err)
+	reply := uuid.New().String()
+	replySub, err := m.Subscribe(ctx, reply)
+	require.NoError(t, err)
+	reqData := map[string]string{"TEST": "OK"}
+	require.NoError(t, m.Publish(ctx, topic, reply, reqData))
+	groupMsg := <-groupSub
+	msgData := map[string]string{}
+	require.NoError(t, json.Unmarshal(groupMsg.Data, &msgData))
+	require.Equal(t, reqData, msgData)
+	replyData := map[string]string{"OK": "TEST"}
+	require.NoError(t, m.Reply(ctx, groupMsg.Reply, replyData))
+	replyMsg := <-replySub
+	receivedReplyData := map[string]string{}
+	require.NoError(t, json.Unmarshal(replyMsg.Data, &receivedReplyData))
+	require.Equal(t, replyData, receivedReplyData)
+}
+
+func TestMemory_GroupSubscribeDeliversToOneMember(t *testing.T) {
+	m := NewMemory(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	topic := uuid.New().String()
+	first, err := m.GroupSubscribe(ctx, topic, "capture")
+	require.NoError(t, err)
+	second, err := m.GroupSubscribe(ctx, topic, "capture")
+	require.NoError(t, err)
+	other, err := m.GroupSubscribe(ctx, topic, "another")
+	require.NoError(t, err)
+	for i := 0; i < 4; i++ {
+		require.NoError(t, m.Publish(ctx, topic, "", i))
+	}
+	require.Len(t, first, 2)
+	require.Len(t, second, 2)
+	require.Len(t, other, 4)
+}
+
+func TestMemory_SubscriptionClosedOnContextDone(t *testing.T) {
+	m := NewMemory(0)
+	ctx, cancel := context.WithCancel(context.Background())
+	topic := uuid.New().String()
+	sub, err := m.Subscribe(ctx, topic)
+	require.NoError(t, err)
+	cancel()
+	select {
+	case _, ok := <-sub:
+		require.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("subscription channel has not been closed")
+	}
+	// publishing without subscribers must not block
+	require.NoError(t, m.Publish(context.Background(), topic, "", "data"))
+}
+
+func TestMemory_GroupPullWaitsForDemand(t *testing.T) {
+	m := NewMemory(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	topic := uuid.New().String()
+	demand := make(chan struct{}, 1)
+	sub, err := m.GroupPull(ctx, topic, "capture", demand)
+	require.NoError(t, err)
+	require.NoError(t, m.Publish(ctx, topic, "", "data"))
+	select {
+	case <-sub:
+		t.Fatal("message is delivered without demand")
+	case <-time.After(10 * time.Millisecond):
+	}
+	demand <- struct{}{}
+	select {
+	case msg := <-sub:
+		require.Equal(t, `"data"`, string(msg.Data))
+	case <-time.After(time.Second):
+		t.Fatal("message is not delivered on demand")
+	}
+}
+
+func TestMemory_PublishToFullSubscriberFailsOnContextDone(t *testing.T) {
+	m := NewMemory(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	topic := uuid.New().String()
+	sub, err := m.GroupSubscribe(ctx, topic, uuid.New().String())
+	require.NoError(t, err)
+	require.NoError(t, m.Publish(ctx, topic, "", 1))
+
+	pubCtx, pubCancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer pubCancel()
+	err = m.Publish(pubCtx, topic, "", 2)
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+	require.Error(t, m.Reply(pubCtx, topic, 3))
+
+	// message which did not fit is not delivered later
+	require.Equal(t, "1", string((<-sub).Data))
+	select {
+	case msg := <-sub:
+		t.Fatalf("unexpected message %s", msg.Data)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
@@ -17,13 +17,22 @@ type NATS struct {
 }
 
 func NewNATS(addr string, bufferSize int, timeout time.Duration) (*NATS, error) {
-	conn, err := nats.Connect(addr, nats.Timeout(timeout))
+	conn, err := nats.Connect(addr, nats.Timeout(timeout), nats.ErrorHandler(logAsyncError))
 	if err != nil {
 		return nil, fmt.Errorf(`failed to connect to nats server: [addr: %s, timeout: %s]`, addr, timeout)
 	}
 	return &NATS{conn: conn, bufferSize: bufferSize}, nil
 }
 
+// logAsyncError reports errors which are not returned by any call, e.g. messages dropped by slow consumer
+func logAsyncError(_ *nats.Conn, sub *nats.Subscription, err error) {
+	if sub == nil {
+		log.Println(fmt.Sprintf(`nats connection error: [error: %s]`, err))
+		return
+	}
+	log.Println(fmt.Sprintf(`nats subscription error: [topic: %s, group: %s, error: %s]`, sub.Subject, sub.Queue, err))
+}
+
 func (n *NATS) Publish(ctx context.Context, topic, reply string, data interface{}) error {
 	bytes, err := json.Marshal(data)
 	if err != nil {
@@ -49,14 +58,55 @@ func (n *NATS) Reply(ctx context.Context, reply string, data interface{}) error
 type Message struct {
 	Data  []byte
 	Reply string
+	// set by queues which keep message until it is acknowledged
+	ack func() error
 }
 
+// Ack confirms message is handled so it is not delivered again. no-op for queues without redelivery
+func (m Message) Ack() error {
+	if m.ack == nil {
+		return nil
+	}
+	return m.ack()
+}
+
+// await blocks until consumer asks for the next message. nil demand asks for every message
+func await(ctx context.Context, demand <-chan struct{}) bool {
+	if demand == nil {
+		return ctx.Err() == nil
+	}
+	select {
+	case <-demand:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+const (
+	// core nats server keeps delivering to busy group member, so pending messages of pulled subscription are kept by
+	// client. messages over the limit are dropped as slow consumer and logged
+	pullPendingMessages = 1000
+	pullPendingBytes    = 16 << 20
+)
+
 func (n *NATS) GroupSubscribe(ctx context.Context, topic, group string) (<-chan Message, error) {
+	return n.GroupPull(ctx, topic, group, nil)
+}
+
+// GroupPull is group subscription which takes the next message only after consumer sends on demand. it stays
+// subscribed while consumer is busy, so messages delivered to it meanwhile wait instead of being lost
+func (n *NATS) GroupPull(ctx context.Context, topic, group string, demand <-chan struct{}) (<-chan Message, error) {
 	sub, err := n.conn.QueueSubscribeSync(topic, group)
 	if err != nil {
 		return nil, fmt.Errorf(`failed to queue subscribe: [topic: %s, group: %s]`, topic, group)
 	}
-	return n.consumeSubscription(ctx, topic, sub)
+	if demand != nil {
+		if err = sub.SetPendingLimits(pullPendingMessages, pullPendingBytes); err != nil {
+			return nil, fmt.Errorf(`failed to set pending limits: [topic: %s, group: %s, error: %w]`, topic, group, err)
+		}
+	}
+	return n.consumeSubscription(ctx, topic, sub, demand)
 }
 
 func (n *NATS) Subscribe(ctx context.Context, topic string) (<-chan Message, error) {
@@ -64,20 +114,30 @@ func (n *NATS) Subscribe(ctx context.Context, topic string) (<-chan Message, err
 	if err != nil {
 		return nil, fmt.Errorf(`failed to subscribe: [topic: %s]`, topic)
 	}
-	return n.consumeSubscription(ctx, topic, sub)
+	return n.consumeSubscription(ctx, topic, sub, nil)
 }
 
-func (n *NATS) consumeSubscription(ctx context.Context, topic string, sub *nats.Subscription) (<-chan Message, error) {
+func (n *NATS) consumeSubscription(ctx context.Context, topic string, sub *nats.Subscription, demand <-chan struct{}) (<-chan Message, error) {
 	c := make(chan Message, n.bufferSize)
+	if demand != nil {
+		// message is handed over only when asked, buffer would take messages nobody asked for
+		c = make(chan Message)
+	}
 	go func() {
+		defer close(c)
 		for {
+			if !await(ctx, demand) {
+				n.drain(topic, sub, c)
+				return
+			}
 			msg, err := sub.NextMsgWithContext(ctx)
 			if err != nil {
-				if !errors.Is(err, context.Canceled) {
-					//TODO pass logger as dependence
-					log.Println(fmt.Sprintf(`failed get next message for topic %s: with error: %s`, topic, err))
+				if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+					n.drain(topic, sub, c)
+					return
 				}
-				close(c)
+				//TODO pass logger as dependence
+				log.Println(fmt.Sprintf(`failed get next message for topic %s: with error: %s`, topic, err))
 				return
 			}
 			c <- Message{Data: msg.Data, Reply: msg.Reply}
@@ -85,3 +145,27 @@ func (n *NATS) consumeSubscription(ctx context.Context, topic string, sub *nats.
 	}()
 	return c, nil
 }
+
+const drainTimeout = 5 * time.Second
+
+// drain removes interest in topic so server stops delivering to this subscriber (for queue group it picks
+// another member) and forwards messages which were already received by client instead of dropping them
+func (n *NATS) drain(topic string, sub *nats.Subscription, c chan<- Message) {
+	if err := sub.Drain(); err != nil {
+		log.Println(fmt.Sprintf(`failed to drain subscription: [topic: %s, error: %s]`, topic, err))
+		return
+	}
+	for {
+		// fails when all pending messages are consumed and subscription is removed
+		msg, err := sub.NextMsg(drainTimeout)
+		if err != nil {
+			return
+		}
+		select {
+		case c <- Message{Data: msg.Data, Reply: msg.Reply}:
+		case <-time.After(drainTimeout):
+			log.Println(fmt.Sprintf(`dropped pending message of closed subscription: [topic: %s]`, topic))
+			return
+		}
+	}
+}
@@ -3,6 +3,7 @@ package queue
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"os"
 	"testing"
 	"time"
@@ -39,3 +40,33 @@ func TestNATS_Subscribe(t *testing.T) {
 	require.NoError(t, json.Unmarshal(replyMsg.Data, &receivedReplyData))
 	require.Equal(t, replyData, receivedReplyData)
 }
+
+func TestNATS_GroupPullKeepsMessagesWhileBusy(t *testing.T) {
+	address := os.Getenv(testNATSAddressEnvVariable)
+	n, err := NewNATS(address, 10, time.Second)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	topic := uuid.New().String()
+	demand := make(chan struct{}, 1)
+	sub, err := n.GroupPull(ctx, topic, uuid.New().String(), demand)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, n.Publish(ctx, topic, "", i))
+	}
+	select {
+	case <-sub:
+		t.Fatal("message is delivered without demand")
+	case <-time.After(100 * time.Millisecond):
+	}
+	// messages published while subscriber is busy are kept until it asks for them
+	for i := 0; i < 3; i++ {
+		demand <- struct{}{}
+		select {
+		case msg := <-sub:
+			require.Equal(t, fmt.Sprint(i), string(msg.Data))
+		case <-time.After(time.Second):
+			t.Fatal("message is lost")
+		}
+	}
+}
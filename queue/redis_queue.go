@@ -0,0 +1,367 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type RedisConfig struct {
+	KeyPrefix string `yaml:"key_prefix"`
+	// topic streams are trimmed approximately to this length
+	MaxLen int64 `yaml:"max_len"`
+	// message pending longer than claim idle is taken over from consumer which is considered crashed
+	ClaimIdle time.Duration `yaml:"claim_idle"`
+	// reply stream is removed after this period
+	ReplyTTL time.Duration `yaml:"reply_ttl"`
+	// message of these topics is not delivered any more after max deliver. other topics are claimed until acknowledged
+	DeadLetterTopics []string `yaml:"dead_letter_topics"`
+	MaxDeliver       int      `yaml:"max_deliver"`
+	// builds dead letter of claimed message delivered for the last time, it is published and message is acknowledged
+	// instead of handing it to consumer. nil hands message to consumer and it is claimed again while it is not acknowledged
+	DeadLetter func(data []byte, deliveries int) (topic string, msg interface{}) `yaml:"-"`
+}
+
+const (
+	defaultRedisKeyPrefix = "screenshot:"
+	defaultRedisMaxLen    = 10000
+	defaultClaimIdle      = time.Minute
+	defaultReplyTTL       = time.Minute
+	redisBlockWait        = 2 * time.Second
+	redisRetryWait        = time.Second
+	redisDataField        = "data"
+	redisReplyField       = "reply"
+)
+
+func (c RedisConfig) withDefaults() RedisConfig {
+	if c.KeyPrefix == "" {
+		c.KeyPrefix = defaultRedisKeyPrefix
+	}
+	if c.MaxLen <= 0 {
+		c.MaxLen = defaultRedisMaxLen
+	}
+	if c.ClaimIdle <= 0 {
+		c.ClaimIdle = defaultClaimIdle
+	}
+	if c.ReplyTTL <= 0 {
+		c.ReplyTTL = defaultReplyTTL
+	}
+	if c.MaxDeliver <= 0 {
+		c.MaxDeliver = defaultMaxDeliver
+	}
+	return c
+}
+
+// Redis keeps every topic in stream. group subscribers share stream by consumer group, so each message is handled
+// by one member and stays pending until it is acknowledged. replies are written to per request streams which expire
+type Redis struct {
+	cl         *redis.Client
+	cfg        RedisConfig
+	bufferSize int
+	// consumer name is kept for process lifetime, so paused and resumed subscription reads the same pending entries
+	consumer string
+
+	mu sync.Mutex
+	// messages read from stream but not taken before subscription was closed. they are delivered first on resubscribe
+	returned map[string][]Message
+}
+
+func NewRedis(url string, bufferSize int, timeout time.Duration, cfg RedisConfig) (*Redis, error) {
+	opt, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf(`failed to parse redis url: [url: %s, error: %w]`, url, err)
+	}
+	opt.DialTimeout = timeout
+	cl := redis.NewClient(opt)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err = cl.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf(`failed to connect to redis server: [addr: %s, timeout: %s, error: %w]`, opt.Addr, timeout, err)
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return &Redis{
+		cl:         cl,
+		cfg:        cfg.withDefaults(),
+		bufferSize: bufferSize,
+		consumer:   fmt.Sprintf(`%s-%d`, host, os.Getpid()),
+		returned:   map[string][]Message{},
+	}, nil
+}
+
+func (r *Redis) key(topic string) string {
+	return r.cfg.KeyPrefix + topic
+}
+
+func (r *Redis) Publish(ctx context.Context, topic, reply string, data interface{}) error {
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf(`failed to marshal data to json: [data: %+v, error: %w]`, data, err)
+	}
+	args := &redis.XAddArgs{
+		Stream: r.key(topic),
+		MaxLen: r.cfg.MaxLen,
+		Approx: true,
+		Values: map[string]interface{}{redisDataField: bytes, redisReplyField: reply},
+	}
+	if err = r.cl.XAdd(ctx, args).Err(); err != nil {
+		return fmt.Errorf(`failed to publish message: [topic: %s, reply: %s, data: %s, error: %w]`, topic, reply, bytes, err)
+	}
+	return nil
+}
+
+func (r *Redis) Reply(ctx context.Context, reply string, data interface{}) error {
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf(`failed to marshal data to json: [data: %+v, error: %w]`, data, err)
+	}
+	key := r.key(reply)
+	_, err = r.cl.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.XAdd(ctx, &redis.XAddArgs{Stream: key, Values: map[string]interface{}{redisDataField: bytes}})
+		p.Expire(ctx, key, r.cfg.ReplyTTL)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf(`failed to publish reply message: [reply: %s, data: %s, error: %w]`, reply, bytes, err)
+	}
+	return nil
+}
+
+// Subscribe delivers every message published to topic after subscription is created
+func (r *Redis) Subscribe(ctx context.Context, topic string) (<-chan Message, error) {
+	key := r.key(topic)
+	// last id is taken before returning, so message published right after subscribe is not missed
+	last, err := r.cl.XRevRangeN(ctx, key, "+", "-", 1).Result()
+	if err != nil {
+		return nil, fmt.Errorf(`failed to subscribe: [topic: %s, error: %w]`, topic, err)
+	}
+	id := "0-0"
+	if len(last) > 0 {
+		id = last[0].ID
+	}
+	c := make(chan Message, r.bufferSize)
+	go r.read(ctx, topic, id, c)
+	return c, nil
+}
+
+func (r *Redis) read(ctx context.Context, topic, id string, c chan<- Message) {
+	defer close(c)
+	key := r.key(topic)
+	for ctx.Err() == nil {
+		streams, err := r.cl.XRead(ctx, &redis.XReadArgs{Streams: []string{key, id}, Count: int64(r.bufferSize), Block: redisBlockWait}).Result()
+		if err != nil {
+			if !r.retry(ctx, topic, err) {
+				return
+			}
+			continue
+		}
+		for _, s := range streams {
+			for _, m := range s.Messages {
+				id = m.ID
+				select {
+				case c <- message(m, nil):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}
+}
+
+// GroupSubscribe reads topic stream by consumer group
+func (r *Redis) GroupSubscribe(ctx context.Context, topic, group string) (<-chan Message, error) {
+	return r.GroupPull(ctx, topic, group, nil)
+}
+
+// GroupPull reads message only after consumer sends on demand, so busy consumer does not hold messages other
+// members could handle. message is read only when previous one is taken from channel too
+func (r *Redis) GroupPull(ctx context.Context, topic, group string, demand <-chan struct{}) (<-chan Message, error) {
+	key := r.key(topic)
+	// group created at the beginning of stream gets messages published before first subscriber started
+	if err := r.cl.XGroupCreateMkStream(ctx, key, group, "0").Err(); err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil, fmt.Errorf(`failed to create consumer group: [topic: %s, group: %s, error: %w]`, topic, group, err)
+	}
+	c := make(chan Message)
+	go r.readGroup(ctx, topic, group, demand, c)
+	return c, nil
+}
+
+func (r *Redis) readGroup(ctx context.Context, topic, group string, demand <-chan struct{}, c chan<- Message) {
+	defer close(c)
+	for await(ctx, demand) {
+		msg, ok := r.wait(ctx, topic, group)
+		if !ok {
+			return
+		}
+		select {
+		case c <- msg:
+		case <-ctx.Done():
+			r.giveBack(topic, group, msg)
+			return
+		}
+	}
+}
+
+// wait reads group until message arrives. it returns false when context is done
+func (r *Redis) wait(ctx context.Context, topic, group string) (Message, bool) {
+	for ctx.Err() == nil {
+		msg, ok, err := r.next(ctx, topic, group)
+		if err != nil {
+			if !r.retry(ctx, topic, err) {
+				return Message{}, false
+			}
+			continue
+		}
+		if ok {
+			return msg, true
+		}
+	}
+	return Message{}, false
+}
+
+// next returns message given back by closed subscription, then message abandoned by crashed consumer and then new one
+func (r *Redis) next(ctx context.Context, topic, group string) (Message, bool, error) {
+	if msg, ok := r.takeBack(topic, group); ok {
+		return msg, true, nil
+	}
+	key := r.key(topic)
+	ack := func(id string) func() error {
+		return func() error {
+			return r.cl.XAck(context.Background(), key, group, id).Err()
+		}
+	}
+	claimed, deliveries, err := r.claim(ctx, key, group)
+	if err != nil {
+		return Message{}, false, err
+	}
+	if claimed != nil {
+		if r.deadLetter(topic, group, *claimed, deliveries) {
+			return Message{}, false, nil
+		}
+		return message(*claimed, ack(claimed.ID)), true, nil
+	}
+	streams, err := r.cl.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    group,
+		Consumer: r.consumer,
+		Streams:  []string{key, ">"},
+		Count:    1,
+		Block:    redisBlockWait,
+	}).Result()
+	if err != nil {
+		return Message{}, false, err
+	}
+	for _, s := range streams {
+		for _, m := range s.Messages {
+			return message(m, ack(m.ID)), true, nil
+		}
+	}
+	return Message{}, false, nil
+}
+
+// pendingScan is number of oldest pending entries checked for abandoned message on every read
+const pendingScan = 10
+
+// claim takes over the oldest message which is pending longer than claim idle and returns number of its deliveries
+// including this one. pending entries are checked before claim, since XAUTOCLAIM is not available before redis 6.2
+func (r *Redis) claim(ctx context.Context, key, group string) (*redis.XMessage, int, error) {
+	pending, err := r.cl.XPendingExt(ctx, &redis.XPendingExtArgs{Stream: key, Group: group, Start: "-", End: "+", Count: pendingScan}).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf(`failed to list pending messages: [stream: %s, group: %s, error: %w]`, key, group, err)
+	}
+	for _, p := range pending {
+		if p.Idle < r.cfg.ClaimIdle {
+			continue
+		}
+		// min idle makes claim fail when other consumer claimed or acknowledged message meanwhile
+		claimed, err := r.cl.XClaim(ctx, &redis.XClaimArgs{Stream: key, Group: group, Consumer: r.consumer, MinIdle: r.cfg.ClaimIdle, Messages: []string{p.ID}}).Result()
+		if err != nil {
+			return nil, 0, fmt.Errorf(`failed to claim pending message: [stream: %s, group: %s, id: %s, error: %w]`, key, group, p.ID, err)
+		}
+		if len(claimed) > 0 {
+			log.Println(fmt.Sprintf(`claimed abandoned message: [stream: %s, id: %s, consumer: %s, deliveries: %d]`, key, p.ID, p.Consumer, p.RetryCount+1))
+			return &claimed[0], int(p.RetryCount) + 1, nil
+		}
+	}
+	return nil, 0, nil
+}
+
+// deadLetter publishes dead letter of claimed message of dead-lettered topic which reached max deliver and acknowledges it, so poison
+// message crashing every consumer is not claimed forever. it returns false when message should be handed to consumer
+func (r *Redis) deadLetter(topic, group string, m redis.XMessage, deliveries int) bool {
+	if r.cfg.DeadLetter == nil || deliveries < r.cfg.MaxDeliver || !r.deadLettered(topic) {
+		return false
+	}
+	data, _ := m.Values[redisDataField].(string)
+	dlTopic, dl := r.cfg.DeadLetter([]byte(data), deliveries)
+	// message must be acknowledged even when subscription is closing, so it does not depend on subscription context
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+	if err := r.Publish(ctx, dlTopic, "", dl); err != nil {
+		// consumer gets one more chance to handle message rather than it is lost
+		log.Println(fmt.Sprintf(`failed to publish dead letter: [topic: %s, dead_letter_topic: %s, id: %s, error: %s]`, topic, dlTopic, m.ID, err))
+		return false
+	}
+	if err := r.cl.XAck(ctx, r.key(topic), group, m.ID).Err(); err != nil {
+		log.Println(fmt.Sprintf(`failed to ack dead-lettered message: [topic: %s, id: %s, error: %s]`, topic, m.ID, err))
+	}
+	return true
+}
+
+func (r *Redis) deadLettered(topic string) bool {
+	for _, t := range r.cfg.DeadLetterTopics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Redis) giveBack(topic, group string, msg Message) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.returned[group+"/"+topic] = append(r.returned[group+"/"+topic], msg)
+}
+
+func (r *Redis) takeBack(topic, group string) (Message, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := r.returned[group+"/"+topic]
+	if len(list) == 0 {
+		return Message{}, false
+	}
+	r.returned[group+"/"+topic] = list[1:]
+	return list[0], true
+}
+
+// retry reports whether reading should go on after error. redis.Nil means block wait passed without messages
+func (r *Redis) retry(ctx context.Context, topic string, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if errors.Is(err, redis.Nil) {
+		return true
+	}
+	log.Println(fmt.Sprintf(`failed to read stream: [topic: %s, error: %s]`, topic, err))
+	select {
+	case <-time.After(redisRetryWait):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func message(m redis.XMessage, ack func() error) Message {
+	data, _ := m.Values[redisDataField].(string)
+	reply, _ := m.Values[redisReplyField].(string)
+	return Message{Data: []byte(data), Reply: reply, ack: ack}
+}
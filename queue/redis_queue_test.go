@@ -0,0 +1,161 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+const testRedisAddressEnvVariable = "SCREENSHOT_TEST_REDIS"
+
+func TestRedis_Subscribe(t *testing.T) {
+	address := os.Getenv(testRedisAddressEnvVariable)
+	r, err := NewRedis(address, 10, time.Second, RedisConfig{KeyPrefix: uuid.New().String() + ":"})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	topic := uuid.New().String()
+	group := uuid.New().String()
+	groupSub, err := r.GroupSubscribe(ctx, topic, group)
+	require.NoError(t, err)
+	reply := uuid.New().String()
+	replySub, err := r.Subscribe(ctx, reply)
+	require.NoError(t, err)
+	reqData := map[string]string{"TEST": "OK"}
+	require.NoError(t, r.Publish(ctx, topic, reply, reqData))
+	groupMsg := <-groupSub
+	msgData := map[string]string{}
+	require.NoError(t, json.Unmarshal(groupMsg.Data, &msgData))
+	require.Equal(t, reqData, msgData)
+	replyData := map[string]string{"OK": "TEST"}
+	require.NoError(t, r.Reply(ctx, groupMsg.Reply, replyData))
+	require.NoError(t, groupMsg.Ack())
+	replyMsg := <-replySub
+	receivedReplyData := map[string]string{}
+	require.NoError(t, json.Unmarshal(replyMsg.Data, &receivedReplyData))
+	require.Equal(t, replyData, receivedReplyData)
+}
+
+func TestRedis_GroupSubscribeClaim(t *testing.T) {
+	address := os.Getenv(testRedisAddressEnvVariable)
+	cfg := RedisConfig{KeyPrefix: uuid.New().String() + ":", ClaimIdle: 500 * time.Millisecond}
+	crashed, err := NewRedis(address, 10, time.Second, cfg)
+	require.NoError(t, err)
+	crashed.consumer = uuid.New().String()
+	topic := uuid.New().String()
+	group := uuid.New().String()
+	require.NoError(t, crashed.Publish(context.Background(), topic, "", map[string]string{"TEST": "OK"}))
+
+	// message is taken but never acknowledged
+	ctx, cancel := context.WithCancel(context.Background())
+	sub, err := crashed.GroupSubscribe(ctx, topic, group)
+	require.NoError(t, err)
+	msg := <-sub
+	cancel()
+
+	r, err := NewRedis(address, 10, time.Second, cfg)
+	require.NoError(t, err)
+	r.consumer = uuid.New().String()
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	sub, err = r.GroupSubscribe(ctx, topic, group)
+	require.NoError(t, err)
+	var claimed Message
+	select {
+	case claimed = <-sub:
+	case <-time.After(10 * time.Second):
+		t.Fatal("abandoned message is not claimed")
+	}
+	require.Equal(t, msg.Data, claimed.Data)
+	require.NoError(t, claimed.Ack())
+	pending, err := r.cl.XPending(context.Background(), r.key(topic), group).Result()
+	require.NoError(t, err)
+	require.Zero(t, pending.Count)
+}
+
+func TestRedis_GroupSubscribeDeadLetter(t *testing.T) {
+	address := os.Getenv(testRedisAddressEnvVariable)
+	topic := uuid.New().String()
+	dlTopic := uuid.New().String()
+	deliveries := make(chan int, 1)
+	cfg := RedisConfig{KeyPrefix: uuid.New().String() + ":", ClaimIdle: 500 * time.Millisecond, MaxDeliver: 2, DeadLetterTopics: []string{topic},
+		DeadLetter: func(data []byte, n int) (string, interface{}) {
+			deliveries <- n
+			return dlTopic, json.RawMessage(data)
+		}}
+	crashed, err := NewRedis(address, 10, time.Second, cfg)
+	require.NoError(t, err)
+	crashed.consumer = uuid.New().String()
+	group := uuid.New().String()
+	reqData := map[string]string{"TEST": "OK"}
+	require.NoError(t, crashed.Publish(context.Background(), topic, "", reqData))
+
+	// the first delivery is never acknowledged
+	ctx, cancel := context.WithCancel(context.Background())
+	sub, err := crashed.GroupSubscribe(ctx, topic, group)
+	require.NoError(t, err)
+	<-sub
+	cancel()
+
+	r, err := NewRedis(address, 10, time.Second, cfg)
+	require.NoError(t, err)
+	r.consumer = uuid.New().String()
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	dl, err := r.GroupSubscribe(ctx, dlTopic, group)
+	require.NoError(t, err)
+	sub, err = r.GroupSubscribe(ctx, topic, group)
+	require.NoError(t, err)
+	var msg Message
+	select {
+	case msg = <-dl:
+	case claimed := <-sub:
+		t.Fatalf("message is claimed after max deliver: %s", claimed.Data)
+	case <-time.After(10 * time.Second):
+		t.Fatal("dead letter is not published after the last delivery")
+	}
+	require.Equal(t, 2, <-deliveries)
+	msgData := map[string]string{}
+	require.NoError(t, json.Unmarshal(msg.Data, &msgData))
+	require.Equal(t, reqData, msgData)
+	// message is acknowledged right after dead letter is published
+	require.Eventually(t, func() bool {
+		pending, err := r.cl.XPending(context.Background(), r.key(topic), group).Result()
+		return err == nil && pending.Count == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestRedis_GroupPullLeavesMessageToOtherMember(t *testing.T) {
+	address := os.Getenv(testRedisAddressEnvVariable)
+	cfg := RedisConfig{KeyPrefix: uuid.New().String() + ":"}
+	busy, err := NewRedis(address, 10, time.Second, cfg)
+	require.NoError(t, err)
+	busy.consumer = uuid.New().String()
+	free, err := NewRedis(address, 10, time.Second, cfg)
+	require.NoError(t, err)
+	free.consumer = uuid.New().String()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	topic := uuid.New().String()
+	group := uuid.New().String()
+	busySub, err := busy.GroupPull(ctx, topic, group, make(chan struct{}))
+	require.NoError(t, err)
+	demand := make(chan struct{}, 1)
+	demand <- struct{}{}
+	freeSub, err := free.GroupPull(ctx, topic, group, demand)
+	require.NoError(t, err)
+	require.NoError(t, busy.Publish(ctx, topic, "", map[string]string{"TEST": "OK"}))
+	select {
+	case msg := <-freeSub:
+		require.NoError(t, msg.Ack())
+	case <-busySub:
+		t.Fatal("message is read by member without demand")
+	case <-time.After(5 * time.Second):
+		t.Fatal("message is not delivered to free member")
+	}
+}
@@ -19,7 +19,11 @@ func main() {
 		log.Println(err.Error())
 		os.Exit(1)
 	}
-	if err := cm.MakeScreenShotsAndPrintResult(urls); err != nil {
+	run := cm.MakeScreenShotsAndPrintResult
+	if opt.Async {
+		run = cm.MakeScreenShotsJobAndPrintResult
+	}
+	if err := run(urls, opt.ShotOptions(), opt.QueuePriority()); err != nil {
 		log.Println(err.Error())
 		os.Exit(1)
 	}
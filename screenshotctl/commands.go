@@ -15,12 +15,69 @@ import (
 	"github.com/jessevdk/go-flags"
 
 	"github.com/leveldorado/screenshot/api"
+	"github.com/leveldorado/screenshot/capture"
+	"github.com/leveldorado/screenshot/store"
 )
 
 type FlagOptions struct {
-	Backend string `short:"b"  long:"backend" description:"address and port of screenshot backend api" default:"http://localhost:9000" env:"SCREENSHOT_BACKEND"`
-	URLs    string `short:"u" long:"urls" description:"list of urls for screenshoting separated by ;"`
-	File    string `short:"f" long:"file" description:"path to file with list of urls"`
+	Backend           string   `short:"b"  long:"backend" description:"address and port of screenshot backend api" default:"http://localhost:9000" env:"SCREENSHOT_BACKEND"`
+	URLs              string   `short:"u" long:"urls" description:"list of urls for screenshoting separated by ;"`
+	File              string   `short:"f" long:"file" description:"path to file with list of urls"`
+	Format            string   `long:"format" description:"output format (jpeg, png or pdf). server default is used if empty"`
+	Quality           int      `long:"quality" description:"image quality from range [0..100] (jpeg only)"`
+	ViewportWidth     int      `long:"width" description:"viewport width in pixels"`
+	ViewportHeight    int      `long:"height" description:"viewport height in pixels"`
+	DeviceScaleFactor float64  `long:"scale" description:"device scale factor"`
+	FullPage          bool     `long:"full-page" description:"capture whole scrollable page instead of viewport only"`
+	DelayMS           int      `long:"delay" description:"delay in milliseconds between page load and capture"`
+	Device            string   `long:"device" description:"device preset name (e.g. iphone-x, pixel-2, ipad, desktop-1080p)"`
+	WaitNetworkIdleMS int      `long:"wait-network-idle" description:"wait until page has no in-flight network requests for given number of milliseconds"`
+	WaitSelector      string   `long:"wait-selector" description:"wait until element matching css selector appears on page"`
+	WaitExpression    string   `long:"wait-expression" description:"wait until javascript expression evaluated on page becomes truthy"`
+	Selectors         []string `long:"selector" description:"css selector of element to capture instead of whole page. can be repeated, every element is saved separately"`
+	PaperSize         string   `long:"paper-size" description:"pdf paper size (letter, legal, tabloid, a3, a4, a5)"`
+	Landscape         bool     `long:"landscape" description:"pdf landscape orientation"`
+	PrintBackground   bool     `long:"print-background" description:"print background graphics to pdf"`
+	Async             bool     `long:"async" description:"submit urls as asynchronous job and poll its status until completion. recommended for large batches"`
+	Priority          string   `long:"priority" description:"queue lane (high, normal, bulk). bulk is used for --async jobs and normal otherwise if empty"`
+}
+
+// flagBool keeps server default for boolean flag which is not passed
+func flagBool(b bool) *bool {
+	if !b {
+		return nil
+	}
+	return capture.Bool(true)
+}
+
+// QueuePriority keeps asynchronous batches in bulk lane by default, so they do not delay interactive captures
+func (f FlagOptions) QueuePriority() capture.Priority {
+	if f.Priority == "" && f.Async {
+		return capture.PriorityBulk
+	}
+	return capture.Priority(f.Priority)
+}
+
+func (f FlagOptions) ShotOptions() capture.ShotOptions {
+	var pdf *capture.PDFOptions
+	if f.PaperSize != "" || f.Landscape || f.PrintBackground {
+		pdf = &capture.PDFOptions{PaperSize: f.PaperSize, Landscape: flagBool(f.Landscape), PrintBackground: flagBool(f.PrintBackground)}
+	}
+	return capture.ShotOptions{
+		Format:            f.Format,
+		Quality:           f.Quality,
+		ViewportWidth:     f.ViewportWidth,
+		ViewportHeight:    f.ViewportHeight,
+		DeviceScaleFactor: f.DeviceScaleFactor,
+		FullPage:          flagBool(f.FullPage),
+		DelayMS:           f.DelayMS,
+		Device:            f.Device,
+		WaitNetworkIdleMS: f.WaitNetworkIdleMS,
+		WaitSelector:      f.WaitSelector,
+		WaitExpression:    f.WaitExpression,
+		Selectors:         f.Selectors,
+		PDF:               pdf,
+	}
 }
 
 const (
@@ -66,42 +123,85 @@ type Command struct {
 
 const (
 	defaultRequestTimeout = 30 * time.Second
+	jobPollInterval       = time.Second
 )
 
 func NewCommand(serverAddr string) *Command {
 	return &Command{cl: &http.Client{Timeout: defaultRequestTimeout}, serverAddr: serverAddr}
 }
 
-func (c *Command) MakeScreenShotsAndPrintResult(urls []string) error {
+func (c *Command) do(method, path string, body interface{}, expectedCode int, resp interface{}) error {
 	buff := &bytes.Buffer{}
-	if err := json.NewEncoder(buff).Encode(api.MakeShotsRequest{URLs: urls}); err != nil {
-		return fmt.Errorf(`failed to encode request: [urls: %+v, errror: %w]`, urls, err)
+	if body != nil {
+		if err := json.NewEncoder(buff).Encode(body); err != nil {
+			return fmt.Errorf(`failed to encode request: [body: %+v, errror: %w]`, body, err)
+		}
 	}
-	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf(`%s%s`, c.serverAddr, api.ScreenshotPath), buff)
+	req, err := http.NewRequest(method, fmt.Sprintf(`%s%s`, c.serverAddr, path), buff)
 	if err != nil {
-		return fmt.Errorf(`failed to request request: [path: %s, method: %s, error: %w]`, api.ScreenshotVersionsPath, http.MethodPost, err)
+		return fmt.Errorf(`failed to request request: [path: %s, method: %s, error: %w]`, path, method, err)
 	}
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	resp, err := c.cl.Do(req)
+	r, err := c.cl.Do(req)
 	if err != nil {
 		return fmt.Errorf(`failed to do request: [url: %s, error: %w]`, req.URL, err)
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		data, _ := ioutil.ReadAll(resp.Body)
-		return fmt.Errorf(`received not successfull response code: [code: %s, response: %s]`, resp.Status, data)
+	defer r.Body.Close()
+	if r.StatusCode != expectedCode {
+		data, _ := ioutil.ReadAll(r.Body)
+		return fmt.Errorf(`received not successfull response code: [code: %s, response: %s]`, r.Status, data)
 	}
-	var list []api.ResponseItem
-	if err = json.NewDecoder(resp.Body).Decode(&list); err != nil {
+	if err = json.NewDecoder(r.Body).Decode(resp); err != nil {
 		return fmt.Errorf(`failed to decode response: [error: %w]`, err)
 	}
+	return nil
+}
+
+func (c *Command) MakeScreenShotsAndPrintResult(urls []string, opt capture.ShotOptions, priority capture.Priority) error {
+	req := api.NewMakeShotsRequest(urls, opt)
+	req.Priority = priority
+	var list []api.ResponseItem
+	if err := c.do(http.MethodPost, api.ScreenshotPath, req, http.StatusOK, &list); err != nil {
+		return err
+	}
 	for _, el := range list {
-		msg := fmt.Sprintf(`screenshot done for %s. you may fetch image by %s%s?url=%s`,
-			el.URL, c.serverAddr, api.ScreenshotPath, el.URL)
-		if !el.Success {
-			msg = fmt.Sprintf(`screenshot failed for %s with error %s`, el.URL, el.Error)
-		}
-		log.Println(msg)
+		c.printResult(el.URL, el.Success, el.Error)
 	}
 	return nil
 }
+
+func (c *Command) MakeScreenShotsJobAndPrintResult(urls []string, opt capture.ShotOptions, priority capture.Priority) error {
+	req := api.NewMakeShotsRequest(urls, opt)
+	req.Priority = priority
+	var job store.Job
+	if err := c.do(http.MethodPost, api.JobsPath, req, http.StatusAccepted, &job); err != nil {
+		return err
+	}
+	log.Println(fmt.Sprintf(`job %s created for %d urls. status is available by %s%s/%s`, job.ID, len(job.Items), c.serverAddr, api.JobsPath, job.ID))
+	printed := map[string]bool{}
+	for {
+		for _, it := range job.Items {
+			if !it.State.IsFinal() || printed[it.ID] {
+				continue
+			}
+			printed[it.ID] = true
+			c.printResult(it.URL, it.State == store.JobStateSucceeded, it.Error)
+		}
+		if job.State.IsFinal() {
+			return nil
+		}
+		<-time.After(jobPollInterval)
+		if err := c.do(http.MethodGet, fmt.Sprintf(`%s/%s`, api.JobsPath, job.ID), nil, http.StatusOK, &job); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Command) printResult(url string, success bool, errMsg string) {
+	msg := fmt.Sprintf(`screenshot done for %s. you may fetch image by %s%s?url=%s`,
+		url, c.serverAddr, api.ScreenshotPath, url)
+	if !success {
+		msg = fmt.Sprintf(`screenshot failed for %s with error %s`, url, errMsg)
+	}
+	log.Println(msg)
+}
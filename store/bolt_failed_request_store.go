@@ -0,0 +1,116 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+type BoltFailedRequestRepo struct {
+	db     *bolt.DB
+	bucket []byte
+}
+
+func NewBoltFailedRequestRepo(db *bolt.DB, bucket string) (*BoltFailedRequestRepo, error) {
+	if err := ensureBoltBuckets(db, bucket); err != nil {
+		return nil, err
+	}
+	return &BoltFailedRequestRepo{db: db, bucket: []byte(bucket)}, nil
+}
+
+func (b *BoltFailedRequestRepo) put(tx *bolt.Tx, r FailedRequest) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf(`failed to marshal failed request: [request: %+v, error: %w]`, r, err)
+	}
+	return tx.Bucket(b.bucket).Put([]byte(r.ID), data)
+}
+
+func (b *BoltFailedRequestRepo) get(tx *bolt.Tx, id string) (FailedRequest, error) {
+	data := tx.Bucket(b.bucket).Get([]byte(id))
+	if data == nil {
+		return FailedRequest{}, ErrNotFound{}
+	}
+	var r FailedRequest
+	if err := json.Unmarshal(data, &r); err != nil {
+		return FailedRequest{}, fmt.Errorf(`failed to unmarshal failed request: [id: %s, error: %w]`, id, err)
+	}
+	return r, nil
+}
+
+// Record creates failed request or, when request with the same id failed before, appends new attempts to it
+func (b *BoltFailedRequestRepo) Record(ctx context.Context, r FailedRequest) error {
+	now := time.Now().UTC()
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		existing, err := b.get(tx, r.ID)
+		switch err.(type) {
+		case nil:
+			existing.Errors = append(existing.Errors, r.Errors...)
+		case ErrNotFound:
+			existing = FailedRequest{ID: r.ID, Errors: r.Errors, CreatedAt: now}
+		default:
+			return err
+		}
+		existing.URL = r.URL
+		existing.Request = r.Request
+		existing.State = FailedRequestStateFailed
+		existing.UpdatedAt = now
+		return b.put(tx, existing)
+	})
+	if err != nil {
+		return fmt.Errorf(`failed to record failed request: [id: %s, error: %w]`, r.ID, err)
+	}
+	return nil
+}
+
+func (b *BoltFailedRequestRepo) MarkRequeued(ctx context.Context, id string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		r, err := b.get(tx, id)
+		if err != nil {
+			return err
+		}
+		r.State = FailedRequestStateRequeued
+		r.Requeues++
+		r.UpdatedAt = time.Now().UTC()
+		return b.put(tx, r)
+	})
+}
+
+func (b *BoltFailedRequestRepo) Get(ctx context.Context, id string) (FailedRequest, error) {
+	var r FailedRequest
+	err := b.db.View(func(tx *bolt.Tx) error {
+		var err error
+		r, err = b.get(tx, id)
+		return err
+	})
+	return r, err
+}
+
+// List returns the most recently failed requests. empty state means any state
+func (b *BoltFailedRequestRepo) List(ctx context.Context, state FailedRequestState, limit int) ([]FailedRequest, error) {
+	list := []FailedRequest{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(b.bucket).ForEach(func(k, v []byte) error {
+			var r FailedRequest
+			if err := json.Unmarshal(v, &r); err != nil {
+				return fmt.Errorf(`failed to unmarshal failed request: [id: %s, error: %w]`, k, err)
+			}
+			if state == "" || r.State == state {
+				list = append(list, r)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf(`failed to list failed requests: [error: %w]`, err)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].UpdatedAt.After(list[j].UpdatedAt) })
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
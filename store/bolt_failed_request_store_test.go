@@ -0,0 +1,43 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoltFailedRequestRepo_Record(t *testing.T) {
+	db, cleanup := openTestBoltDB(t)
+	defer cleanup()
+	repo, err := NewBoltFailedRequestRepo(db, "failed_requests")
+	require.NoError(t, err)
+	first := FailedAttempt{At: time.Now().UTC(), Attempt: 1, ErrorClass: "timeout", Error: "timeout"}
+	r := FailedRequest{ID: uuid.New().String(), URL: "http://" + uuid.New().String(), Request: `{"url":"http://a.com"}`, Errors: []FailedAttempt{first}}
+	require.NoError(t, repo.Record(context.Background(), r))
+
+	list, err := repo.List(context.Background(), FailedRequestStateFailed, 10)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	require.Equal(t, []FailedAttempt{first}, list[0].Errors)
+
+	require.NoError(t, repo.MarkRequeued(context.Background(), r.ID))
+	list, err = repo.List(context.Background(), FailedRequestStateFailed, 10)
+	require.NoError(t, err)
+	require.Empty(t, list)
+
+	second := FailedAttempt{At: time.Now().UTC(), Attempt: 1, ErrorClass: "dns", Error: "net::ERR_NAME_NOT_RESOLVED"}
+	r.Errors = []FailedAttempt{second}
+	require.NoError(t, repo.Record(context.Background(), r))
+	fromDB, err := repo.Get(context.Background(), r.ID)
+	require.NoError(t, err)
+	require.Equal(t, FailedRequestStateFailed, fromDB.State)
+	require.Equal(t, 1, fromDB.Requeues)
+	require.Equal(t, []FailedAttempt{first, second}, fromDB.Errors)
+
+	require.Equal(t, ErrNotFound{}, repo.MarkRequeued(context.Background(), uuid.New().String()))
+	_, err = repo.Get(context.Background(), uuid.New().String())
+	require.Equal(t, ErrNotFound{}, err)
+}
@@ -0,0 +1,113 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+type boltHostSlot struct {
+	Holder    string    `json:"holder"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type boltHostRate struct {
+	NextAt time.Time `json:"next_at"`
+}
+
+// BoltHostLimitRepo keeps per host slots and request rate in embedded database. it limits single instance only
+type BoltHostLimitRepo struct {
+	db     *bolt.DB
+	bucket []byte
+}
+
+func NewBoltHostLimitRepo(db *bolt.DB, bucket string) (*BoltHostLimitRepo, error) {
+	if err := ensureBoltBuckets(db, bucket); err != nil {
+		return nil, err
+	}
+	return &BoltHostLimitRepo{db: db, bucket: []byte(bucket)}, nil
+}
+
+func (b *BoltHostLimitRepo) put(tx *bolt.Tx, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf(`failed to marshal host limit: [key: %s, error: %w]`, key, err)
+	}
+	return tx.Bucket(b.bucket).Put([]byte(key), data)
+}
+
+// AcquireSlot takes one of host slots which is free or whose lease expired. it returns false when all slots are held
+func (b *BoltHostLimitRepo) AcquireSlot(ctx context.Context, host, holder string, slots int, lease time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	acquired := false
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		for i := 0; i < slots; i++ {
+			key := hostSlotID(host, i)
+			if data := tx.Bucket(b.bucket).Get([]byte(key)); data != nil {
+				var s boltHostSlot
+				if err := json.Unmarshal(data, &s); err != nil {
+					return fmt.Errorf(`failed to unmarshal host slot: [key: %s, error: %w]`, key, err)
+				}
+				if s.ExpiresAt.After(now) {
+					continue
+				}
+			}
+			acquired = true
+			return b.put(tx, key, boltHostSlot{Holder: holder, ExpiresAt: now.Add(lease)})
+		}
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf(`failed to acquire host slot: [host: %s, error: %w]`, host, err)
+	}
+	return acquired, nil
+}
+
+func (b *BoltHostLimitRepo) ReleaseSlot(ctx context.Context, host, holder string) error {
+	prefix := []byte(hostSlotPrefix(host))
+	return b.db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(b.bucket).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var s boltHostSlot
+			if err := json.Unmarshal(v, &s); err != nil {
+				return fmt.Errorf(`failed to unmarshal host slot: [key: %s, error: %w]`, k, err)
+			}
+			if s.Holder == holder {
+				return c.Delete()
+			}
+		}
+		return nil
+	})
+}
+
+// ReserveRate returns time when next request to host may start and moves it by interval for the following one.
+// it returns false and leaves next request time unchanged when it falls after deadline. zero deadline is not checked
+func (b *BoltHostLimitRepo) ReserveRate(ctx context.Context, host string, interval time.Duration, deadline time.Time) (time.Time, bool, error) {
+	key := hostRateID(host)
+	start := time.Now().UTC()
+	reserved := false
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		if data := tx.Bucket(b.bucket).Get([]byte(key)); data != nil {
+			var r boltHostRate
+			if err := json.Unmarshal(data, &r); err != nil {
+				return fmt.Errorf(`failed to unmarshal host rate: [key: %s, error: %w]`, key, err)
+			}
+			if r.NextAt.After(start) {
+				start = r.NextAt
+			}
+		}
+		if !deadline.IsZero() && start.After(deadline) {
+			return nil
+		}
+		reserved = true
+		return b.put(tx, key, boltHostRate{NextAt: start.Add(interval)})
+	})
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf(`failed to reserve host rate: [host: %s, error: %w]`, host, err)
+	}
+	return start, reserved, nil
+}
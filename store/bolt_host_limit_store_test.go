@@ -0,0 +1,64 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoltHostLimitRepo_AcquireSlot(t *testing.T) {
+	db, cleanup := openTestBoltDB(t)
+	defer cleanup()
+	repo, err := NewBoltHostLimitRepo(db, "host_limits")
+	require.NoError(t, err)
+	ctx := context.Background()
+	host := uuid.New().String()
+	first, second := uuid.New().String(), uuid.New().String()
+	ok, err := repo.AcquireSlot(ctx, host, first, 1, time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = repo.AcquireSlot(ctx, host, second, 1, time.Minute)
+	require.NoError(t, err)
+	require.False(t, ok)
+	ok, err = repo.AcquireSlot(ctx, uuid.New().String(), second, 1, time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	require.NoError(t, repo.ReleaseSlot(ctx, host, first))
+	ok, err = repo.AcquireSlot(ctx, host, second, 1, time.Millisecond)
+	require.NoError(t, err)
+	require.True(t, ok)
+	// lease of crashed holder expires
+	<-time.After(5 * time.Millisecond)
+	ok, err = repo.AcquireSlot(ctx, host, first, 1, time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+func TestBoltHostLimitRepo_ReserveRate(t *testing.T) {
+	db, cleanup := openTestBoltDB(t)
+	defer cleanup()
+	repo, err := NewBoltHostLimitRepo(db, "host_limits")
+	require.NoError(t, err)
+	host := uuid.New().String()
+	first, ok, err := repo.ReserveRate(context.Background(), host, time.Second, time.Time{})
+	require.NoError(t, err)
+	require.True(t, ok)
+	second, ok, err := repo.ReserveRate(context.Background(), host, time.Second, time.Time{})
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, first.Add(time.Second), second)
+
+	// time after deadline is refused and stays free for the next request
+	refused, ok, err := repo.ReserveRate(context.Background(), host, time.Second, second)
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Equal(t, second.Add(time.Second), refused)
+	third, ok, err := repo.ReserveRate(context.Background(), host, time.Second, refused)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, refused, third)
+}
@@ -0,0 +1,118 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+type BoltJobRepo struct {
+	db     *bolt.DB
+	bucket []byte
+}
+
+func NewBoltJobRepo(db *bolt.DB, bucket string) (*BoltJobRepo, error) {
+	if err := ensureBoltBuckets(db, bucket); err != nil {
+		return nil, err
+	}
+	return &BoltJobRepo{db: db, bucket: []byte(bucket)}, nil
+}
+
+func (b *BoltJobRepo) put(tx *bolt.Tx, job Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf(`failed to marshal job: [job: %+v, error: %w]`, job, err)
+	}
+	return tx.Bucket(b.bucket).Put([]byte(job.ID), data)
+}
+
+func (b *BoltJobRepo) get(tx *bolt.Tx, id string) (Job, error) {
+	data := tx.Bucket(b.bucket).Get([]byte(id))
+	if data == nil {
+		return Job{}, ErrNotFound{}
+	}
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return Job{}, fmt.Errorf(`failed to unmarshal job: [id: %s, error: %w]`, id, err)
+	}
+	return job, nil
+}
+
+func (b *BoltJobRepo) Create(ctx context.Context, job *Job) error {
+	if job.ID == "" {
+		job.ID = uuid.New().String()
+	}
+	now := time.Now().UTC()
+	if job.CreatedAt.IsZero() {
+		job.CreatedAt = now
+	}
+	for i := range job.Items {
+		if job.Items[i].ID == "" {
+			job.Items[i].ID = uuid.New().String()
+		}
+		if job.Items[i].State == "" {
+			job.Items[i].State = JobStateQueued
+		}
+		job.Items[i].UpdatedAt = now
+	}
+	if err := b.db.Update(func(tx *bolt.Tx) error { return b.put(tx, *job) }); err != nil {
+		return fmt.Errorf(`failed to put job: [job: %+v, error: %w]`, job, err)
+	}
+	job.State = job.ComputeState()
+	return nil
+}
+
+func (b *BoltJobRepo) Get(ctx context.Context, id string) (Job, error) {
+	var job Job
+	err := b.db.View(func(tx *bolt.Tx) error {
+		var err error
+		job, err = b.get(tx, id)
+		return err
+	})
+	if err != nil {
+		return Job{}, err
+	}
+	job.State = job.ComputeState()
+	return job, nil
+}
+
+func (b *BoltJobRepo) UpdateItem(ctx context.Context, jobID, itemID string, u JobItemUpdate) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		job, err := b.get(tx, jobID)
+		if _, ok := err.(ErrNotFound); ok {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for i := range job.Items {
+			it := &job.Items[i]
+			// final state must not be overwritten by late running transition
+			if it.ID != itemID || (!u.State.IsFinal() && it.State != JobStateQueued) {
+				continue
+			}
+			it.State = u.State
+			it.UpdatedAt = time.Now().UTC()
+			if u.Error != "" {
+				it.Error = u.Error
+			}
+			if u.ErrorCode != "" {
+				it.ErrorCode = u.ErrorCode
+			}
+			if u.MetadataID != "" {
+				it.MetadataID = u.MetadataID
+				it.Version = u.Version
+			}
+			return b.put(tx, job)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf(`failed to update job item: [job_id: %s, item_id: %s, error: %w]`, jobID, itemID, err)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoltJobRepo_UpdateItem(t *testing.T) {
+	db, cleanup := openTestBoltDB(t)
+	defer cleanup()
+	repo, err := NewBoltJobRepo(db, "jobs")
+	require.NoError(t, err)
+	job := Job{Items: []JobItem{{URL: uuid.New().String()}, {URL: uuid.New().String()}}}
+	require.NoError(t, repo.Create(context.Background(), &job))
+	require.Equal(t, JobStateQueued, job.State)
+
+	require.NoError(t, repo.UpdateItem(context.Background(), job.ID, job.Items[0].ID, JobItemUpdate{State: JobStateRunning}))
+	require.NoError(t, repo.UpdateItem(context.Background(), job.ID, job.Items[0].ID, JobItemUpdate{State: JobStateSucceeded, MetadataID: uuid.New().String(), Version: 1}))
+	require.NoError(t, repo.UpdateItem(context.Background(), job.ID, job.Items[1].ID, JobItemUpdate{State: JobStateFailed, Error: "some error"}))
+	// late running transition must be ignored
+	require.NoError(t, repo.UpdateItem(context.Background(), job.ID, job.Items[1].ID, JobItemUpdate{State: JobStateRunning}))
+
+	fromDB, err := repo.Get(context.Background(), job.ID)
+	require.NoError(t, err)
+	require.Equal(t, JobStateFailed, fromDB.State)
+	require.Equal(t, JobStateSucceeded, fromDB.Items[0].State)
+	require.Equal(t, 1, fromDB.Items[0].Version)
+	require.Equal(t, JobStateFailed, fromDB.Items[1].State)
+	require.Equal(t, "some error", fromDB.Items[1].Error)
+
+	_, err = repo.Get(context.Background(), uuid.New().String())
+	require.Equal(t, ErrNotFound{}, err)
+}
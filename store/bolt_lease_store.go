@@ -0,0 +1,74 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+type boltLease struct {
+	Holder    string    `json:"holder"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// BoltLeaseRepo keeps leases in embedded database. it elects holder among goroutines of single instance only
+type BoltLeaseRepo struct {
+	db     *bolt.DB
+	bucket []byte
+}
+
+func NewBoltLeaseRepo(db *bolt.DB, bucket string) (*BoltLeaseRepo, error) {
+	if err := ensureBoltBuckets(db, bucket); err != nil {
+		return nil, err
+	}
+	return &BoltLeaseRepo{db: db, bucket: []byte(bucket)}, nil
+}
+
+// Acquire takes lease which is free or expired, or extends lease already held by holder. it returns false when
+// lease is held by other holder
+func (b *BoltLeaseRepo) Acquire(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	acquired := false
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		if data := tx.Bucket(b.bucket).Get([]byte(name)); data != nil {
+			var l boltLease
+			if err := json.Unmarshal(data, &l); err != nil {
+				return fmt.Errorf(`failed to unmarshal lease: [name: %s, error: %w]`, name, err)
+			}
+			if l.Holder != holder && l.ExpiresAt.After(now) {
+				return nil
+			}
+		}
+		data, err := json.Marshal(boltLease{Holder: holder, ExpiresAt: now.Add(ttl)})
+		if err != nil {
+			return fmt.Errorf(`failed to marshal lease: [name: %s, error: %w]`, name, err)
+		}
+		acquired = true
+		return tx.Bucket(b.bucket).Put([]byte(name), data)
+	})
+	if err != nil {
+		return false, fmt.Errorf(`failed to acquire lease: [name: %s, error: %w]`, name, err)
+	}
+	return acquired, nil
+}
+
+// Release frees lease so other instance can take it without waiting for expiration
+func (b *BoltLeaseRepo) Release(ctx context.Context, name, holder string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		data := tx.Bucket(b.bucket).Get([]byte(name))
+		if data == nil {
+			return nil
+		}
+		var l boltLease
+		if err := json.Unmarshal(data, &l); err != nil {
+			return fmt.Errorf(`failed to unmarshal lease: [name: %s, error: %w]`, name, err)
+		}
+		if l.Holder != holder {
+			return nil
+		}
+		return tx.Bucket(b.bucket).Delete([]byte(name))
+	})
+}
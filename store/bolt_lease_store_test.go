@@ -0,0 +1,44 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoltLeaseRepo_Acquire(t *testing.T) {
+	db, cleanup := openTestBoltDB(t)
+	defer cleanup()
+	repo, err := NewBoltLeaseRepo(db, "leases")
+	require.NoError(t, err)
+	ctx := context.Background()
+	name := uuid.New().String()
+	first, second := uuid.New().String(), uuid.New().String()
+	ok, err := repo.Acquire(ctx, name, first, time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = repo.Acquire(ctx, name, second, time.Minute)
+	require.NoError(t, err)
+	require.False(t, ok)
+	// holder extends own lease
+	ok, err = repo.Acquire(ctx, name, first, time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	require.NoError(t, repo.Release(ctx, name, second))
+	ok, err = repo.Acquire(ctx, name, second, time.Minute)
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.NoError(t, repo.Release(ctx, name, first))
+	ok, err = repo.Acquire(ctx, name, second, time.Millisecond)
+	require.NoError(t, err)
+	require.True(t, ok)
+	// expired lease is taken over
+	time.Sleep(5 * time.Millisecond)
+	ok, err = repo.Acquire(ctx, name, first, time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+}
@@ -0,0 +1,144 @@
+package store
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+func OpenBoltDB(path string, timeout time.Duration) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: timeout})
+	if err != nil {
+		return nil, fmt.Errorf(`failed to open bolt database: [path: %s, error: %w]`, path, err)
+	}
+	return db, nil
+}
+
+func ensureBoltBuckets(db *bolt.DB, names ...string) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		for _, name := range names {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return fmt.Errorf(`failed to create bucket: [name: %s, error: %w]`, name, err)
+			}
+		}
+		return nil
+	})
+}
+
+type BoltMetadataRepo struct {
+	db                   *bolt.DB
+	metadataBucket       []byte
+	versionCounterBucket []byte
+}
+
+func NewBoltMetadataRepo(db *bolt.DB, metadataBucket, versionCounterBucket string) (*BoltMetadataRepo, error) {
+	if err := ensureBoltBuckets(db, metadataBucket, versionCounterBucket); err != nil {
+		return nil, err
+	}
+	return &BoltMetadataRepo{db: db, metadataBucket: []byte(metadataBucket), versionCounterBucket: []byte(versionCounterBucket)}, nil
+}
+
+// metadata is keyed by url prefix followed by big endian version, so versions of one url are adjacent
+// and can be read with prefix scan. url is length prefixed to avoid matching urls which share prefix
+func boltMetadataPrefix(url string) []byte {
+	key := make([]byte, 4, 4+len(url)+8)
+	binary.BigEndian.PutUint32(key, uint32(len(url)))
+	return append(key, url...)
+}
+
+func boltMetadataKey(url string, version int) []byte {
+	key := boltMetadataPrefix(url)
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint64(v, uint64(version))
+	return append(key, v...)
+}
+
+func (b *BoltMetadataRepo) Save(ctx context.Context, doc *Metadata) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		counter := tx.Bucket(b.versionCounterBucket)
+		key := versionKey(doc.Url, doc.Selector)
+		var version uint64
+		if v := counter.Get([]byte(key)); v != nil {
+			version = binary.BigEndian.Uint64(v)
+		}
+		version++
+		v := make([]byte, 8)
+		binary.BigEndian.PutUint64(v, version)
+		if err := counter.Put([]byte(key), v); err != nil {
+			return fmt.Errorf(`failed to generete new version: [url: %s, error: %w]`, doc.Url, err)
+		}
+		saved := *doc
+		saved.Version = int(version)
+		if saved.ID == "" {
+			saved.ID = uuid.New().String()
+		}
+		if saved.CreatedAt.IsZero() {
+			saved.CreatedAt = time.Now().UTC()
+		}
+		data, err := json.Marshal(saved)
+		if err != nil {
+			return fmt.Errorf(`failed to marshal doc: [doc: %+v, error: %w]`, saved, err)
+		}
+		if err = tx.Bucket(b.metadataBucket).Put(boltMetadataKey(key, saved.Version), data); err != nil {
+			return fmt.Errorf(`failed to put doc to metadata bucket: [doc: %+v, error: %w]`, saved, err)
+		}
+		*doc = saved
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf(`failed to save metadata: [error: %w]`, err)
+	}
+	return nil
+}
+
+func (b *BoltMetadataRepo) Get(ctx context.Context, url, selector string, version int) (Metadata, error) {
+	var doc Metadata
+	err := b.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(b.metadataBucket).Get(boltMetadataKey(versionKey(url, selector), version))
+		if data == nil {
+			return ErrNotFound{}
+		}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		// element shots saved before they got own versions share key of page
+		if doc.Selector != selector {
+			return ErrNotFound{}
+		}
+		return nil
+	})
+	if err != nil {
+		if _, ok := err.(ErrNotFound); ok {
+			return Metadata{}, err
+		}
+		return Metadata{}, fmt.Errorf(`failed to get metadata: [url: %s, selector: %s, version: %d, error: %w]`, url, selector, version, err)
+	}
+	return doc, nil
+}
+
+func (b *BoltMetadataRepo) GetAllVersions(ctx context.Context, url, selector string) ([]Metadata, error) {
+	var list []Metadata
+	prefix := boltMetadataPrefix(versionKey(url, selector))
+	err := b.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(b.metadataBucket).Cursor()
+		for k, v := c.Seek(prefix); k != nil && len(k) == len(prefix)+8 && string(k[:len(prefix)]) == string(prefix); k, v = c.Next() {
+			var doc Metadata
+			if err := json.Unmarshal(v, &doc); err != nil {
+				return fmt.Errorf(`failed to unmarshal doc: [key: %x, error: %w]`, k, err)
+			}
+			if doc.Selector == selector {
+				list = append(list, doc)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf(`failed to get metadata versions: [url: %s, selector: %s, error: %w]`, url, selector, err)
+	}
+	return list, nil
+}
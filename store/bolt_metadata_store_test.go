@@ -0,0 +1,66 @@
+package store
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func openTestBoltDB(t *testing.T) (*bolt.DB, func()) {
+	dir, err := ioutil.TempDir("", "screenshot")
+	require.NoError(t, err)
+	db, err := OpenBoltDB(filepath.Join(dir, "test.db"), time.Second)
+	require.NoError(t, err)
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestBoltMetadataRepo_Save(t *testing.T) {
+	db, cleanup := openTestBoltDB(t)
+	defer cleanup()
+	repo, err := NewBoltMetadataRepo(db, "metadata", "versions")
+	require.NoError(t, err)
+	url := uuid.New().String()
+	doc := Metadata{ID: uuid.New().String(), CreatedAt: time.Now().UTC(), FileID: uuid.New().String(), Url: url}
+	require.NoError(t, repo.Save(context.Background(), &doc))
+	require.Equal(t, 1, doc.Version)
+	fromDB, err := repo.Get(context.Background(), doc.Url, "", doc.Version)
+	require.NoError(t, err)
+	require.Equal(t, doc, fromDB)
+	doc2 := Metadata{FileID: uuid.New().String(), Url: url}
+	require.NoError(t, repo.Save(context.Background(), &doc2))
+	require.Equal(t, 2, doc2.Version)
+	require.NotEmpty(t, doc2.ID)
+
+	// url sharing prefix must not be listed among versions
+	anotherDoc := Metadata{ID: uuid.New().String(), FileID: uuid.New().String(), Url: url + "/path"}
+	require.NoError(t, repo.Save(context.Background(), &anotherDoc))
+	require.Equal(t, 1, anotherDoc.Version)
+
+	// element shot has own versions
+	element := Metadata{ID: uuid.New().String(), FileID: uuid.New().String(), Url: url, Selector: "header"}
+	require.NoError(t, repo.Save(context.Background(), &element))
+	require.Equal(t, 1, element.Version)
+
+	list, err := repo.GetAllVersions(context.Background(), url, "")
+	require.NoError(t, err)
+	require.Equal(t, []Metadata{doc, doc2}, list)
+	list, err = repo.GetAllVersions(context.Background(), url, "header")
+	require.NoError(t, err)
+	require.Equal(t, []Metadata{element}, list)
+	fromDB, err = repo.Get(context.Background(), url, "header", 1)
+	require.NoError(t, err)
+	require.Equal(t, element, fromDB)
+
+	_, err = repo.Get(context.Background(), url, "", 3)
+	require.Equal(t, ErrNotFound{}, err)
+}
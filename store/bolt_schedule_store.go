@@ -0,0 +1,167 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+type BoltScheduleRepo struct {
+	db     *bolt.DB
+	bucket []byte
+}
+
+func NewBoltScheduleRepo(db *bolt.DB, bucket string) (*BoltScheduleRepo, error) {
+	if err := ensureBoltBuckets(db, bucket); err != nil {
+		return nil, err
+	}
+	return &BoltScheduleRepo{db: db, bucket: []byte(bucket)}, nil
+}
+
+func (b *BoltScheduleRepo) put(tx *bolt.Tx, s Schedule) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf(`failed to marshal schedule: [schedule: %+v, error: %w]`, s, err)
+	}
+	return tx.Bucket(b.bucket).Put([]byte(s.ID), data)
+}
+
+func (b *BoltScheduleRepo) get(tx *bolt.Tx, id string) (Schedule, error) {
+	data := tx.Bucket(b.bucket).Get([]byte(id))
+	if data == nil {
+		return Schedule{}, ErrNotFound{}
+	}
+	var s Schedule
+	if err := json.Unmarshal(data, &s); err != nil {
+		return Schedule{}, fmt.Errorf(`failed to unmarshal schedule: [id: %s, error: %w]`, id, err)
+	}
+	return s, nil
+}
+
+func (b *BoltScheduleRepo) Create(ctx context.Context, s *Schedule) error {
+	s.ID = uuid.New().String()
+	s.CreatedAt = time.Now().UTC()
+	s.UpdatedAt = s.CreatedAt
+	if err := b.db.Update(func(tx *bolt.Tx) error { return b.put(tx, *s) }); err != nil {
+		return fmt.Errorf(`failed to create schedule: [id: %s, error: %w]`, s.ID, err)
+	}
+	return nil
+}
+
+func (b *BoltScheduleRepo) Get(ctx context.Context, id string) (Schedule, error) {
+	var s Schedule
+	err := b.db.View(func(tx *bolt.Tx) error {
+		var err error
+		s, err = b.get(tx, id)
+		return err
+	})
+	return s, err
+}
+
+func (b *BoltScheduleRepo) all() ([]Schedule, error) {
+	list := []Schedule{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(b.bucket).ForEach(func(k, v []byte) error {
+			var s Schedule
+			if err := json.Unmarshal(v, &s); err != nil {
+				return fmt.Errorf(`failed to unmarshal schedule: [id: %s, error: %w]`, k, err)
+			}
+			list = append(list, s)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf(`failed to list schedules: [error: %w]`, err)
+	}
+	return list, nil
+}
+
+// List returns the most recently created schedules
+func (b *BoltScheduleRepo) List(ctx context.Context, limit int) ([]Schedule, error) {
+	list, err := b.all()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
+
+// Due returns enabled schedules which should have fired by now, the most overdue first
+func (b *BoltScheduleRepo) Due(ctx context.Context, now time.Time, limit int) ([]Schedule, error) {
+	all, err := b.all()
+	if err != nil {
+		return nil, err
+	}
+	list := []Schedule{}
+	for _, s := range all {
+		if s.Enabled && !s.NextRunAt.After(now) {
+			list = append(list, s)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].NextRunAt.Before(list[j].NextRunAt) })
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
+
+// Update replaces url, request, cron expression, timezone, enabled flag and next run of schedule
+func (b *BoltScheduleRepo) Update(ctx context.Context, s *Schedule) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		existing, err := b.get(tx, s.ID)
+		if err != nil {
+			return err
+		}
+		existing.URL = s.URL
+		existing.Request = s.Request
+		existing.Cron = s.Cron
+		existing.Timezone = s.Timezone
+		existing.Enabled = s.Enabled
+		existing.NextRunAt = s.NextRunAt
+		existing.UpdatedAt = time.Now().UTC()
+		s.UpdatedAt = existing.UpdatedAt
+		return b.put(tx, existing)
+	})
+}
+
+func (b *BoltScheduleRepo) Delete(ctx context.Context, id string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(b.bucket).Get([]byte(id)) == nil {
+			return ErrNotFound{}
+		}
+		return tx.Bucket(b.bucket).Delete([]byte(id))
+	})
+}
+
+// MarkRun moves schedule due at runAt to its next run. it returns false when schedule was updated or fired meanwhile
+func (b *BoltScheduleRepo) MarkRun(ctx context.Context, id string, runAt, lastRunAt, nextRunAt time.Time) (bool, error) {
+	marked := false
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		s, err := b.get(tx, id)
+		if _, ok := err.(ErrNotFound); ok {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !s.Enabled || !s.NextRunAt.Equal(runAt) {
+			return nil
+		}
+		s.LastRunAt = lastRunAt
+		s.NextRunAt = nextRunAt
+		marked = true
+		return b.put(tx, s)
+	})
+	if err != nil {
+		return false, fmt.Errorf(`failed to mark schedule run: [id: %s, error: %w]`, id, err)
+	}
+	return marked, nil
+}
@@ -0,0 +1,110 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+type BoltWebhookDeliveryRepo struct {
+	db     *bolt.DB
+	bucket []byte
+}
+
+func NewBoltWebhookDeliveryRepo(db *bolt.DB, bucket string) (*BoltWebhookDeliveryRepo, error) {
+	if err := ensureBoltBuckets(db, bucket); err != nil {
+		return nil, err
+	}
+	return &BoltWebhookDeliveryRepo{db: db, bucket: []byte(bucket)}, nil
+}
+
+func (b *BoltWebhookDeliveryRepo) put(tx *bolt.Tx, d WebhookDelivery) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Errorf(`failed to marshal webhook delivery: [delivery: %+v, error: %w]`, d, err)
+	}
+	return tx.Bucket(b.bucket).Put([]byte(d.ID), data)
+}
+
+func (b *BoltWebhookDeliveryRepo) get(tx *bolt.Tx, id string) (WebhookDelivery, error) {
+	data := tx.Bucket(b.bucket).Get([]byte(id))
+	if data == nil {
+		return WebhookDelivery{}, ErrNotFound{}
+	}
+	var d WebhookDelivery
+	if err := json.Unmarshal(data, &d); err != nil {
+		return WebhookDelivery{}, fmt.Errorf(`failed to unmarshal webhook delivery: [id: %s, error: %w]`, id, err)
+	}
+	return d, nil
+}
+
+func (b *BoltWebhookDeliveryRepo) Create(ctx context.Context, d *WebhookDelivery) error {
+	if d.ID == "" {
+		d.ID = uuid.New().String()
+	}
+	if d.CreatedAt.IsZero() {
+		d.CreatedAt = time.Now().UTC()
+	}
+	if d.Attempts == nil {
+		d.Attempts = []WebhookAttempt{}
+	}
+	if err := b.db.Update(func(tx *bolt.Tx) error { return b.put(tx, *d) }); err != nil {
+		return fmt.Errorf(`failed to put webhook delivery: [delivery: %+v, error: %w]`, d, err)
+	}
+	return nil
+}
+
+func (b *BoltWebhookDeliveryRepo) AddAttempt(ctx context.Context, id string, a WebhookAttempt, delivered bool) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		d, err := b.get(tx, id)
+		if err != nil {
+			return err
+		}
+		d.Attempts = append(d.Attempts, a)
+		d.Delivered = delivered
+		return b.put(tx, d)
+	})
+	if err != nil {
+		return fmt.Errorf(`failed to add webhook attempt: [id: %s, error: %w]`, id, err)
+	}
+	return nil
+}
+
+func (b *BoltWebhookDeliveryRepo) Get(ctx context.Context, id string) (WebhookDelivery, error) {
+	var d WebhookDelivery
+	err := b.db.View(func(tx *bolt.Tx) error {
+		var err error
+		d, err = b.get(tx, id)
+		return err
+	})
+	return d, err
+}
+
+func (b *BoltWebhookDeliveryRepo) List(ctx context.Context, onlyFailed bool, limit int) ([]WebhookDelivery, error) {
+	list := []WebhookDelivery{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(b.bucket).ForEach(func(k, v []byte) error {
+			var d WebhookDelivery
+			if err := json.Unmarshal(v, &d); err != nil {
+				return fmt.Errorf(`failed to unmarshal webhook delivery: [id: %s, error: %w]`, k, err)
+			}
+			if !onlyFailed || !d.Delivered {
+				list = append(list, d)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf(`failed to list webhook deliveries: [error: %w]`, err)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
@@ -0,0 +1,39 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoltWebhookDeliveryRepo_AddAttempt(t *testing.T) {
+	db, cleanup := openTestBoltDB(t)
+	defer cleanup()
+	repo, err := NewBoltWebhookDeliveryRepo(db, "webhook_deliveries")
+	require.NoError(t, err)
+	d := WebhookDelivery{CallbackURL: "http://" + uuid.New().String(), Payload: `{"success":true}`}
+	require.NoError(t, repo.Create(context.Background(), &d))
+	failed := WebhookAttempt{At: time.Now().UTC(), StatusCode: 500}
+	require.NoError(t, repo.AddAttempt(context.Background(), d.ID, failed, false))
+
+	list, err := repo.List(context.Background(), true, 10)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	require.Equal(t, []WebhookAttempt{failed}, list[0].Attempts)
+
+	succeeded := WebhookAttempt{At: time.Now().UTC(), StatusCode: 200}
+	require.NoError(t, repo.AddAttempt(context.Background(), d.ID, succeeded, true))
+	fromDB, err := repo.Get(context.Background(), d.ID)
+	require.NoError(t, err)
+	require.True(t, fromDB.Delivered)
+	require.Equal(t, []WebhookAttempt{failed, succeeded}, fromDB.Attempts)
+	list, err = repo.List(context.Background(), true, 10)
+	require.NoError(t, err)
+	require.Empty(t, list)
+
+	_, err = repo.Get(context.Background(), uuid.New().String())
+	require.Equal(t, ErrNotFound{}, err)
+}
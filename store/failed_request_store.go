@@ -0,0 +1,121 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type FailedRequestState string
+
+const (
+	FailedRequestStateFailed   FailedRequestState = "failed"
+	FailedRequestStateRequeued FailedRequestState = "requeued"
+)
+
+type FailedAttempt struct {
+	At         time.Time `json:"at" bson:"at"`
+	Attempt    int       `json:"attempt" bson:"attempt"`
+	ErrorClass string    `json:"error_class,omitempty" bson:"error_class,omitempty"`
+	Error      string    `json:"error" bson:"error"`
+}
+
+// FailedRequest is shot request which failed after all capture attempts. every requeue which failed again
+// appends its attempts to Errors
+type FailedRequest struct {
+	ID  string `json:"id" bson:"_id"`
+	URL string `json:"url" bson:"url"`
+	// shot request as it was published to queue
+	Request   string             `json:"request" bson:"request"`
+	State     FailedRequestState `json:"state" bson:"state"`
+	Errors    []FailedAttempt    `json:"errors" bson:"errors"`
+	Requeues  int                `json:"requeues" bson:"requeues"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+type MongodbFailedRequestRepo struct {
+	db         *mongo.Database
+	collection string
+}
+
+func NewMongodbFailedRequestRepo(cl *mongo.Client, database, collection string) *MongodbFailedRequestRepo {
+	return &MongodbFailedRequestRepo{db: cl.Database(database), collection: collection}
+}
+
+func (m *MongodbFailedRequestRepo) EnsureIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{{
+		Keys: bson.M{"state": 1},
+	}, {
+		Keys: bson.M{"updated_at": -1},
+	}}
+	if _, err := m.db.Collection(m.collection).Indexes().CreateMany(ctx, indexes); err != nil {
+		return fmt.Errorf(`failed to create failed request indexes: [indexes: %+v, error: %w]`, indexes, err)
+	}
+	return nil
+}
+
+// Record creates failed request or, when request with the same id failed before, appends new attempts to it
+func (m *MongodbFailedRequestRepo) Record(ctx context.Context, r FailedRequest) error {
+	now := time.Now().UTC()
+	f := bson.M{"_id": r.ID}
+	u := bson.M{
+		"$push":        bson.M{"errors": bson.M{"$each": r.Errors}},
+		"$set":         bson.M{"url": r.URL, "request": r.Request, "state": FailedRequestStateFailed, "updated_at": now},
+		"$setOnInsert": bson.M{"created_at": now, "requeues": 0},
+	}
+	if _, err := m.db.Collection(m.collection).UpdateOne(ctx, f, u, options.Update().SetUpsert(true)); err != nil {
+		return fmt.Errorf(`failed to record failed request: [filter: %v, error: %w]`, f, err)
+	}
+	return nil
+}
+
+func (m *MongodbFailedRequestRepo) MarkRequeued(ctx context.Context, id string) error {
+	f := bson.M{"_id": id}
+	u := bson.M{"$set": bson.M{"state": FailedRequestStateRequeued, "updated_at": time.Now().UTC()}, "$inc": bson.M{"requeues": 1}}
+	res, err := m.db.Collection(m.collection).UpdateOne(ctx, f, u)
+	if err != nil {
+		return fmt.Errorf(`failed to mark request as requeued: [filter: %v, update: %v, error: %w]`, f, u, err)
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound{}
+	}
+	return nil
+}
+
+func (m *MongodbFailedRequestRepo) Get(ctx context.Context, id string) (FailedRequest, error) {
+	var r FailedRequest
+	q := bson.M{"_id": id}
+	err := m.db.Collection(m.collection).FindOne(ctx, q).Decode(&r)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return FailedRequest{}, ErrNotFound{}
+	}
+	if err != nil {
+		return FailedRequest{}, fmt.Errorf(`failed to find document: [q: %+v, collection_name: %s, error: %w]`, q, m.collection, err)
+	}
+	return r, nil
+}
+
+// List returns the most recently failed requests. empty state means any state
+func (m *MongodbFailedRequestRepo) List(ctx context.Context, state FailedRequestState, limit int) ([]FailedRequest, error) {
+	list := []FailedRequest{}
+	q := bson.M{}
+	if state != "" {
+		q["state"] = state
+	}
+	l := int64(limit)
+	opt := &options.FindOptions{Sort: bson.M{"updated_at": -1}, Limit: &l}
+	res, err := m.db.Collection(m.collection).Find(ctx, q, opt)
+	if err != nil {
+		return nil, fmt.Errorf(`failed to find documents: [q: %v, collection_name: %s, error: %w]`, q, m.collection, err)
+	}
+	if err = res.All(ctx, &list); err != nil {
+		return nil, fmt.Errorf(`failed to decode result: [error: %w]`, err)
+	}
+	return list, nil
+}
@@ -0,0 +1,138 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// host limit documents are removed this period after they expire
+const hostLimitRetention = time.Minute
+
+// slot ids are numbered per host, so no more than given number of slots can be held at once
+func hostSlotID(host string, i int) string {
+	return fmt.Sprintf(`%s%d`, hostSlotPrefix(host), i)
+}
+
+func hostSlotPrefix(host string) string {
+	return `slot:` + host + `#`
+}
+
+func hostRateID(host string) string {
+	return `rate:` + host
+}
+
+// MongodbHostLimitRepo coordinates per host concurrency and request rate between capture instances
+type MongodbHostLimitRepo struct {
+	db         *mongo.Database
+	collection string
+}
+
+func NewMongodbHostLimitRepo(cl *mongo.Client, database, collection string) *MongodbHostLimitRepo {
+	return &MongodbHostLimitRepo{db: cl.Database(database), collection: collection}
+}
+
+func (m *MongodbHostLimitRepo) EnsureIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{{
+		Keys: bson.M{"holder": 1},
+	}, {
+		Keys:    bson.M{"expires_at": 1},
+		Options: options.Index().SetExpireAfterSeconds(int32(hostLimitRetention.Seconds())),
+	}}
+	if _, err := m.db.Collection(m.collection).Indexes().CreateMany(ctx, indexes); err != nil {
+		return fmt.Errorf(`failed to create host limit indexes: [indexes: %+v, error: %w]`, indexes, err)
+	}
+	return nil
+}
+
+// AcquireSlot takes one of host slots which is free or whose lease expired. it returns false when all slots are held
+func (m *MongodbHostLimitRepo) AcquireSlot(ctx context.Context, host, holder string, slots int, lease time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	for i := 0; i < slots; i++ {
+		f := bson.M{"_id": hostSlotID(host, i), "expires_at": bson.M{"$lt": now}}
+		u := bson.M{"$set": bson.M{"host": host, "holder": holder, "expires_at": now.Add(lease)}}
+		_, err := m.db.Collection(m.collection).UpdateOne(ctx, f, u, options.Update().SetUpsert(true))
+		if err == nil {
+			return true, nil
+		}
+		// slot exists and its lease is not expired
+		if isDuplicateKeyError(err) {
+			continue
+		}
+		return false, fmt.Errorf(`failed to acquire host slot: [filter: %v, error: %w]`, f, err)
+	}
+	return false, nil
+}
+
+func (m *MongodbHostLimitRepo) ReleaseSlot(ctx context.Context, host, holder string) error {
+	f := bson.M{"host": host, "holder": holder}
+	if _, err := m.db.Collection(m.collection).DeleteOne(ctx, f); err != nil {
+		return fmt.Errorf(`failed to release host slot: [filter: %v, error: %w]`, f, err)
+	}
+	return nil
+}
+
+type hostRate struct {
+	NextAt time.Time `bson:"next_at"`
+}
+
+// ReserveRate returns time when next request to host may start and moves it by interval for the following one.
+// it returns false and leaves next request time unchanged when it falls after deadline. zero deadline is not checked
+func (m *MongodbHostLimitRepo) ReserveRate(ctx context.Context, host string, interval time.Duration, deadline time.Time) (time.Time, bool, error) {
+	id := hostRateID(host)
+	for {
+		// mongo keeps milliseconds, so compared value must be truncated the same way
+		now := time.Now().UTC().Truncate(time.Millisecond)
+		var r hostRate
+		err := m.db.Collection(m.collection).FindOne(ctx, bson.M{"_id": id}).Decode(&r)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			next := now.Add(interval)
+			_, err = m.db.Collection(m.collection).InsertOne(ctx, bson.M{"_id": id, "next_at": next, "expires_at": next})
+			if err == nil {
+				return now, true, nil
+			}
+			if isDuplicateKeyError(err) {
+				continue
+			}
+			return time.Time{}, false, fmt.Errorf(`failed to insert host rate: [id: %s, error: %w]`, id, err)
+		}
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf(`failed to find host rate: [id: %s, error: %w]`, id, err)
+		}
+		start := r.NextAt.UTC()
+		if start.Before(now) {
+			start = now
+		}
+		if !deadline.IsZero() && start.After(deadline) {
+			return start, false, nil
+		}
+		next := start.Add(interval)
+		// update succeeds only if no other instance reserved the same time meanwhile
+		f := bson.M{"_id": id, "next_at": r.NextAt}
+		res, err := m.db.Collection(m.collection).UpdateOne(ctx, f, bson.M{"$set": bson.M{"next_at": next, "expires_at": next}})
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf(`failed to update host rate: [filter: %v, error: %w]`, f, err)
+		}
+		if res.MatchedCount == 1 {
+			return start, true, nil
+		}
+	}
+}
+
+func isDuplicateKeyError(err error) bool {
+	var we mongo.WriteException
+	if errors.As(err, &we) {
+		for _, e := range we.WriteErrors {
+			if e.Code == 11000 {
+				return true
+			}
+		}
+	}
+	var ce mongo.CommandError
+	return errors.As(err, &ce) && ce.Code == 11000
+}
@@ -0,0 +1,59 @@
+package store
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMongodbHostLimitRepo_AcquireSlot(t *testing.T) {
+	address := os.Getenv(testDatabaseEnvVariable)
+	cl, err := BuildMongoClient(context.Background(), address)
+	require.NoError(t, err)
+	repo := NewMongodbHostLimitRepo(cl, "test", uuid.New().String())
+	require.NoError(t, repo.EnsureIndexes(context.Background()))
+	ctx := context.Background()
+	host := uuid.New().String()
+	first, second, third := uuid.New().String(), uuid.New().String(), uuid.New().String()
+	for _, holder := range []string{first, second} {
+		ok, err := repo.AcquireSlot(ctx, host, holder, 2, time.Minute)
+		require.NoError(t, err)
+		require.True(t, ok)
+	}
+	ok, err := repo.AcquireSlot(ctx, host, third, 2, time.Minute)
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.NoError(t, repo.ReleaseSlot(ctx, host, first))
+	ok, err = repo.AcquireSlot(ctx, host, third, 2, time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+func TestMongodbHostLimitRepo_ReserveRate(t *testing.T) {
+	address := os.Getenv(testDatabaseEnvVariable)
+	cl, err := BuildMongoClient(context.Background(), address)
+	require.NoError(t, err)
+	repo := NewMongodbHostLimitRepo(cl, "test", uuid.New().String())
+	host := uuid.New().String()
+	first, ok, err := repo.ReserveRate(context.Background(), host, time.Second, time.Time{})
+	require.NoError(t, err)
+	require.True(t, ok)
+	second, ok, err := repo.ReserveRate(context.Background(), host, time.Second, time.Time{})
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, first.Add(time.Second), second)
+
+	// time after deadline is refused and stays free for the next request
+	refused, ok, err := repo.ReserveRate(context.Background(), host, time.Second, second)
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Equal(t, second.Add(time.Second), refused)
+	third, ok, err := repo.ReserveRate(context.Background(), host, time.Second, refused)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, refused, third)
+}
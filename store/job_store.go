@@ -0,0 +1,160 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/mongo"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type JobState string
+
+const (
+	JobStateQueued    JobState = "queued"
+	JobStateRunning   JobState = "running"
+	JobStateSucceeded JobState = "succeeded"
+	JobStateFailed    JobState = "failed"
+)
+
+func (s JobState) IsFinal() bool {
+	return s == JobStateSucceeded || s == JobStateFailed
+}
+
+type JobItem struct {
+	ID    string   `json:"id" bson:"id"`
+	URL   string   `json:"url" bson:"url"`
+	State JobState `json:"state" bson:"state"`
+	Error string   `json:"error,omitempty" bson:"error,omitempty"`
+	// class of failure, e.g. robots_disallowed
+	ErrorCode  string    `json:"error_code,omitempty" bson:"error_code,omitempty"`
+	MetadataID string    `json:"metadata_id,omitempty" bson:"metadata_id,omitempty"`
+	Version    int       `json:"version,omitempty" bson:"version,omitempty"`
+	UpdatedAt  time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+type Job struct {
+	ID        string    `json:"id" bson:"_id"`
+	State     JobState  `json:"state" bson:"-"`
+	Items     []JobItem `json:"items" bson:"items"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+func (j Job) ComputeState() JobState {
+	if len(j.Items) == 0 {
+		return JobStateQueued
+	}
+	var queued, running, failed int
+	for _, it := range j.Items {
+		switch it.State {
+		case JobStateQueued:
+			queued++
+		case JobStateRunning:
+			running++
+		case JobStateFailed:
+			failed++
+		}
+	}
+	switch {
+	case queued == len(j.Items):
+		return JobStateQueued
+	case queued > 0 || running > 0:
+		return JobStateRunning
+	case failed > 0:
+		return JobStateFailed
+	default:
+		return JobStateSucceeded
+	}
+}
+
+type JobItemUpdate struct {
+	State      JobState
+	Error      string
+	ErrorCode  string
+	MetadataID string
+	Version    int
+}
+
+type MongodbJobRepo struct {
+	db         *mongo.Database
+	collection string
+}
+
+func NewMongodbJobRepo(cl *mongo.Client, database, collection string) *MongodbJobRepo {
+	return &MongodbJobRepo{db: cl.Database(database), collection: collection}
+}
+
+func (m *MongodbJobRepo) EnsureIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{{
+		Keys: bson.M{"items.id": 1},
+	}}
+	if _, err := m.db.Collection(m.collection).Indexes().CreateMany(ctx, indexes); err != nil {
+		return fmt.Errorf(`failed to create job indexes: [indexes: %+v, error: %w]`, indexes, err)
+	}
+	return nil
+}
+
+func (m *MongodbJobRepo) Create(ctx context.Context, job *Job) error {
+	if job.ID == "" {
+		job.ID = uuid.New().String()
+	}
+	now := time.Now().UTC()
+	if job.CreatedAt.IsZero() {
+		job.CreatedAt = now
+	}
+	for i := range job.Items {
+		if job.Items[i].ID == "" {
+			job.Items[i].ID = uuid.New().String()
+		}
+		if job.Items[i].State == "" {
+			job.Items[i].State = JobStateQueued
+		}
+		job.Items[i].UpdatedAt = now
+	}
+	if _, err := m.db.Collection(m.collection).InsertOne(ctx, job); err != nil {
+		return fmt.Errorf(`failed to insert doc to job collection: [doc: %+v, error: %w]`, job, err)
+	}
+	job.State = job.ComputeState()
+	return nil
+}
+
+func (m *MongodbJobRepo) Get(ctx context.Context, id string) (Job, error) {
+	var job Job
+	q := bson.M{"_id": id}
+	err := m.db.Collection(m.collection).FindOne(ctx, q).Decode(&job)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Job{}, ErrNotFound{}
+	}
+	if err != nil {
+		return Job{}, fmt.Errorf(`failed to find document: [q: %+v, collection_name: %s, error: %w]`, q, m.collection, err)
+	}
+	job.State = job.ComputeState()
+	return job, nil
+}
+
+func (m *MongodbJobRepo) UpdateItem(ctx context.Context, jobID, itemID string, u JobItemUpdate) error {
+	itemFilter := bson.M{"id": itemID}
+	// final state must not be overwritten by late running transition
+	if !u.State.IsFinal() {
+		itemFilter["state"] = JobStateQueued
+	}
+	f := bson.M{"_id": jobID, "items": bson.M{"$elemMatch": itemFilter}}
+	set := bson.M{"items.$.state": u.State, "items.$.updated_at": time.Now().UTC()}
+	if u.Error != "" {
+		set["items.$.error"] = u.Error
+	}
+	if u.ErrorCode != "" {
+		set["items.$.error_code"] = u.ErrorCode
+	}
+	if u.MetadataID != "" {
+		set["items.$.metadata_id"] = u.MetadataID
+		set["items.$.version"] = u.Version
+	}
+	if _, err := m.db.Collection(m.collection).UpdateOne(ctx, f, bson.M{"$set": set}); err != nil {
+		return fmt.Errorf(`failed to update job item: [filter: %v, set: %v, error: %w]`, f, set, err)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package store
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJob_ComputeState(t *testing.T) {
+	job := Job{Items: []JobItem{{State: JobStateQueued}, {State: JobStateQueued}}}
+	require.Equal(t, JobStateQueued, job.ComputeState())
+	job.Items[0].State = JobStateSucceeded
+	require.Equal(t, JobStateRunning, job.ComputeState())
+	job.Items[1].State = JobStateFailed
+	require.Equal(t, JobStateFailed, job.ComputeState())
+	job.Items[1].State = JobStateSucceeded
+	require.Equal(t, JobStateSucceeded, job.ComputeState())
+}
+
+func TestMongodbJobRepo_UpdateItem(t *testing.T) {
+	address := os.Getenv(testDatabaseEnvVariable)
+	cl, err := BuildMongoClient(context.Background(), address)
+	require.NoError(t, err)
+	repo := NewMongodbJobRepo(cl, "test", "jobs")
+	require.NoError(t, repo.EnsureIndexes(context.Background()))
+	job := Job{Items: []JobItem{{URL: uuid.New().String()}, {URL: uuid.New().String()}}}
+	require.NoError(t, repo.Create(context.Background(), &job))
+	require.Equal(t, JobStateQueued, job.State)
+
+	require.NoError(t, repo.UpdateItem(context.Background(), job.ID, job.Items[0].ID, JobItemUpdate{State: JobStateRunning}))
+	require.NoError(t, repo.UpdateItem(context.Background(), job.ID, job.Items[0].ID, JobItemUpdate{State: JobStateSucceeded, MetadataID: uuid.New().String(), Version: 1}))
+	require.NoError(t, repo.UpdateItem(context.Background(), job.ID, job.Items[1].ID, JobItemUpdate{State: JobStateFailed, Error: "some error"}))
+	// late running transition must be ignored
+	require.NoError(t, repo.UpdateItem(context.Background(), job.ID, job.Items[1].ID, JobItemUpdate{State: JobStateRunning}))
+
+	fromDB, err := repo.Get(context.Background(), job.ID)
+	require.NoError(t, err)
+	require.Equal(t, JobStateFailed, fromDB.State)
+	require.Equal(t, JobStateSucceeded, fromDB.Items[0].State)
+	require.Equal(t, 1, fromDB.Items[0].Version)
+	require.Equal(t, JobStateFailed, fromDB.Items[1].State)
+	require.Equal(t, "some error", fromDB.Items[1].Error)
+
+	_, err = repo.Get(context.Background(), uuid.New().String())
+	require.Equal(t, ErrNotFound{}, err)
+}
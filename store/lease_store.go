@@ -0,0 +1,47 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// MongodbLeaseRepo elects single holder of named lease among instances, e.g. leader of scheduler
+type MongodbLeaseRepo struct {
+	db         *mongo.Database
+	collection string
+}
+
+func NewMongodbLeaseRepo(cl *mongo.Client, database, collection string) *MongodbLeaseRepo {
+	return &MongodbLeaseRepo{db: cl.Database(database), collection: collection}
+}
+
+// Acquire takes lease which is free or expired, or extends lease already held by holder. it returns false when
+// lease is held by other holder
+func (m *MongodbLeaseRepo) Acquire(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	f := bson.M{"_id": name, "$or": []bson.M{{"holder": holder}, {"expires_at": bson.M{"$lt": now}}}}
+	u := bson.M{"$set": bson.M{"holder": holder, "expires_at": now.Add(ttl)}}
+	_, err := m.db.Collection(m.collection).UpdateOne(ctx, f, u, options.Update().SetUpsert(true))
+	if err == nil {
+		return true, nil
+	}
+	// lease exists and is held by other holder
+	if isDuplicateKeyError(err) {
+		return false, nil
+	}
+	return false, fmt.Errorf(`failed to acquire lease: [filter: %v, error: %w]`, f, err)
+}
+
+// Release frees lease so other instance can take it without waiting for expiration
+func (m *MongodbLeaseRepo) Release(ctx context.Context, name, holder string) error {
+	f := bson.M{"_id": name, "holder": holder}
+	if _, err := m.db.Collection(m.collection).DeleteOne(ctx, f); err != nil {
+		return fmt.Errorf(`failed to release lease: [filter: %v, error: %w]`, f, err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package store
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMongodbLeaseRepo_Acquire(t *testing.T) {
+	address := os.Getenv(testDatabaseEnvVariable)
+	cl, err := BuildMongoClient(context.Background(), address)
+	require.NoError(t, err)
+	repo := NewMongodbLeaseRepo(cl, "test", uuid.New().String())
+	ctx := context.Background()
+	name := uuid.New().String()
+	first, second := uuid.New().String(), uuid.New().String()
+	ok, err := repo.Acquire(ctx, name, first, time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = repo.Acquire(ctx, name, second, time.Minute)
+	require.NoError(t, err)
+	require.False(t, ok)
+	// holder extends own lease
+	ok, err = repo.Acquire(ctx, name, first, time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	require.NoError(t, repo.Release(ctx, name, second))
+	ok, err = repo.Acquire(ctx, name, second, time.Minute)
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.NoError(t, repo.Release(ctx, name, first))
+	ok, err = repo.Acquire(ctx, name, second, time.Millisecond)
+	require.NoError(t, err)
+	require.True(t, ok)
+	// expired lease is taken over
+	time.Sleep(5 * time.Millisecond)
+	ok, err = repo.Acquire(ctx, name, first, time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+}
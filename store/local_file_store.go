@@ -0,0 +1,85 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	localShardLength = 2
+	localShardLevels = 2
+)
+
+type LocalFileRepo struct {
+	dir string
+}
+
+func NewLocalFileRepo(dir string) (*LocalFileRepo, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf(`failed to create storage directory: [dir: %s, error: %w]`, dir, err)
+	}
+	return &LocalFileRepo{dir: dir}, nil
+}
+
+// path spreads files into nested subdirectories by leading characters of file id
+// to keep number of entries per directory small
+func (l *LocalFileRepo) path(fileID string) (string, error) {
+	if fileID == "" || strings.ContainsAny(fileID, `/\`) || strings.Contains(fileID, "..") {
+		return "", fmt.Errorf(`invalid file id: [file_id: %s]`, fileID)
+	}
+	parts := []string{l.dir}
+	for i := 0; i < localShardLevels && len(fileID) >= (i+1)*localShardLength; i++ {
+		parts = append(parts, fileID[i*localShardLength:(i+1)*localShardLength])
+	}
+	return filepath.Join(append(parts, fileID)...), nil
+}
+
+func (l *LocalFileRepo) Save(ctx context.Context, file io.Reader, fileID, filename string) error {
+	p, err := l.path(fileID)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(p)
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf(`failed to create shard directory: [dir: %s, error: %w]`, dir, err)
+	}
+	tmp, err := ioutil.TempFile(dir, "."+fileID+".tmp")
+	if err != nil {
+		return fmt.Errorf(`failed to create temp file: [dir: %s, error: %w]`, dir, err)
+	}
+	if _, err = io.Copy(tmp, file); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf(`failed to copy file to temp file: [file_id: %s, filename: %s, error: %w]`, fileID, filename, err)
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf(`failed to close temp file: [path: %s, error: %w]`, tmp.Name(), err)
+	}
+	if err = os.Rename(tmp.Name(), p); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf(`failed to rename temp file: [from: %s, to: %s, error: %w]`, tmp.Name(), p, err)
+	}
+	return nil
+}
+
+func (l *LocalFileRepo) Get(ctx context.Context, fileID string) (io.ReadCloser, error) {
+	p, err := l.path(fileID)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound{}
+	}
+	if err != nil {
+		return nil, fmt.Errorf(`failed to open file: [path: %s, error: %w]`, p, err)
+	}
+	return f, nil
+}
@@ -0,0 +1,37 @@
+package store
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalFileRepo_Save(t *testing.T) {
+	dir, err := ioutil.TempDir("", "screenshot")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	repo, err := NewLocalFileRepo(dir)
+	require.NoError(t, err)
+	data := uuid.New().String()
+	fileID := uuid.New().String()
+	require.NoError(t, repo.Save(context.Background(), strings.NewReader(data), fileID, fileID))
+	_, err = os.Stat(filepath.Join(dir, fileID[0:2], fileID[2:4], fileID))
+	require.NoError(t, err)
+
+	file, err := repo.Get(context.Background(), fileID)
+	require.NoError(t, err)
+	defer file.Close()
+	dataFromDisk, err := ioutil.ReadAll(file)
+	require.NoError(t, err)
+	require.Equal(t, data, string(dataFromDisk))
+
+	_, err = repo.Get(context.Background(), uuid.New().String())
+	require.Equal(t, ErrNotFound{}, err)
+	require.Error(t, repo.Save(context.Background(), strings.NewReader(data), "../escape", "escape"))
+}
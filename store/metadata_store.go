@@ -33,19 +33,49 @@ type ErrNotFound struct{}
 func (ErrNotFound) Error() string { return "Not found" }
 
 type Metadata struct {
-	ID        string    `json:"id" bson:"_id"`
-	Url       string    `json:"url" bson:"url"`
-	Format    string    `json:"format"`
-	Quality   int       `json:"quality"`
-	Version   int       `json:"version" bson:"version"`
-	FileID    string    `json:"file_id" bson:"file_id"`
-	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	ID                string  `json:"id" bson:"_id"`
+	Url               string  `json:"url" bson:"url"`
+	Format            string  `json:"format"`
+	Quality           int     `json:"quality"`
+	ViewportWidth     int     `json:"viewport_width,omitempty" bson:"viewport_width,omitempty"`
+	ViewportHeight    int     `json:"viewport_height,omitempty" bson:"viewport_height,omitempty"`
+	DeviceScaleFactor float64 `json:"device_scale_factor,omitempty" bson:"device_scale_factor,omitempty"`
+	FullPage          bool    `json:"full_page" bson:"full_page"`
+	DelayMS           int     `json:"delay_ms,omitempty" bson:"delay_ms,omitempty"`
+	Device            string  `json:"device,omitempty" bson:"device,omitempty"`
+	Selector          string  `json:"selector,omitempty" bson:"selector,omitempty"`
+	// number of capture attempts it took to make the shot
+	Attempts int `json:"attempts,omitempty" bson:"attempts,omitempty"`
+	// schedule which published capture request, empty for requests made through api
+	ScheduleID string    `json:"schedule_id,omitempty" bson:"schedule_id,omitempty"`
+	Version    int       `json:"version" bson:"version"`
+	FileID     string    `json:"file_id" bson:"file_id"`
+	CreatedAt  time.Time `json:"created_at" bson:"created_at"`
 }
 
 func (m Metadata) GetContentType() string {
+	if m.Format == "pdf" {
+		return "application/pdf"
+	}
 	return fmt.Sprintf(`image/%s`, m.Format)
 }
 
+// versionKey identifies sequence of versions. element shots are versioned apart from page shots of the same url
+func versionKey(url, selector string) string {
+	if selector == "" {
+		return url
+	}
+	return url + "\n" + selector
+}
+
+// selectorFilter matches element shots of selector or page shots, which have no selector, when it is empty
+func selectorFilter(selector string) interface{} {
+	if selector == "" {
+		return bson.M{"$exists": false}
+	}
+	return selector
+}
+
 type MetadataByVersionDesc []Metadata
 
 func (list MetadataByVersionDesc) Len() int      { return len(list) }
@@ -79,7 +109,7 @@ func (m *MongodbMetadataRepo) Save(ctx context.Context, doc *Metadata) error {
 		ID      string `bson:"_id"`
 		Version int    `bson:"version"`
 	}{}
-	f := bson.M{"_id": doc.Url}
+	f := bson.M{"_id": versionKey(doc.Url, doc.Selector)}
 	u := bson.M{"$inc": bson.M{"version": 1}}
 	t := true
 	after := options.After
@@ -101,9 +131,10 @@ func (m *MongodbMetadataRepo) Save(ctx context.Context, doc *Metadata) error {
 	return nil
 }
 
-func (m *MongodbMetadataRepo) Get(ctx context.Context, url string, version int) (Metadata, error) {
+// Get returns version of page shot of url or of element shot when selector is not empty
+func (m *MongodbMetadataRepo) Get(ctx context.Context, url, selector string, version int) (Metadata, error) {
 	var doc Metadata
-	q := bson.M{"url": url, "version": version}
+	q := bson.M{"url": url, "selector": selectorFilter(selector), "version": version}
 	err := m.db.Collection(m.metadataCollection).FindOne(ctx, q).Decode(&doc)
 	if errors.Is(err, mongo.ErrNoDocuments) {
 		return Metadata{}, ErrNotFound{}
@@ -114,9 +145,9 @@ func (m *MongodbMetadataRepo) Get(ctx context.Context, url string, version int)
 	return doc, nil
 }
 
-func (m *MongodbMetadataRepo) GetAllVersions(ctx context.Context, url string) ([]Metadata, error) {
+func (m *MongodbMetadataRepo) GetAllVersions(ctx context.Context, url, selector string) ([]Metadata, error) {
 	var list []Metadata
-	q := bson.M{"url": url}
+	q := bson.M{"url": url, "selector": selectorFilter(selector)}
 	res, err := m.db.Collection(m.metadataCollection).Find(ctx, q)
 	if err != nil {
 		return nil, fmt.Errorf(`failed to find documents: [q: %v, collection_name: %s, error: %w]`, q, m.metadataCollection, err)
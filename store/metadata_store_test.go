@@ -14,6 +14,11 @@ const (
 	testDatabaseEnvVariable = "SCREENSHOT_TEST_DATABASE"
 )
 
+func TestMetadata_GetContentType(t *testing.T) {
+	require.Equal(t, "image/png", Metadata{Format: "png"}.GetContentType())
+	require.Equal(t, "application/pdf", Metadata{Format: "pdf"}.GetContentType())
+}
+
 func TestMongodbMetadataRepo_Save(t *testing.T) {
 	address := os.Getenv(testDatabaseEnvVariable)
 	cl, err := BuildMongoClient(context.Background(), address)
@@ -24,7 +29,7 @@ func TestMongodbMetadataRepo_Save(t *testing.T) {
 	doc := Metadata{ID: uuid.New().String(), CreatedAt: time.Now().UTC().Truncate(time.Millisecond), FileID: uuid.New().String(), Url: url}
 	require.NoError(t, repo.Save(context.Background(), &doc))
 	require.Equal(t, 1, doc.Version)
-	fromDB, err := repo.Get(context.Background(), doc.Url, doc.Version)
+	fromDB, err := repo.Get(context.Background(), doc.Url, "", doc.Version)
 	require.NoError(t, err)
 	require.Equal(t, doc, fromDB)
 	doc2 := Metadata{ID: uuid.New().String(), CreatedAt: time.Now().UTC().Truncate(time.Millisecond), FileID: uuid.New().String(), Url: url}
@@ -35,9 +40,18 @@ func TestMongodbMetadataRepo_Save(t *testing.T) {
 	require.NoError(t, repo.Save(context.Background(), &anotherDoc))
 	require.Equal(t, 1, doc.Version)
 
-	list, err := repo.GetAllVersions(context.Background(), url)
+	// element shot has own versions
+	element := Metadata{ID: uuid.New().String(), CreatedAt: time.Now().UTC().Truncate(time.Millisecond), FileID: uuid.New().String(), Url: url, Selector: "header"}
+	require.NoError(t, repo.Save(context.Background(), &element))
+	require.Equal(t, 1, element.Version)
+
+	list, err := repo.GetAllVersions(context.Background(), url, "")
 	require.NoError(t, err)
 	require.Contains(t, list, doc)
 	require.Contains(t, list, doc2)
 	require.NotContains(t, list, anotherDoc)
+	require.NotContains(t, list, element)
+	fromDB, err = repo.Get(context.Background(), url, "header", 1)
+	require.NoError(t, err)
+	require.Equal(t, element, fromDB)
 }
@@ -0,0 +1,116 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"time"
+
+	"github.com/minio/minio-go/v6"
+	"github.com/minio/minio-go/v6/pkg/credentials"
+)
+
+type S3Config struct {
+	Endpoint      string        `yaml:"endpoint"`
+	Region        string        `yaml:"region"`
+	Bucket        string        `yaml:"bucket"`
+	Prefix        string        `yaml:"prefix"`
+	AccessKey     string        `yaml:"access_key"`
+	SecretKey     string        `yaml:"secret_key"`
+	Secure        bool          `yaml:"secure"`
+	PathStyle     bool          `yaml:"path_style"`
+	PresignExpiry time.Duration `yaml:"presign_expiry"`
+}
+
+type S3FileRepo struct {
+	cl            *minio.Client
+	bucket        string
+	prefix        string
+	presignExpiry time.Duration
+}
+
+const s3ErrorCodeNoSuchKey = "NoSuchKey"
+
+func NewS3FileRepo(ctx context.Context, c S3Config) (*S3FileRepo, error) {
+	// static keys from config take precedence over AWS_* and MINIO_* environment variables
+	creds := credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.Static{Value: credentials.Value{AccessKeyID: c.AccessKey, SecretAccessKey: c.SecretKey, SignerType: credentials.SignatureV4}},
+		&credentials.EnvAWS{},
+		&credentials.EnvMinio{},
+	})
+	lookup := minio.BucketLookupAuto
+	if c.PathStyle {
+		lookup = minio.BucketLookupPath
+	}
+	cl, err := minio.NewWithOptions(c.Endpoint, &minio.Options{Creds: creds, Secure: c.Secure, Region: c.Region, BucketLookup: lookup})
+	if err != nil {
+		return nil, fmt.Errorf(`failed to create s3 client: [endpoint: %s, error: %w]`, c.Endpoint, err)
+	}
+	r := &S3FileRepo{cl: cl, bucket: c.Bucket, prefix: c.Prefix, presignExpiry: c.PresignExpiry}
+	if err = r.ensureBucket(ctx, c.Region); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *S3FileRepo) ensureBucket(ctx context.Context, region string) error {
+	exists, err := s.cl.BucketExistsWithContext(ctx, s.bucket)
+	if err != nil {
+		return fmt.Errorf(`failed to check bucket existence: [bucket: %s, error: %w]`, s.bucket, err)
+	}
+	if exists {
+		return nil
+	}
+	if err = s.cl.MakeBucketWithContext(ctx, s.bucket, region); err != nil {
+		return fmt.Errorf(`failed to create bucket: [bucket: %s, region: %s, error: %w]`, s.bucket, region, err)
+	}
+	return nil
+}
+
+func (s *S3FileRepo) key(fileID string) string {
+	return s.prefix + fileID
+}
+
+func (s *S3FileRepo) Save(ctx context.Context, file io.Reader, fileID, filename string) error {
+	// screenshots are small so object is buffered to upload it with known size in single request
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return fmt.Errorf(`failed to read file: [file_id: %s, filename: %s, error: %w]`, fileID, filename, err)
+	}
+	opt := minio.PutObjectOptions{UserMetadata: map[string]string{"filename": url.QueryEscape(filename)}}
+	if _, err = s.cl.PutObjectWithContext(ctx, s.bucket, s.key(fileID), bytes.NewReader(data), int64(len(data)), opt); err != nil {
+		return fmt.Errorf(`failed to put object: [bucket: %s, key: %s, error: %w]`, s.bucket, s.key(fileID), err)
+	}
+	return nil
+}
+
+func (s *S3FileRepo) Get(ctx context.Context, fileID string) (io.ReadCloser, error) {
+	obj, err := s.cl.GetObjectWithContext(ctx, s.bucket, s.key(fileID), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf(`failed to get object: [bucket: %s, key: %s, error: %w]`, s.bucket, s.key(fileID), err)
+	}
+	// object is fetched lazily so stat is required to find out whether it exists
+	if _, err = obj.Stat(); err != nil {
+		obj.Close()
+		if minio.ToErrorResponse(err).Code == s3ErrorCodeNoSuchKey {
+			return nil, ErrNotFound{}
+		}
+		return nil, fmt.Errorf(`failed to stat object: [bucket: %s, key: %s, error: %w]`, s.bucket, s.key(fileID), err)
+	}
+	return obj, nil
+}
+
+func (s *S3FileRepo) PresignGet(ctx context.Context, fileID, contentType string) (string, error) {
+	params := url.Values{}
+	if contentType != "" {
+		params.Set("response-content-type", contentType)
+	}
+	u, err := s.cl.PresignedGetObject(s.bucket, s.key(fileID), s.presignExpiry, params)
+	if err != nil {
+		return "", fmt.Errorf(`failed to presign get object: [bucket: %s, key: %s, error: %w]`, s.bucket, s.key(fileID), err)
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,49 @@
+package store
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+const testS3EndpointEnvVariable = "SCREENSHOT_TEST_S3"
+
+func TestS3FileRepo_Save(t *testing.T) {
+	c := S3Config{
+		Endpoint:      os.Getenv(testS3EndpointEnvVariable),
+		Region:        "us-east-1",
+		Bucket:        "test",
+		Prefix:        "screenshots/",
+		PathStyle:     true,
+		PresignExpiry: time.Minute,
+	}
+	repo, err := NewS3FileRepo(context.Background(), c)
+	require.NoError(t, err)
+	data := uuid.New().String()
+	fileID := uuid.New().String()
+	require.NoError(t, repo.Save(context.Background(), strings.NewReader(data), fileID, "http://google.com"))
+	file, err := repo.Get(context.Background(), fileID)
+	require.NoError(t, err)
+	defer file.Close()
+	dataFromS3, err := ioutil.ReadAll(file)
+	require.NoError(t, err)
+	require.Equal(t, data, string(dataFromS3))
+
+	_, err = repo.Get(context.Background(), uuid.New().String())
+	require.Equal(t, ErrNotFound{}, err)
+
+	u, err := repo.PresignGet(context.Background(), fileID, "image/png")
+	require.NoError(t, err)
+	resp, err := http.Get(u)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "image/png", resp.Header.Get("Content-Type"))
+}
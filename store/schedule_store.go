@@ -0,0 +1,156 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Schedule publishes shot request every time its cron expression fires
+type Schedule struct {
+	ID  string `json:"id" bson:"_id"`
+	URL string `json:"url" bson:"url"`
+	// shot request published when schedule fires
+	Request  string `json:"request" bson:"request"`
+	Cron     string `json:"cron" bson:"cron"`
+	Timezone string `json:"timezone,omitempty" bson:"timezone,omitempty"`
+	Enabled  bool   `json:"enabled" bson:"enabled"`
+	// zero until schedule fired for the first time
+	LastRunAt time.Time `json:"last_run_at" bson:"last_run_at"`
+	NextRunAt time.Time `json:"next_run_at" bson:"next_run_at"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+type MongodbScheduleRepo struct {
+	db         *mongo.Database
+	collection string
+}
+
+func NewMongodbScheduleRepo(cl *mongo.Client, database, collection string) *MongodbScheduleRepo {
+	return &MongodbScheduleRepo{db: cl.Database(database), collection: collection}
+}
+
+func (m *MongodbScheduleRepo) EnsureIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{{
+		Keys: bson.M{"next_run_at": 1},
+	}, {
+		Keys: bson.M{"created_at": -1},
+	}}
+	if _, err := m.db.Collection(m.collection).Indexes().CreateMany(ctx, indexes); err != nil {
+		return fmt.Errorf(`failed to create schedule indexes: [indexes: %+v, error: %w]`, indexes, err)
+	}
+	return nil
+}
+
+func (m *MongodbScheduleRepo) Create(ctx context.Context, s *Schedule) error {
+	s.ID = uuid.New().String()
+	s.CreatedAt = time.Now().UTC().Truncate(time.Millisecond)
+	s.UpdatedAt = s.CreatedAt
+	if _, err := m.db.Collection(m.collection).InsertOne(ctx, s); err != nil {
+		return fmt.Errorf(`failed to insert schedule: [schedule: %+v, error: %w]`, s, err)
+	}
+	return nil
+}
+
+func (m *MongodbScheduleRepo) Get(ctx context.Context, id string) (Schedule, error) {
+	var s Schedule
+	q := bson.M{"_id": id}
+	err := m.db.Collection(m.collection).FindOne(ctx, q).Decode(&s)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Schedule{}, ErrNotFound{}
+	}
+	if err != nil {
+		return Schedule{}, fmt.Errorf(`failed to find document: [q: %+v, collection_name: %s, error: %w]`, q, m.collection, err)
+	}
+	return s.utc(), nil
+}
+
+// List returns the most recently created schedules
+func (m *MongodbScheduleRepo) List(ctx context.Context, limit int) ([]Schedule, error) {
+	l := int64(limit)
+	return m.find(ctx, bson.M{}, &options.FindOptions{Sort: bson.M{"created_at": -1}, Limit: &l})
+}
+
+// Due returns enabled schedules which should have fired by now, the most overdue first
+func (m *MongodbScheduleRepo) Due(ctx context.Context, now time.Time, limit int) ([]Schedule, error) {
+	l := int64(limit)
+	q := bson.M{"enabled": true, "next_run_at": bson.M{"$lte": now}}
+	return m.find(ctx, q, &options.FindOptions{Sort: bson.M{"next_run_at": 1}, Limit: &l})
+}
+
+func (m *MongodbScheduleRepo) find(ctx context.Context, q bson.M, opt *options.FindOptions) ([]Schedule, error) {
+	list := []Schedule{}
+	res, err := m.db.Collection(m.collection).Find(ctx, q, opt)
+	if err != nil {
+		return nil, fmt.Errorf(`failed to find documents: [q: %v, collection_name: %s, error: %w]`, q, m.collection, err)
+	}
+	if err = res.All(ctx, &list); err != nil {
+		return nil, fmt.Errorf(`failed to decode result: [error: %w]`, err)
+	}
+	for i := range list {
+		list[i] = list[i].utc()
+	}
+	return list, nil
+}
+
+// Update replaces url, request, cron expression, timezone, enabled flag and next run of schedule
+func (m *MongodbScheduleRepo) Update(ctx context.Context, s *Schedule) error {
+	s.UpdatedAt = time.Now().UTC().Truncate(time.Millisecond)
+	f := bson.M{"_id": s.ID}
+	u := bson.M{"$set": bson.M{
+		"url":         s.URL,
+		"request":     s.Request,
+		"cron":        s.Cron,
+		"timezone":    s.Timezone,
+		"enabled":     s.Enabled,
+		"next_run_at": s.NextRunAt,
+		"updated_at":  s.UpdatedAt,
+	}}
+	res, err := m.db.Collection(m.collection).UpdateOne(ctx, f, u)
+	if err != nil {
+		return fmt.Errorf(`failed to update schedule: [filter: %v, update: %v, error: %w]`, f, u, err)
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound{}
+	}
+	return nil
+}
+
+func (m *MongodbScheduleRepo) Delete(ctx context.Context, id string) error {
+	f := bson.M{"_id": id}
+	res, err := m.db.Collection(m.collection).DeleteOne(ctx, f)
+	if err != nil {
+		return fmt.Errorf(`failed to delete schedule: [filter: %v, error: %w]`, f, err)
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound{}
+	}
+	return nil
+}
+
+// MarkRun moves schedule due at runAt to its next run. it returns false when schedule was updated or fired meanwhile
+func (m *MongodbScheduleRepo) MarkRun(ctx context.Context, id string, runAt, lastRunAt, nextRunAt time.Time) (bool, error) {
+	f := bson.M{"_id": id, "enabled": true, "next_run_at": runAt}
+	u := bson.M{"$set": bson.M{"last_run_at": lastRunAt, "next_run_at": nextRunAt}}
+	res, err := m.db.Collection(m.collection).UpdateOne(ctx, f, u)
+	if err != nil {
+		return false, fmt.Errorf(`failed to mark schedule run: [filter: %v, update: %v, error: %w]`, f, u, err)
+	}
+	return res.MatchedCount == 1, nil
+}
+
+// mongo decodes time in local time zone
+func (s Schedule) utc() Schedule {
+	s.LastRunAt = s.LastRunAt.UTC()
+	s.NextRunAt = s.NextRunAt.UTC()
+	s.CreatedAt = s.CreatedAt.UTC()
+	s.UpdatedAt = s.UpdatedAt.UTC()
+	return s
+}
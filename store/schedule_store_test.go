@@ -0,0 +1,60 @@
+package store
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMongodbScheduleRepo(t *testing.T) {
+	address := os.Getenv(testDatabaseEnvVariable)
+	cl, err := BuildMongoClient(context.Background(), address)
+	require.NoError(t, err)
+	repo := NewMongodbScheduleRepo(cl, "test", uuid.New().String())
+	require.NoError(t, repo.EnsureIndexes(context.Background()))
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Minute)
+	s := &Schedule{URL: "http://" + uuid.New().String(), Request: `{"url":"http://a.com"}`, Cron: "@daily", Enabled: true, NextRunAt: now}
+	require.NoError(t, repo.Create(ctx, s))
+	later := &Schedule{URL: "http://" + uuid.New().String(), Request: `{"url":"http://b.com"}`, Cron: "@daily", Enabled: true, NextRunAt: now.Add(time.Hour)}
+	require.NoError(t, repo.Create(ctx, later))
+
+	due, err := repo.Due(ctx, now, 10)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	require.Equal(t, s.ID, due[0].ID)
+
+	ok, err := repo.MarkRun(ctx, s.ID, now, now, now.Add(24*time.Hour))
+	require.NoError(t, err)
+	require.True(t, ok)
+	// the same run is not marked twice
+	ok, err = repo.MarkRun(ctx, s.ID, now, now, now.Add(24*time.Hour))
+	require.NoError(t, err)
+	require.False(t, ok)
+	fromDB, err := repo.Get(ctx, s.ID)
+	require.NoError(t, err)
+	require.Equal(t, now, fromDB.LastRunAt)
+	require.Equal(t, now.Add(24*time.Hour), fromDB.NextRunAt)
+
+	later.Enabled = false
+	later.NextRunAt = now
+	require.NoError(t, repo.Update(ctx, later))
+	due, err = repo.Due(ctx, now, 10)
+	require.NoError(t, err)
+	require.Empty(t, due)
+
+	list, err := repo.List(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	require.Equal(t, later.ID, list[0].ID)
+
+	require.NoError(t, repo.Delete(ctx, s.ID))
+	_, err = repo.Get(ctx, s.ID)
+	require.Equal(t, ErrNotFound{}, err)
+	require.Equal(t, ErrNotFound{}, repo.Delete(ctx, s.ID))
+	require.Equal(t, ErrNotFound{}, repo.Update(ctx, &Schedule{ID: uuid.New().String()}))
+}
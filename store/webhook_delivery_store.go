@@ -0,0 +1,105 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type WebhookAttempt struct {
+	At         time.Time `json:"at" bson:"at"`
+	StatusCode int       `json:"status_code,omitempty" bson:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty" bson:"error,omitempty"`
+}
+
+type WebhookDelivery struct {
+	ID          string           `json:"id" bson:"_id"`
+	CallbackURL string           `json:"callback_url" bson:"callback_url"`
+	Payload     string           `json:"payload" bson:"payload"`
+	Delivered   bool             `json:"delivered" bson:"delivered"`
+	Attempts    []WebhookAttempt `json:"attempts" bson:"attempts"`
+	CreatedAt   time.Time        `json:"created_at" bson:"created_at"`
+}
+
+type MongodbWebhookDeliveryRepo struct {
+	db         *mongo.Database
+	collection string
+}
+
+func NewMongodbWebhookDeliveryRepo(cl *mongo.Client, database, collection string) *MongodbWebhookDeliveryRepo {
+	return &MongodbWebhookDeliveryRepo{db: cl.Database(database), collection: collection}
+}
+
+func (m *MongodbWebhookDeliveryRepo) EnsureIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{{
+		Keys: bson.M{"delivered": 1},
+	}, {
+		Keys: bson.M{"created_at": -1},
+	}}
+	if _, err := m.db.Collection(m.collection).Indexes().CreateMany(ctx, indexes); err != nil {
+		return fmt.Errorf(`failed to create webhook delivery indexes: [indexes: %+v, error: %w]`, indexes, err)
+	}
+	return nil
+}
+
+func (m *MongodbWebhookDeliveryRepo) Create(ctx context.Context, d *WebhookDelivery) error {
+	if d.ID == "" {
+		d.ID = uuid.New().String()
+	}
+	if d.CreatedAt.IsZero() {
+		d.CreatedAt = time.Now().UTC()
+	}
+	if d.Attempts == nil {
+		d.Attempts = []WebhookAttempt{}
+	}
+	if _, err := m.db.Collection(m.collection).InsertOne(ctx, d); err != nil {
+		return fmt.Errorf(`failed to insert doc to webhook delivery collection: [doc: %+v, error: %w]`, d, err)
+	}
+	return nil
+}
+
+func (m *MongodbWebhookDeliveryRepo) AddAttempt(ctx context.Context, id string, a WebhookAttempt, delivered bool) error {
+	f := bson.M{"_id": id}
+	u := bson.M{"$push": bson.M{"attempts": a}, "$set": bson.M{"delivered": delivered}}
+	if _, err := m.db.Collection(m.collection).UpdateOne(ctx, f, u); err != nil {
+		return fmt.Errorf(`failed to add webhook attempt: [filter: %v, update: %v, error: %w]`, f, u, err)
+	}
+	return nil
+}
+
+func (m *MongodbWebhookDeliveryRepo) Get(ctx context.Context, id string) (WebhookDelivery, error) {
+	var d WebhookDelivery
+	q := bson.M{"_id": id}
+	err := m.db.Collection(m.collection).FindOne(ctx, q).Decode(&d)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return WebhookDelivery{}, ErrNotFound{}
+	}
+	if err != nil {
+		return WebhookDelivery{}, fmt.Errorf(`failed to find document: [q: %+v, collection_name: %s, error: %w]`, q, m.collection, err)
+	}
+	return d, nil
+}
+
+func (m *MongodbWebhookDeliveryRepo) List(ctx context.Context, onlyFailed bool, limit int) ([]WebhookDelivery, error) {
+	list := []WebhookDelivery{}
+	q := bson.M{}
+	if onlyFailed {
+		q["delivered"] = false
+	}
+	l := int64(limit)
+	opt := &options.FindOptions{Sort: bson.M{"created_at": -1}, Limit: &l}
+	res, err := m.db.Collection(m.collection).Find(ctx, q, opt)
+	if err != nil {
+		return nil, fmt.Errorf(`failed to find documents: [q: %v, collection_name: %s, error: %w]`, q, m.collection, err)
+	}
+	if err = res.All(ctx, &list); err != nil {
+		return nil, fmt.Errorf(`failed to decode result: [error: %w]`, err)
+	}
+	return list, nil
+}
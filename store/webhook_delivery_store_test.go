@@ -0,0 +1,38 @@
+package store
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMongodbWebhookDeliveryRepo_AddAttempt(t *testing.T) {
+	address := os.Getenv(testDatabaseEnvVariable)
+	cl, err := BuildMongoClient(context.Background(), address)
+	require.NoError(t, err)
+	repo := NewMongodbWebhookDeliveryRepo(cl, "test", uuid.New().String())
+	require.NoError(t, repo.EnsureIndexes(context.Background()))
+	d := WebhookDelivery{CallbackURL: "http://" + uuid.New().String(), Payload: `{"success":true}`, CreatedAt: time.Now().UTC().Truncate(time.Millisecond)}
+	require.NoError(t, repo.Create(context.Background(), &d))
+	failed := WebhookAttempt{At: time.Now().UTC().Truncate(time.Millisecond), StatusCode: 500}
+	require.NoError(t, repo.AddAttempt(context.Background(), d.ID, failed, false))
+
+	list, err := repo.List(context.Background(), true, 10)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	require.Equal(t, []WebhookAttempt{failed}, list[0].Attempts)
+
+	succeeded := WebhookAttempt{At: time.Now().UTC().Truncate(time.Millisecond), StatusCode: 200}
+	require.NoError(t, repo.AddAttempt(context.Background(), d.ID, succeeded, true))
+	fromDB, err := repo.Get(context.Background(), d.ID)
+	require.NoError(t, err)
+	require.True(t, fromDB.Delivered)
+	require.Equal(t, []WebhookAttempt{failed, succeeded}, fromDB.Attempts)
+	list, err = repo.List(context.Background(), true, 10)
+	require.NoError(t, err)
+	require.Empty(t, list)
+}
@@ -14,6 +14,7 @@ import (
 
 	"github.com/labstack/echo"
 	"github.com/leveldorado/screenshot/api"
+	"github.com/leveldorado/screenshot/capture"
 	"github.com/stretchr/testify/require"
 )
 
@@ -23,7 +24,8 @@ const (
 
 func TestScreenshotAPI(t *testing.T) {
 	address := os.Getenv(testAPIAddress)
-	form := api.MakeShotsRequest{URLs: []string{"https://stackoverflow.com", "https://github.com"}}
+	urls := []string{"https://stackoverflow.com", "https://github.com"}
+	form := api.NewMakeShotsRequest(urls, capture.ShotOptions{})
 	buf := &bytes.Buffer{}
 	require.NoError(t, json.NewEncoder(buf).Encode(form))
 	cl := http.Client{Timeout: 10 * time.Second}
@@ -37,8 +39,11 @@ func TestScreenshotAPI(t *testing.T) {
 	var response []api.ResponseItem
 	require.NoError(t, json.NewDecoder(resp.Body).Decode(&response))
 	resp.Body.Close()
-	for _, url := range form.URLs {
-		require.Contains(t, response, api.ResponseItem{URL: url, Success: true})
+	for _, url := range urls {
+		item, ok := findResponseItem(response, url)
+		require.True(t, ok, url)
+		require.True(t, item.Success, item.Error)
+		require.GreaterOrEqual(t, item.Attempts, 1)
 
 		req, err = http.NewRequest(http.MethodGet, fmt.Sprintf(`%s%s?url=%s`, address, api.ScreenshotPath, url), nil)
 		require.NoError(t, err)
@@ -61,3 +66,12 @@ func TestScreenshotAPI(t *testing.T) {
 	}
 
 }
+
+func findResponseItem(response []api.ResponseItem, url string) (api.ResponseItem, bool) {
+	for _, item := range response {
+		if item.URL == url {
+			return item, true
+		}
+	}
+	return api.ResponseItem{}, false
+}
@@ -0,0 +1,95 @@
+package webhook
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// ForbiddenAddressError is returned when callback url resolves to address of internal network which is not allowed
+type ForbiddenAddressError struct {
+	Address string
+}
+
+func (e *ForbiddenAddressError) Error() string {
+	return fmt.Sprintf(`callback address is not allowed: [address: %s]`, e.Address)
+}
+
+// private ranges of rfc 1918, rfc 6598 (carrier-grade nat) and rfc 4193 (unique local)
+var privateNetworks = mustParseNetworks([]string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "fc00::/7"})
+
+func mustParseNetworks(cidrs []string) []*net.IPNet {
+	nets, err := parseNetworks(cidrs)
+	if err != nil {
+		panic(err)
+	}
+	return nets
+}
+
+func parseNetworks(cidrs []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, fmt.Errorf(`failed to parse network: [cidr: %s, error: %w]`, c, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func contains(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// internal reports loopback, link-local (including cloud metadata endpoint), unspecified and private addresses
+func internal(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsUnspecified() || contains(privateNetworks, ip)
+}
+
+// addressPolicy rejects connections to internal addresses unless they belong to allowed networks
+type addressPolicy struct {
+	allowed []*net.IPNet
+}
+
+func (p addressPolicy) check(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf(`failed to split address: [address: %s, error: %w]`, address, err)
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return &ForbiddenAddressError{Address: address}
+	}
+	if internal(ip) && !contains(p.allowed, ip) {
+		return &ForbiddenAddressError{Address: address}
+	}
+	return nil
+}
+
+// transport checks address after host is resolved, so host resolving to internal address (e.g. dns rebinding) is
+// rejected too. proxy from environment is not used, since it would be the only address checked
+func (p addressPolicy) transport() *http.Transport {
+	d := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, c syscall.RawConn) error {
+			return p.check(address)
+		},
+	}
+	return &http.Transport{
+		DialContext:           d.DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+}
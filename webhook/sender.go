@@ -0,0 +1,151 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/leveldorado/screenshot/store"
+)
+
+const (
+	SignatureHeader  = "X-Screenshot-Signature"
+	DeliveryIDHeader = "X-Screenshot-Delivery"
+	signaturePrefix  = "sha256="
+)
+
+type deliveryRepo interface {
+	Create(ctx context.Context, d *store.WebhookDelivery) error
+	AddAttempt(ctx context.Context, id string, a store.WebhookAttempt, delivered bool) error
+	Get(ctx context.Context, id string) (store.WebhookDelivery, error)
+	List(ctx context.Context, onlyFailed bool, limit int) ([]store.WebhookDelivery, error)
+}
+
+type RetryPolicy struct {
+	MaxAttempts    int           `yaml:"max_attempts"`
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if d >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+	return d
+}
+
+type Sender struct {
+	cl     *http.Client
+	repo   deliveryRepo
+	secret []byte
+	retry  RetryPolicy
+}
+
+// NewSender creates sender which refuses to connect to loopback, link-local and private addresses, so callback url
+// can not reach internal services. allowedNetworks (cidrs) lift it for trusted internal receivers
+func NewSender(repo deliveryRepo, secret string, requestTimeout time.Duration, retry RetryPolicy, allowedNetworks []string) (*Sender, error) {
+	if retry.MaxAttempts < 1 {
+		retry.MaxAttempts = 1
+	}
+	allowed, err := parseNetworks(allowedNetworks)
+	if err != nil {
+		return nil, err
+	}
+	cl := &http.Client{Timeout: requestTimeout, Transport: addressPolicy{allowed: allowed}.transport()}
+	return &Sender{cl: cl, repo: repo, secret: []byte(secret), retry: retry}, nil
+}
+
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *Sender) Send(ctx context.Context, callbackURL string, payload interface{}) (store.WebhookDelivery, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return store.WebhookDelivery{}, fmt.Errorf(`failed to marshal payload: [payload: %+v, error: %w]`, payload, err)
+	}
+	d := store.WebhookDelivery{CallbackURL: callbackURL, Payload: string(data)}
+	if err = s.repo.Create(ctx, &d); err != nil {
+		return store.WebhookDelivery{}, fmt.Errorf(`failed to create webhook delivery: [callback_url: %s, error: %w]`, callbackURL, err)
+	}
+	return s.deliver(ctx, d, s.retry.MaxAttempts)
+}
+
+// Replay makes single attempt, so caller is not held by backoff of retries
+func (s *Sender) Replay(ctx context.Context, id string) (store.WebhookDelivery, error) {
+	d, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return store.WebhookDelivery{}, fmt.Errorf(`failed to get webhook delivery: [id: %s, error: %w]`, id, err)
+	}
+	return s.deliver(ctx, d, 1)
+}
+
+func (s *Sender) Get(ctx context.Context, id string) (store.WebhookDelivery, error) {
+	return s.repo.Get(ctx, id)
+}
+
+func (s *Sender) List(ctx context.Context, onlyFailed bool, limit int) ([]store.WebhookDelivery, error) {
+	return s.repo.List(ctx, onlyFailed, limit)
+}
+
+func (s *Sender) deliver(ctx context.Context, d store.WebhookDelivery, maxAttempts int) (store.WebhookDelivery, error) {
+	for attempt := 1; ; attempt++ {
+		a := s.post(ctx, d)
+		d.Delivered = a.Error == ""
+		d.Attempts = append(d.Attempts, a)
+		if err := s.repo.AddAttempt(ctx, d.ID, a, d.Delivered); err != nil {
+			return d, fmt.Errorf(`failed to record webhook attempt: [id: %s, attempt: %+v, error: %w]`, d.ID, a, err)
+		}
+		if d.Delivered {
+			return d, nil
+		}
+		if attempt >= maxAttempts {
+			return d, fmt.Errorf(`failed to deliver webhook: [id: %s, callback_url: %s, attempts: %d, last_error: %s]`, d.ID, d.CallbackURL, attempt, a.Error)
+		}
+		select {
+		case <-time.After(s.retry.backoff(attempt)):
+		case <-ctx.Done():
+			return d, fmt.Errorf(`context done before webhook delivered: [id: %s, error: %w]`, d.ID, ctx.Err())
+		}
+	}
+}
+
+func (s *Sender) post(ctx context.Context, d store.WebhookDelivery) store.WebhookAttempt {
+	a := store.WebhookAttempt{At: time.Now().UTC()}
+	body := []byte(d.Payload)
+	req, err := http.NewRequest(http.MethodPost, d.CallbackURL, bytes.NewReader(body))
+	if err != nil {
+		a.Error = fmt.Sprintf(`failed to create request: %s`, err)
+		return a
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DeliveryIDHeader, d.ID)
+	req.Header.Set(SignatureHeader, Sign(s.secret, body))
+	resp, err := s.cl.Do(req)
+	if err != nil {
+		a.Error = fmt.Sprintf(`failed to do request: %s`, err)
+		return a
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	a.StatusCode = resp.StatusCode
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		a.Error = fmt.Sprintf(`received not successful response code: %s`, resp.Status)
+	}
+	return a
+}
@@ -0,0 +1,159 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/leveldorado/screenshot/store"
+)
+
+type mockDeliveryRepo struct {
+	mock.Mock
+}
+
+func (m *mockDeliveryRepo) Create(ctx context.Context, d *store.WebhookDelivery) error {
+	return m.Called(ctx, d).Error(0)
+}
+
+func (m *mockDeliveryRepo) AddAttempt(ctx context.Context, id string, a store.WebhookAttempt, delivered bool) error {
+	return m.Called(ctx, id, a, delivered).Error(0)
+}
+
+func (m *mockDeliveryRepo) Get(ctx context.Context, id string) (store.WebhookDelivery, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(store.WebhookDelivery), args.Error(1)
+}
+
+func (m *mockDeliveryRepo) List(ctx context.Context, onlyFailed bool, limit int) ([]store.WebhookDelivery, error) {
+	args := m.Called(ctx, onlyFailed, limit)
+	return args.Get(0).([]store.WebhookDelivery), args.Error(1)
+}
+
+func TestSender_Send(t *testing.T) {
+	secret := uuid.New().String()
+	deliveryID := uuid.New().String()
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.Equal(t, `{"success":true}`, string(body))
+		require.Equal(t, Sign([]byte(secret), body), r.Header.Get(SignatureHeader))
+		require.Equal(t, deliveryID, r.Header.Get(DeliveryIDHeader))
+		if calls == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	repo := &mockDeliveryRepo{}
+	repo.On("Create", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		args.Get(1).(*store.WebhookDelivery).ID = deliveryID
+	}).Return(nil)
+	repo.On("AddAttempt", mock.Anything, deliveryID, mock.MatchedBy(func(a store.WebhookAttempt) bool {
+		return a.StatusCode == http.StatusBadGateway && a.Error != ""
+	}), false).Return(nil).Once()
+	repo.On("AddAttempt", mock.Anything, deliveryID, mock.MatchedBy(func(a store.WebhookAttempt) bool {
+		return a.StatusCode == http.StatusNoContent && a.Error == ""
+	}), true).Return(nil).Once()
+
+	s, err := NewSender(repo, secret, time.Second, RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}, []string{"127.0.0.0/8"})
+	require.NoError(t, err)
+	d, err := s.Send(context.Background(), srv.URL, map[string]bool{"success": true})
+	require.NoError(t, err)
+	require.True(t, d.Delivered)
+	require.Len(t, d.Attempts, 2)
+	require.Equal(t, 2, calls)
+	repo.AssertExpectations(t)
+}
+
+func TestSender_ReplayMakesSingleAttempt(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	d := store.WebhookDelivery{ID: uuid.New().String(), CallbackURL: srv.URL, Payload: `{}`}
+	repo := &mockDeliveryRepo{}
+	repo.On("Get", mock.Anything, d.ID).Return(d, nil)
+	repo.On("AddAttempt", mock.Anything, d.ID, mock.Anything, false).Return(nil).Once()
+	s, err := NewSender(repo, "secret", time.Second, RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}, []string{"127.0.0.0/8"})
+	require.NoError(t, err)
+	replayed, err := s.Replay(context.Background(), d.ID)
+	require.Error(t, err)
+	require.False(t, replayed.Delivered)
+	require.Len(t, replayed.Attempts, 1)
+	require.Equal(t, 1, calls)
+	repo.AssertExpectations(t)
+}
+
+func TestSender_SendRefusesInternalAddress(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	defer srv.Close()
+	repo := &mockDeliveryRepo{}
+	repo.On("Create", mock.Anything, mock.Anything).Return(nil)
+	repo.On("AddAttempt", mock.Anything, mock.Anything, mock.MatchedBy(func(a store.WebhookAttempt) bool {
+		return strings.Contains(a.Error, "callback address is not allowed")
+	}), false).Return(nil).Once()
+	s, err := NewSender(repo, "secret", time.Second, RetryPolicy{MaxAttempts: 1}, nil)
+	require.NoError(t, err)
+	_, err = s.Send(context.Background(), srv.URL, map[string]bool{"success": true})
+	require.Error(t, err)
+	require.Zero(t, calls)
+	repo.AssertExpectations(t)
+
+	_, err = NewSender(repo, "secret", time.Second, RetryPolicy{}, []string{"10.0.0.1"})
+	require.Error(t, err)
+}
+
+func TestAddressPolicy_Check(t *testing.T) {
+	p := addressPolicy{allowed: mustParseNetworks([]string{"10.1.0.0/16"})}
+	for address, allowed := range map[string]bool{
+		"93.184.216.34:80":      true,
+		"[2606:4700::1111]:80":  true,
+		"127.0.0.1:80":          false,
+		"[::1]:443":             false,
+		"169.254.169.254:80":    false,
+		"0.0.0.0:80":            false,
+		"10.0.0.1:80":           false,
+		"172.16.5.4:80":         false,
+		"192.168.1.1:80":        false,
+		"100.64.0.1:80":         false,
+		"[fd00::1]:80":          false,
+		"[fe80::1]:80":          false,
+		"[::ffff:127.0.0.1]:80": false,
+		"10.1.2.3:80":           true,
+	} {
+		err := p.check(address)
+		if allowed {
+			require.NoError(t, err, address)
+			continue
+		}
+		var forbidden *ForbiddenAddressError
+		require.True(t, errors.As(err, &forbidden), address)
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	require.Equal(t, time.Second, p.backoff(1))
+	require.Equal(t, 2*time.Second, p.backoff(2))
+	require.Equal(t, 4*time.Second, p.backoff(3))
+	require.Equal(t, 5*time.Second, p.backoff(4))
+}